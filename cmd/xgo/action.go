@@ -0,0 +1,234 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// actionInputs maps the inputs of the GitHub Action to the xgo flags they set.
+var actionInputs = []struct {
+	input string
+	flag  string
+	bool  bool
+}{
+	{"go-version", "go-version", false},
+	{"go-proxy", "go-proxy", false},
+	{"project-path", "project-path", false},
+	{"cmd-path", "cmd-path", false},
+	{"bin-path", "bin-path", false},
+	{"pkg", "pkg", false},
+	{"prefix", "command-prefix", false},
+	{"targets", "targets", false},
+	{"deps", "deps", false},
+	{"deps-args", "depsargs", false},
+	{"docker-repo", "docker-repo", false},
+	{"docker-image", "docker-image", false},
+	{"tags", "tags", false},
+	{"ldflags", "build-ldflags", false},
+	{"buildmode", "build-mode", false},
+	{"buildvcs", "build-vcs", false},
+	{"trimpath", "build-trim-path", true},
+	{"race", "race", true},
+	{"v", "v", true},
+	{"x", "x", true},
+}
+
+// actionInput retrieves the value of a GitHub Action input.
+func actionInput(name string) string {
+	return strings.TrimSpace(os.Getenv("INPUT_" + strings.ToUpper(strings.Replace(name, " ", "_", -1))))
+}
+
+// runAction implements the action subcommand, running xgo as a GitHub Action:
+// the build is configured from the INPUT_* environment variables, the deps cache
+// is restored and saved via the Actions cache service, the artifacts uploaded
+// and the outputs and job summary written.
+func runAction(args []string) error {
+	// Assemble the build flags from the action inputs
+	var flags []string
+	for _, in := range actionInputs {
+		value := actionInput(in.input)
+		switch {
+		case value == "":
+			continue
+		case in.bool:
+			flags = append(flags, fmt.Sprintf("-%s=%v", in.flag, value == "true"))
+		default:
+			flags = append(flags, "-"+in.flag, value)
+		}
+	}
+	extra, err := shellFields(actionInput("args"))
+	if err != nil {
+		return fmt.Errorf("invalid args input: %v", err)
+	}
+	flags = append(flags, extra...)
+	flags = append(flags, args...)
+
+	binDir := actionInput("bin-path")
+	if binDir == "" {
+		binDir = "bin"
+	}
+	binDir, _ = filepath.Abs(binDir)
+
+	// Restore the deps cache from previous workflow runs if requested
+	api := newActionsAPI()
+	cacheKey := ""
+	if deps := actionInput("deps"); deps != "" && actionInput("cache") != "false" {
+		// The dependencies are built by the toolchains of the image with their configure arguments
+		image := strings.Join([]string{actionInput("docker-image"), actionInput("docker-repo"), actionInput("go-version")}, "\n")
+		sum := sha256.Sum256([]byte(strings.Join([]string{deps, actionInput("deps-args"), image}, "\n")))
+		cacheKey = "xgo-deps-" + hex.EncodeToString(sum[:8])
+		if err := api.restoreCache(cacheKey, depsCache); err != nil {
+			log.Printf("WARNING: Failed to restore deps cache: %v", err)
+		}
+	}
+	// Run the build itself
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	log.Printf("INFO: Running xgo %s", strings.Join(flags, " "))
+
+	cmd := exec.Command(self, flags...)
+	cmd.Env = os.Environ()
+	buildErr := run(cmd)
+
+	// Save the deps cache and collect the artifacts
+	if cacheKey != "" && buildErr == nil {
+		if err := api.saveCache(cacheKey, depsCache); err != nil {
+			log.Printf("WARNING: Failed to save deps cache: %v", err)
+		}
+	}
+	var artifacts []string
+	filepath.Walk(binDir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && !info.ModTime().Before(start) {
+			artifacts = append(artifacts, path)
+		}
+		return nil
+	})
+	sort.Strings(artifacts)
+
+	if name := actionInput("upload"); name != "" && name != "false" && buildErr == nil {
+		if name == "true" {
+			name = "xgo"
+		}
+		if err := api.uploadArtifact(name, binDir, artifacts); err != nil {
+			log.Printf("WARNING: Failed to upload artifacts: %v", err)
+		}
+	}
+	if err := writeActionOutputs(binDir, artifacts); err != nil {
+		log.Printf("WARNING: Failed to write action outputs: %v", err)
+	}
+	if err := writeActionSummary(binDir, artifacts, buildErr); err != nil {
+		log.Printf("WARNING: Failed to write job summary: %v", err)
+	}
+	return buildErr
+}
+
+// shellFields splits the free form arguments of the action into words the way
+// a shell does, quotes (single or double) and backslashes keeping spaces within
+// a word, e.g. -build-ldflags "-s -w".
+func shellFields(s string) ([]string, error) {
+	var (
+		fields []string
+		word   strings.Builder
+		inWord bool
+		quote  rune
+		escape bool
+	)
+	for _, r := range s {
+		switch {
+		case escape:
+			if quote == '"' && !strings.ContainsRune("\\\"$`\n", r) {
+				word.WriteRune('\\')
+			}
+			word.WriteRune(r)
+			escape = false
+		case r == '\\' && quote != '\'':
+			escape, inWord = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inWord {
+				fields = append(fields, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 || escape {
+		return nil, fmt.Errorf("unterminated quote or escape in %q", s)
+	}
+	if inWord {
+		fields = append(fields, word.String())
+	}
+	return fields, nil
+}
+
+// writeActionOutputs exports the bin path and the produced artifacts as outputs
+// of the action step.
+func writeActionOutputs(binDir string, artifacts []string) error {
+	path := os.Getenv("GITHUB_OUTPUT")
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fmt.Fprintf(f, "bin-path=%s\n", binDir)
+	fmt.Fprintf(f, "artifacts<<XGO_EOF\n%s\nXGO_EOF\n", strings.Join(artifacts, "\n"))
+	return nil
+}
+
+// writeActionSummary renders the produced artifacts into the job summary.
+func writeActionSummary(binDir string, artifacts []string, buildErr error) error {
+	path := os.Getenv("GITHUB_STEP_SUMMARY")
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fmt.Fprintf(f, "## xgo\n\n")
+	if buildErr != nil {
+		fmt.Fprintf(f, ":x: Cross compilation failed: `%v`\n\n", buildErr)
+	}
+	if len(artifacts) == 0 {
+		fmt.Fprintf(f, "No artifacts produced.\n")
+		return nil
+	}
+	fmt.Fprintf(f, "| Artifact | Size | SHA256 |\n|---|---:|---|\n")
+	for _, artifact := range artifacts {
+		rel, _ := filepath.Rel(binDir, artifact)
+		size := int64(0)
+		if info, err := os.Stat(artifact); err == nil {
+			size = info.Size()
+		}
+		digest, _ := fileDigest(artifact)
+		fmt.Fprintf(f, "| `%s` | %d | `%s` |\n", filepath.ToSlash(rel), size, digest)
+	}
+	return nil
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/crazy-max/xgo/pkg/xgo"
+)
+
+// actionsAPI is a minimal client of the GitHub Actions results service, used to
+// store caches and upload artifacts from within a workflow run.
+type actionsAPI struct {
+	url   string // Base URL of the results service (ACTIONS_RESULTS_URL)
+	token string // Runtime token of the workflow job (ACTIONS_RUNTIME_TOKEN)
+}
+
+// newActionsAPI creates a results service client from the runtime environment.
+func newActionsAPI() *actionsAPI {
+	return &actionsAPI{
+		url:   strings.TrimSuffix(os.Getenv("ACTIONS_RESULTS_URL"), "/"),
+		token: os.Getenv("ACTIONS_RUNTIME_TOKEN"),
+	}
+}
+
+// call invokes a twirp method of the results service.
+func (api *actionsAPI) call(service string, method string, req interface{}, res interface{}) error {
+	if api.url == "" || api.token == "" {
+		return errors.New("ACTIONS_RESULTS_URL or ACTIONS_RUNTIME_TOKEN not available")
+	}
+	blob, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%s/twirp/github.actions.results.api.v1.%s/%s", api.url, service, method)
+	r, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(blob))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Authorization", "Bearer "+api.token)
+
+	resp, err := xgo.HTTPClient.Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s/%s failed: %s: %s", service, method, resp.Status, body)
+	}
+	return json.NewDecoder(resp.Body).Decode(res)
+}
+
+// backendIDs extracts the workflow run and job identifiers from the runtime
+// token, needed to associate artifacts with the current job.
+func (api *actionsAPI) backendIDs() (string, string, error) {
+	parts := strings.Split(api.token, ".")
+	if len(parts) != 3 {
+		return "", "", errors.New("malformed runtime token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", "", err
+	}
+	var claims struct {
+		Scp string `json:"scp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", "", err
+	}
+	for _, scope := range strings.Fields(claims.Scp) {
+		if ids := strings.Split(scope, ":"); len(ids) == 3 && ids[0] == "Actions.Results" {
+			return ids[1], ids[2], nil
+		}
+	}
+	return "", "", errors.New("no results scope in runtime token")
+}
+
+// cacheVersion identifies the layout of the caches created by xgo.
+func cacheVersion(dir string) string {
+	sum := sha256.Sum256([]byte("xgo|tar.gz|" + filepath.ToSlash(dir)))
+	return hex.EncodeToString(sum[:])
+}
+
+// restoreCache downloads and extracts a cache entry into a folder, if one with
+// the given key exists.
+func (api *actionsAPI) restoreCache(key string, dir string) error {
+	var res struct {
+		Ok                bool   `json:"ok"`
+		SignedDownloadURL string `json:"signed_download_url"`
+		MatchedKey        string `json:"matched_key"`
+	}
+	req := map[string]interface{}{"key": key, "restore_keys": []string{}, "version": cacheVersion(dir)}
+	if err := api.call("CacheService", "GetCacheEntryDownloadURL", req, &res); err != nil {
+		return err
+	}
+	if !res.Ok {
+		log.Printf("INFO: No cache found for %s", key)
+		return nil
+	}
+	resp, err := xgo.HTTPClient.Get(res.SignedDownloadURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("cache download failed: %s", resp.Status)
+	}
+	if err := untarGz(resp.Body, dir); err != nil {
+		return err
+	}
+	log.Printf("INFO: Restored cache %s into %s", res.MatchedKey, dir)
+	return nil
+}
+
+// saveCache archives a folder and stores it as a cache entry with the given key.
+func (api *actionsAPI) saveCache(key string, dir string) error {
+	var archive bytes.Buffer
+	if err := tarGz(&archive, dir); err != nil {
+		return err
+	}
+	var created struct {
+		Ok              bool   `json:"ok"`
+		SignedUploadURL string `json:"signed_upload_url"`
+	}
+	req := map[string]interface{}{"key": key, "version": cacheVersion(dir)}
+	if err := api.call("CacheService", "CreateCacheEntry", req, &created); err != nil {
+		return err
+	}
+	if !created.Ok {
+		return nil // Entry already exists or is being created concurrently
+	}
+	size := archive.Len()
+	if err := uploadBlob(created.SignedUploadURL, archive.Bytes()); err != nil {
+		return err
+	}
+	var finalized struct {
+		Ok bool `json:"ok"`
+	}
+	req = map[string]interface{}{"key": key, "version": cacheVersion(dir), "size_bytes": strconv.Itoa(size)}
+	if err := api.call("CacheService", "FinalizeCacheEntryUpload", req, &finalized); err != nil {
+		return err
+	}
+	log.Printf("INFO: Saved cache %s (%d bytes)", key, size)
+	return nil
+}
+
+// uploadArtifact zips the given files and uploads them as a workflow artifact.
+func (api *actionsAPI) uploadArtifact(name string, root string, files []string) error {
+	runID, jobID, err := api.backendIDs()
+	if err != nil {
+		return err
+	}
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	for _, file := range files {
+		rel, _ := filepath.Rel(root, file)
+		w, err := zw.Create(filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	var created struct {
+		Ok              bool   `json:"ok"`
+		SignedUploadURL string `json:"signed_upload_url"`
+	}
+	req := map[string]interface{}{
+		"workflow_run_backend_id":     runID,
+		"workflow_job_run_backend_id": jobID,
+		"name":                        name,
+		"version":                     4,
+	}
+	if err := api.call("ArtifactService", "CreateArtifact", req, &created); err != nil {
+		return err
+	}
+	if !created.Ok {
+		return fmt.Errorf("artifact %s could not be created", name)
+	}
+	if err := uploadBlob(created.SignedUploadURL, archive.Bytes()); err != nil {
+		return err
+	}
+	sum := sha256.Sum256(archive.Bytes())
+	var finalized struct {
+		Ok         bool   `json:"ok"`
+		ArtifactID string `json:"artifact_id"`
+	}
+	req = map[string]interface{}{
+		"workflow_run_backend_id":     runID,
+		"workflow_job_run_backend_id": jobID,
+		"name":                        name,
+		"size":                        strconv.Itoa(archive.Len()),
+		"hash":                        "sha256:" + hex.EncodeToString(sum[:]),
+	}
+	if err := api.call("ArtifactService", "FinalizeArtifact", req, &finalized); err != nil {
+		return err
+	}
+	log.Printf("INFO: Uploaded artifact %s (%d files, id %s)", name, len(files), finalized.ArtifactID)
+	return nil
+}
+
+// uploadBlob stores a blob at a signed Azure storage URL.
+func uploadBlob(url string, blob []byte) error {
+	req, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(blob))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("x-ms-blob-type", "BlockBlob")
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := xgo.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("blob upload failed: %s", resp.Status)
+	}
+	return nil
+}
+
+// tarGz archives the regular files of a folder into a gzipped tarball.
+func tarGz(w io.Writer, dir string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// untarGz extracts the regular files of a gzipped tarball into a folder.
+func untarGz(r io.Reader, dir string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		path := filepath.Join(dir, filepath.FromSlash(header.Name))
+		if !strings.HasPrefix(path, filepath.Clean(dir)+string(filepath.Separator)) {
+			return fmt.Errorf("invalid path in archive: %s", header.Name)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(header.Mode))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, tr)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
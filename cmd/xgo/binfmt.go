@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Container registering the QEMU user emulation handlers in the host kernel
+var binfmtImage = "multiarch/qemu-user-static"
+
+// binfmtDir is the location of the kernel's registered binfmt_misc handlers
+var binfmtDir = "/proc/sys/fs/binfmt_misc"
+
+// qemuArchs maps the Go architectures to the name of their QEMU emulator.
+var qemuArchs = map[string]string{
+	"386":      "i386",
+	"amd64":    "x86_64",
+	"arm":      "arm",
+	"arm64":    "aarch64",
+	"mips":     "mips",
+	"mipsle":   "mipsel",
+	"mips64":   "mips64",
+	"mips64le": "mips64el",
+	"ppc64le":  "ppc64le",
+	"riscv64":  "riscv64",
+	"s390x":    "s390x",
+}
+
+// runBinfmt implements the binfmt subcommand, installing or checking the QEMU
+// binfmt handlers needed to run foreign architecture binaries and images.
+func runBinfmt(args []string) error {
+	fs := flag.NewFlagSet("binfmt", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: xgo binfmt install|check\n")
+		fs.PrintDefaults()
+	}
+	image := fs.String("image", binfmtImage, "Container image registering the QEMU binfmt handlers")
+	fs.Parse(args)
+
+	switch fs.Arg(0) {
+	case "install":
+		if err := checkDocker(); err != nil {
+			return fmt.Errorf("failed to check docker installation: %v", err)
+		}
+		log.Printf("INFO: Registering QEMU binfmt handlers via %s...", *image)
+		if err := run(runtimeCommand("run", "--rm", "--privileged", *image, "--reset", "-p", "yes")); err != nil {
+			return fmt.Errorf("failed to register binfmt handlers: %v", err)
+		}
+		return checkBinfmt()
+	case "check":
+		return checkBinfmt()
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown binfmt command %q", fs.Arg(0))
+	}
+}
+
+// checkBinfmt reports the architectures that can and cannot be emulated on the
+// host, failing if any of them is missing a handler.
+func checkBinfmt() error {
+	var archs, missing []string
+	for goarch := range qemuArchs {
+		archs = append(archs, goarch)
+	}
+	sort.Strings(archs)
+
+	for _, goarch := range archs {
+		if binfmtRegistered(goarch) {
+			log.Printf("INFO: binfmt handler found for %s (qemu-%s)", goarch, qemuArchs[goarch])
+		} else {
+			missing = append(missing, goarch)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("no binfmt handlers for %s, run 'xgo binfmt install'", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// binfmtRegistered checks whether the binaries of a Go architecture can be run
+// on the host, either natively or via a registered QEMU handler.
+func binfmtRegistered(goarch string) bool {
+	if goarch == runtime.GOARCH {
+		return true
+	}
+	qemu, ok := qemuArchs[goarch]
+	if !ok {
+		return false
+	}
+	blob, err := os.ReadFile(filepath.Join(binfmtDir, "qemu-"+qemu))
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(string(blob), "enabled")
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/crazy-max/xgo/pkg/xgo"
+)
+
+// command is an xgo subcommand, receiving the arguments following its name.
+type command struct {
+	usage string                    // One line description of the subcommand
+	run   func(args []string) error // Implementation of the subcommand
+}
+
+// commands are the subcommands of xgo, building being the default if no known
+// subcommand is given (e.g. xgo --targets=linux/arm64 .).
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"build":   {"Cross compile a project (default)", func(args []string) error { return runBuild("build", args) }},
+		"run":     {"Run a command in the build environment", func(args []string) error { return runBuild("run", args) }},
+		"env":     {"Report the effective build environment", func(args []string) error { return runBuild("env", args) }},
+		"pull":    {"Pull the build image", runPull},
+		"targets": {"List the supported build targets", runTargets},
+		"cache":   {"Manage the CGO dependency cache", runCache},
+		"verify":  {"Verify a previously produced artifact set", runVerify},
+		"version": {"Print the xgo version", runVersion},
+		"history": {"List, show and compare past builds", runHistory},
+		"binfmt":  {"Install or check the QEMU binfmt handlers", runBinfmt},
+		"serve":   {"Run the build daemon", runServe},
+		"action":  {"Build as a GitHub Action", runAction},
+
+		"run-pipeline":  {"Run a pipeline of the config file", runPipeline},
+		"diff-manifest": {"Compare the build reports of a golden and a new build", runDiffManifest},
+		"devcontainer":  {"Export the build environment as a devcontainer configuration", func(args []string) error { return runBuild("devcontainer", args) }},
+	}
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintf(out, "Usage: xgo [command] [flags]\n\nCommands:\n")
+
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		for _, name := range names {
+			fmt.Fprintf(w, "  %s\t%s\n", name, commands[name].usage)
+		}
+		w.Flush()
+
+		fmt.Fprintf(out, "\nBuild flags (build, run, env, pull, run-pipeline, devcontainer):\n")
+		flag.PrintDefaults()
+	}
+}
+
+// runPull implements the pull subcommand, pulling the build image selected by
+// the build flags ahead of building, e.g. to warm up a CI runner.
+func runPull(args []string) error {
+	parseFlags(args)
+	return xgo.Pull(context.Background(), xgo.Config{
+		Image:            selectImage(),
+		Runtime:          *runtimeFlag,
+		RegistryUser:     *registryUser,
+		RegistryPassword: registryPassword(),
+		ImagePolicy:      imagePolicy(),
+		PolicyOverride:   *policyOverride,
+	})
+}
+
+// runTargets implements the targets subcommand, listing the build targets of the
+// selected build image or the built-in target groups.
+func runTargets(args []string) error {
+	fs := flag.NewFlagSet("targets", flag.ExitOnError)
+	groups := fs.Bool("groups", false, "List the built-in target groups instead (e.g. desktop)")
+	asJSON := fs.Bool("json", false, "Print the targets as JSON, e.g. to generate CI build matrices")
+	fs.String("go-version", "", "Go version of the build image to list the targets of, detected from the project go.mod if empty")
+	fs.String("docker-repo", "", "Use custom docker repo instead of official distribution")
+	fs.String("docker-image", "", "Use custom docker image instead of official distribution")
+	fs.String("profiles", "", "JSON file of custom target toolchain profiles to list along")
+	fs.String("config", "", "Project config file to read the target profiles from")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: xgo targets [flags]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *groups {
+		names := make([]string, 0, len(xgo.TargetGroups))
+		for name := range xgo.TargetGroups {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, name := range names {
+			fmt.Fprintf(w, "%s\t%s\n", name, strings.Join(xgo.TargetGroups[name], ","))
+		}
+		return w.Flush()
+	}
+	// Select the build image like a build would, with the image flags given here
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name != "groups" && f.Name != "json" {
+			flag.Set(f.Name, f.Value.String())
+		}
+	})
+	cfg := buildConfig("targets", parseFlags(nil))
+
+	infos, err := xgo.SupportedTargets(context.Background(), cfg)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(infos)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TARGET\tOS\tARCH\tVARIANT\tCGO\tCC\tLIBC")
+	for _, info := range infos {
+		cgo, cc, libc := "no", info.CC, info.Libc
+		if info.CGO {
+			cgo = "yes"
+		}
+		if info.Profile {
+			cc += " (profile)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", info.Target, info.OS, info.Arch, dash(info.Variant), cgo, dash(cc), dash(libc))
+	}
+	return w.Flush()
+}
+
+// dash stands in for the empty cells of the command tables.
+func dash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// runVerify implements the verify subcommand, re-checking the artifacts of a
+// previous build (its bin path or JSON build report), e.g. before publishing.
+func runVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	linkage := fs.String("linkage", "", "Expected linkage of the Linux binaries (static|dynamic)")
+	sbom := fs.Bool("require-sbom", false, "Require an SBOM next to every binary (e.g. <binary>.spdx.json)")
+	signatures := fs.Bool("require-signatures", false, "Require a detached signature of every artifact (<artifact>.asc or .sig)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: xgo verify [flags] <dir|report.json>\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("no artifact folder or build report to verify")
+	}
+	return xgo.VerifyArtifacts(fs.Arg(0), xgo.VerifyOptions{
+		Linkage:    *linkage,
+		SBOM:       *sbom,
+		Signatures: *signatures,
+	})
+}
+
+// runVersion implements the version subcommand.
+func runVersion(args []string) error {
+	fmt.Println(version)
+	return nil
+}
+
+// runCache implements the cache subcommand, managing the cache of downloaded
+// CGO dependencies.
+func runCache(args []string) error {
+	fs := flag.NewFlagSet("cache", flag.ExitOnError)
+	project := fs.String("project", "", "Manage the project-deps-cache layer configured for the given project path instead of the global cache")
+	dir := fs.String("cache-dir", depsCache, "Global cache folder to manage")
+	olderThan := fs.String("older-than", "", "Only clean the dependencies not used for the given age (e.g. 30d, 2w, 12h)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: xgo cache [--cache-dir=<path>] [--project=<path>] [--older-than=<age>] path|list|clean\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	cache := *dir
+	if *project != "" {
+		var layer string
+		if path := findConfig(*project); path != "" {
+			config, err := loadConfig(path)
+			if err != nil {
+				return fmt.Errorf("failed to load config file %s: %v", path, err)
+			}
+			layer = config.ProjectDepsCache
+		}
+		if layer == "" {
+			return fmt.Errorf("project %s has no project-deps-cache configured", *project)
+		}
+		if !filepath.IsAbs(layer) {
+			layer = filepath.Join(*project, layer)
+		}
+		cache = layer
+	}
+
+	switch fs.Arg(0) {
+	case "path", "dir":
+		fmt.Println(cache)
+		return nil
+	case "list":
+		entries, err := os.ReadDir(cache)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		var total int64
+		for _, entry := range entries {
+			size := pathSize(filepath.Join(cache, entry.Name()))
+			total += size
+
+			used := "-"
+			if info, err := entry.Info(); err == nil {
+				used = info.ModTime().Format("2006-01-02 15:04")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", entry.Name(), xgo.FormatSize(size), used)
+		}
+		fmt.Fprintf(w, "total\t%s\t\n", xgo.FormatSize(total))
+		return w.Flush()
+	case "clean":
+		if *olderThan == "" {
+			log.Printf("INFO: Removing dependency cache %s", cache)
+			return os.RemoveAll(cache)
+		}
+		age, err := parseAge(*olderThan)
+		if err != nil {
+			return err
+		}
+		return cleanCache(cache, time.Now().Add(-age))
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown cache command %q", fs.Arg(0))
+	}
+}
+
+// cleanCache removes the dependencies of a cache not used since the given time,
+// cache hits marking the dependencies as used.
+func cleanCache(cache string, cutoff time.Time) error {
+	entries, err := os.ReadDir(cache)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var (
+		removed int
+		freed   int64
+	)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		path := filepath.Join(cache, entry.Name())
+		size := pathSize(path)
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+		log.Printf("INFO: Removed %s (%s, last used %s)", entry.Name(), xgo.FormatSize(size), info.ModTime().Format("2006-01-02"))
+		removed, freed = removed+1, freed+size
+	}
+	log.Printf("INFO: Removed %d of %d cached dependencies, freeing %s", removed, len(entries), xgo.FormatSize(freed))
+	return nil
+}
+
+// parseAge parses an age given as a Go duration, or as a number of days or weeks
+// (e.g. 30d, 2w).
+func parseAge(age string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if strings.HasSuffix(age, suffix) {
+			n, err := strconv.Atoi(strings.TrimSuffix(age, suffix))
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("invalid age %q", age)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(age)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q, must be a duration (e.g. 12h) or a number of days or weeks (e.g. 30d, 2w)", age)
+	}
+	return d, nil
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/crazy-max/xgo/pkg/xgo"
+	"gopkg.in/yaml.v3"
+)
+
+// configFiles are the names of the project config files, in order of priority.
+var configFiles = []string{".xgo.yml", ".xgo.yaml", "xgo.toml"}
+
+// FileConfig is the per-project build configuration read from an .xgo.yml or
+// xgo.toml file. Every setting maps to a command line flag, flags explicitly
+// given on the command line overriding the config file.
+type FileConfig struct {
+	GoVersion    string   `yaml:"go-version" toml:"go-version"`
+	GoProxy      string   `yaml:"go-proxy" toml:"go-proxy"`
+	GoSumDB      string   `yaml:"go-sumdb" toml:"go-sumdb"`
+	GoNoSumDB    string   `yaml:"go-nosumdb" toml:"go-nosumdb"`
+	GoPrivate    string   `yaml:"go-private" toml:"go-private"`
+	GoNoProxy    string   `yaml:"go-noproxy" toml:"go-noproxy"`
+	GoInsecure   string   `yaml:"go-insecure" toml:"go-insecure"`
+	GoFlags      string   `yaml:"go-flags" toml:"go-flags"`
+	Warm         *bool    `yaml:"warm" toml:"warm"`
+	WarmStart    *bool    `yaml:"warm-start" toml:"warm-start"`
+	SSHAgent     *bool    `yaml:"ssh-agent" toml:"ssh-agent"`
+	Netrc        string   `yaml:"netrc" toml:"netrc"`
+	GitConfig    *bool    `yaml:"forward-git-config" toml:"forward-git-config"`
+	DockerRepo   string   `yaml:"docker-repo" toml:"docker-repo"`
+	DockerImage  string   `yaml:"docker-image" toml:"docker-image"`
+	Pull         string   `yaml:"pull" toml:"pull"`
+	Runtime      string   `yaml:"runtime" toml:"runtime"`
+	Network      string   `yaml:"network" toml:"network"`
+	NoDocker     *bool    `yaml:"no-docker" toml:"no-docker"`
+	FastPath     *bool    `yaml:"fast-path" toml:"fast-path"`
+	RemoteEngine string   `yaml:"remote-engine" toml:"remote-engine"`
+	DNS          []string `yaml:"dns" toml:"dns"`
+	DNSSearch    []string `yaml:"dns-search" toml:"dns-search"`
+	AddHosts     []string `yaml:"add-hosts" toml:"add-hosts"`
+	Remote       string   `yaml:"remote" toml:"remote"`
+	Branch       string   `yaml:"branch" toml:"branch"`
+	ReadOnlySrc  *bool    `yaml:"read-only-source" toml:"read-only-source"`
+	SourceIgnore []string `yaml:"source-ignore" toml:"source-ignore"`
+	Package      string   `yaml:"pkg" toml:"pkg"`
+	Include      []string `yaml:"include" toml:"include"`
+	Exclude      []string `yaml:"exclude" toml:"exclude"`
+	CmdPath      string   `yaml:"cmd-path" toml:"cmd-path"`
+	BinPath      string   `yaml:"bin-path" toml:"bin-path"`
+	Prefix       string   `yaml:"prefix" toml:"prefix"`
+	NameTemplate string   `yaml:"name-template" toml:"name-template"`
+	PlatformDirs *bool    `yaml:"platform-dirs" toml:"platform-dirs"`
+	Targets      []string `yaml:"targets" toml:"targets"`
+	Parallel     int      `yaml:"parallel" toml:"parallel"`
+	RetryTargets int      `yaml:"retry-targets" toml:"retry-targets"`
+
+	Deps             []string `yaml:"deps" toml:"deps"`
+	DepsArgs         string   `yaml:"deps-args" toml:"deps-args"`
+	DepsMirrors      []string `yaml:"deps-mirrors" toml:"deps-mirrors"`
+	ProjectDepsCache string   `yaml:"project-deps-cache" toml:"project-deps-cache"`
+	CacheDir         string   `yaml:"cache-dir" toml:"cache-dir"`
+	WorkDir          string   `yaml:"work-dir" toml:"work-dir"`
+	ArtifactCache    string   `yaml:"artifact-cache" toml:"artifact-cache"`
+
+	Tags        string `yaml:"tags" toml:"tags"`
+	LdFlags     string `yaml:"ldflags" toml:"ldflags"`
+	BuildMode   string `yaml:"buildmode" toml:"buildmode"`
+	BuildVCS    string `yaml:"buildvcs" toml:"buildvcs"`
+	TrimPath    *bool  `yaml:"trimpath" toml:"trimpath"`
+	Reproduce   *bool  `yaml:"reproducible" toml:"reproducible"`
+	Epoch       string `yaml:"source-date-epoch" toml:"source-date-epoch"`
+	AutoVersion *bool  `yaml:"auto-version" toml:"auto-version"`
+	Race        *bool  `yaml:"race" toml:"race"`
+	ArmFloatABI string `yaml:"arm-float-abi" toml:"arm-float-abi"`
+	Libc        string `yaml:"libc" toml:"libc"`
+	Subsystem   string `yaml:"windows-subsystem" toml:"windows-subsystem"`
+	SynthModule *bool  `yaml:"synth-module" toml:"synth-module"`
+
+	CgoCFlags      map[string]string              `yaml:"cgo-cflags" toml:"cgo-cflags"`               // Keyed by os/arch, * for all targets
+	CgoLdFlags     map[string]string              `yaml:"cgo-ldflags" toml:"cgo-ldflags"`             // Keyed by os/arch, * for all targets
+	TargetBinPaths map[string]string              `yaml:"target-bin-paths" toml:"target-bin-paths"`   // Keyed by os/arch pattern
+	Profiles       map[string]*xgo.TargetProfile  `yaml:"profiles" toml:"profiles"`                   // Keyed by os/arch(-variant)
+	Overrides      map[string]*xgo.TargetOverride `yaml:"overrides" toml:"overrides"`                 // Keyed by os/arch pattern
+	Packages       []xgo.PackageRule              `yaml:"packages" toml:"packages"`                   // First matching rule wins
+	Generate       []xgo.Generator                `yaml:"generate" toml:"generate"`                   // Run with a built binary
+	Render         []xgo.RenderFile               `yaml:"render" toml:"render"`                       // Rendered from the build manifest
+	Variants       []xgo.FeatureVariant           `yaml:"feature-variants" toml:"feature-variants"`   // Every target built once per variant
+	Filters        []xgo.ArtifactFilter           `yaml:"artifact-filters" toml:"artifact-filters"`   // Applied to the artifacts in order
+	Pipelines      map[string][]PipelineStep      `yaml:"pipelines" toml:"pipelines"`                 // Run with xgo run-pipeline <name>
+	TargetGroups   map[string][]string            `yaml:"target-groups" toml:"target-groups"`         // Keyed by group name
+	WindowsRes     *xgo.WindowsResources          `yaml:"windows-resources" toml:"windows-resources"` // Embedded into the Windows binaries
+
+	Verify      *bool    `yaml:"verify" toml:"verify"`
+	Linkage     string   `yaml:"linkage" toml:"linkage"`
+	AllowedLibs []string `yaml:"allowed-libs" toml:"allowed-libs"`
+	Checksums   []string `yaml:"checksum" toml:"checksum"`
+	Publish     []string `yaml:"publish" toml:"publish"`
+	CodeSignKey string   `yaml:"code-sign-key" toml:"code-sign-key"`
+	WindowsPFX  string   `yaml:"windows-sign-pfx" toml:"windows-sign-pfx"`
+	MacIdentity string   `yaml:"macos-sign-identity" toml:"macos-sign-identity"`
+	MacKeychain string   `yaml:"macos-sign-keychain" toml:"macos-sign-keychain"`
+	MacP12      string   `yaml:"macos-sign-p12" toml:"macos-sign-p12"`
+	MacNotarize *bool    `yaml:"macos-notarize" toml:"macos-notarize"`
+	Notes       string   `yaml:"release-notes" toml:"release-notes"`
+
+	Archive        string   `yaml:"archive" toml:"archive"`
+	ArchiveInclude []string `yaml:"archive-include" toml:"archive-include"`
+	PackageLevel   int      `yaml:"package-level" toml:"package-level"`
+}
+
+// findConfig looks up the config file of a project, returning an empty path if
+// the project has none.
+func findConfig(project string) string {
+	for _, name := range configFiles {
+		if path := filepath.Join(project, name); fileExists(path) {
+			return path
+		}
+	}
+	return ""
+}
+
+// loadConfig reads a YAML or TOML (based on the extension) project config file,
+// rejecting any unknown settings.
+func loadConfig(path string) (*FileConfig, error) {
+	blob, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := new(FileConfig)
+	if filepath.Ext(path) == ".toml" {
+		meta, err := toml.Decode(string(blob), config)
+		if err != nil {
+			return nil, err
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return nil, fmt.Errorf("unknown setting %q", undecoded[0].String())
+		}
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(blob))
+		dec.KnownFields(true)
+		if err := dec.Decode(config); err != nil {
+			return nil, err
+		}
+	}
+	for target, profile := range config.Profiles {
+		if err := profile.Resolve(target); err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+// defaultImagePolicy is the system wide image policy file, used unless another
+// one is given.
+const defaultImagePolicy = "/etc/xgo/image-policy.yml"
+
+// loadImagePolicy reads a YAML or TOML (based on the extension) image policy
+// file, rejecting any unknown settings.
+func loadImagePolicy(path string) (*xgo.ImagePolicy, error) {
+	blob, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	policy := new(xgo.ImagePolicy)
+	if filepath.Ext(path) == ".toml" {
+		meta, err := toml.Decode(string(blob), policy)
+		if err != nil {
+			return nil, err
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return nil, fmt.Errorf("unknown setting %q", undecoded[0].String())
+		}
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(blob))
+		dec.KnownFields(true)
+		if err := dec.Decode(policy); err != nil {
+			return nil, err
+		}
+	}
+	return policy, nil
+}
+
+// apply merges the config file into the command line flags, skipping any flags
+// explicitly set on the command line.
+func (c *FileConfig) apply(fs *flag.FlagSet) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	values := []struct {
+		flag  string
+		value string
+	}{
+		{"go-version", c.GoVersion},
+		{"go-proxy", c.GoProxy},
+		{"go-sumdb", c.GoSumDB},
+		{"go-nosumdb", c.GoNoSumDB},
+		{"go-private", c.GoPrivate},
+		{"go-noproxy", c.GoNoProxy},
+		{"go-insecure", c.GoInsecure},
+		{"go-flags", c.GoFlags},
+		{"warm", formatBool(c.Warm)},
+		{"warm-start", formatBool(c.WarmStart)},
+		{"ssh-agent", formatBool(c.SSHAgent)},
+		{"netrc", c.Netrc},
+		{"forward-git-config", formatBool(c.GitConfig)},
+		{"docker-repo", c.DockerRepo},
+		{"docker-image", c.DockerImage},
+		{"pull", c.Pull},
+		{"runtime", c.Runtime},
+		{"network", c.Network},
+		{"no-docker", formatBool(c.NoDocker)},
+		{"fast-path", formatBool(c.FastPath)},
+		{"remote-engine", c.RemoteEngine},
+		{"remote", c.Remote},
+		{"branch", c.Branch},
+		{"read-only-source", formatBool(c.ReadOnlySrc)},
+		{"pkg", c.Package},
+		{"include", strings.Join(c.Include, ",")},
+		{"exclude", strings.Join(c.Exclude, ",")},
+		{"cmd-path", c.CmdPath},
+		{"bin-path", c.BinPath},
+		{"command-prefix", c.Prefix},
+		{"name-template", c.NameTemplate},
+		{"platform-dirs", formatBool(c.PlatformDirs)},
+		{"targets", strings.Join(c.Targets, ",")},
+		{"parallel", formatInt(c.Parallel)},
+		{"retry-targets", formatInt(c.RetryTargets)},
+		{"deps", strings.Join(c.Deps, " ")},
+		{"depsargs", c.DepsArgs},
+		{"project-deps-cache", c.ProjectDepsCache},
+		{"cache-dir", c.CacheDir},
+		{"work-dir", c.WorkDir},
+		{"artifact-cache", c.ArtifactCache},
+		{"tags", c.Tags},
+		{"build-ldflags", c.LdFlags},
+		{"build-mode", c.BuildMode},
+		{"build-vcs", c.BuildVCS},
+		{"build-trim-path", formatBool(c.TrimPath)},
+		{"reproducible", formatBool(c.Reproduce)},
+		{"source-date-epoch", c.Epoch},
+		{"auto-version", formatBool(c.AutoVersion)},
+		{"race", formatBool(c.Race)},
+		{"arm-float-abi", c.ArmFloatABI},
+		{"libc", c.Libc},
+		{"windows-subsystem", c.Subsystem},
+		{"synth-module", formatBool(c.SynthModule)},
+		{"verify", formatBool(c.Verify)},
+		{"linkage", c.Linkage},
+		{"allowed-libs", strings.Join(c.AllowedLibs, ",")},
+		{"checksum", strings.Join(c.Checksums, ",")},
+		{"code-sign-key", c.CodeSignKey},
+		{"windows-sign-pfx", c.WindowsPFX},
+		{"macos-sign-identity", c.MacIdentity},
+		{"macos-sign-keychain", c.MacKeychain},
+		{"macos-sign-p12", c.MacP12},
+		{"macos-notarize", formatBool(c.MacNotarize)},
+		{"release-notes", c.Notes},
+		{"archive", c.Archive},
+		{"package-level", formatInt(c.PackageLevel)},
+	}
+	for _, v := range values {
+		if v.value == "" || set[v.flag] {
+			continue
+		}
+		if err := fs.Set(v.flag, v.value); err != nil {
+			return fmt.Errorf("invalid %s: %v", v.flag, err)
+		}
+	}
+	lists := []struct {
+		flag   string
+		values []string
+	}{
+		{"deps-mirror", c.DepsMirrors},
+		{"dns", c.DNS},
+		{"dns-search", c.DNSSearch},
+		{"add-host", c.AddHosts},
+		{"archive-include", c.ArchiveInclude},
+	}
+	for _, l := range lists {
+		if set[l.flag] {
+			continue
+		}
+		for _, value := range l.values {
+			fs.Set(l.flag, value)
+		}
+	}
+	maps := []struct {
+		flag   string
+		values map[string]string
+	}{
+		{"cgo-cflags", c.CgoCFlags},
+		{"cgo-ldflags", c.CgoLdFlags},
+		{"target-bin-path", c.TargetBinPaths},
+	}
+	for _, m := range maps {
+		if set[m.flag] {
+			continue
+		}
+		for target, value := range m.values {
+			if target != "*" {
+				value = target + "=" + value
+			}
+			if err := fs.Set(m.flag, value); err != nil {
+				return fmt.Errorf("invalid %s: %v", m.flag, err)
+			}
+		}
+	}
+	return nil
+}
+
+// formatInt converts an optional numeric setting into a flag value.
+func formatInt(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+// formatBool converts an optional boolean setting into a flag value.
+func formatBool(b *bool) string {
+	if b == nil {
+		return ""
+	}
+	return strconv.FormatBool(*b)
+}
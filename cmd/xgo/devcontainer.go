@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/crazy-max/xgo/pkg/xgo"
+)
+
+// devcontainer is the subset of the Dev Container specification describing an
+// image based development container.
+type devcontainer struct {
+	Name            string            `json:"name"`
+	Image           string            `json:"image"`
+	WorkspaceMount  string            `json:"workspaceMount,omitempty"`
+	WorkspaceFolder string            `json:"workspaceFolder,omitempty"`
+	Mounts          []string          `json:"mounts,omitempty"`
+	ContainerEnv    map[string]string `json:"containerEnv,omitempty"`
+	RunArgs         []string          `json:"runArgs,omitempty"`
+	Customizations  interface{}       `json:"customizations,omitempty"`
+}
+
+// writeDevcontainer writes the build container of the given configuration as a
+// .devcontainer/devcontainer.json of the project, with the same image, mounts
+// and environment, to open the cross compilation environment in an editor.
+func writeDevcontainer(cfg xgo.Config) error {
+	if cfg.Image == "" {
+		return errors.New("no build image to develop in when running within xgo")
+	}
+	// The sources are meant to be edited, not only built
+	cfg.ReadOnlySource = false
+
+	args, err := xgo.ContainerArgs(cfg)
+	if err != nil {
+		return err
+	}
+	dc := &devcontainer{
+		Name:           "xgo " + filepath.Base(cfg.Project.ProjectPath),
+		Image:          cfg.Image,
+		ContainerEnv:   make(map[string]string),
+		Customizations: map[string]interface{}{"vscode": map[string]interface{}{"extensions": []string{"golang.go"}}},
+	}
+	// Convert the run arguments into their devcontainer.json counterparts
+	var mounts []string
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "run" && i == 0, arg == "--rm":
+		case (arg == "-v" || arg == "-e" || arg == "-w") && i+1 < len(args):
+			switch value := args[i+1]; arg {
+			case "-v":
+				mounts = append(mounts, value)
+			case "-w":
+				dc.WorkspaceFolder = value
+			default:
+				if kv := strings.SplitN(value, "=", 2); len(kv) == 2 {
+					dc.ContainerEnv[kv[0]] = kv[1]
+				} else {
+					dc.ContainerEnv[value] = "${localEnv:" + value + "}"
+				}
+			}
+			i++
+		default:
+			dc.RunArgs = append(dc.RunArgs, arg)
+		}
+	}
+	// The editor only knows the platform of the code if a single target is built
+	for _, env := range xgo.TargetEnv(cfg.Project.Targets) {
+		kv := strings.SplitN(env, "=", 2)
+		dc.ContainerEnv[kv[0]] = kv[1]
+	}
+	// Mount the sources as the workspace, the other volumes as extra mounts
+	for _, volume := range mounts {
+		mount, target := devcontainerMount(volume)
+		if dc.WorkspaceMount == "" && dc.WorkspaceFolder != "" && (target == dc.WorkspaceFolder || strings.HasPrefix(dc.WorkspaceFolder, target+"/")) {
+			dc.WorkspaceMount = mount
+		} else {
+			dc.Mounts = append(dc.Mounts, mount)
+		}
+	}
+	blob, err := json.MarshalIndent(dc, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(cfg.Project.ProjectPath, ".devcontainer", "devcontainer.json")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(blob, '\n'), 0644); err != nil {
+		return err
+	}
+	log.Printf("INFO: Wrote devcontainer configuration %s", path)
+	return nil
+}
+
+// devcontainerMount converts a volume argument (source:target[:options]) into
+// the mount syntax of devcontainer.json, also returning its target.
+func devcontainerMount(volume string) (string, string) {
+	parts := strings.Split(volume, ":")
+	options := ""
+	if len(parts) > 2 && !strings.HasPrefix(parts[len(parts)-1], "/") {
+		parts, options = parts[:len(parts)-1], parts[len(parts)-1]
+	}
+	source, target := strings.Join(parts[:len(parts)-1], ":"), parts[len(parts)-1]
+
+	mount := "source=" + source + ",target=" + target + ",type=bind"
+	for _, option := range strings.Split(options, ",") {
+		if option == "ro" {
+			mount += ",readonly"
+		}
+	}
+	return mount, target
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/crazy-max/xgo/pkg/xgo"
+)
+
+// runDiffManifest implements the diff-manifest subcommand, comparing the JSON
+// reports (--report-json) of a golden and a new build for release reviews.
+func runDiffManifest(args []string) error {
+	fs := flag.NewFlagSet("diff-manifest", flag.ExitOnError)
+	exitCode := fs.Bool("exit-code", false, "Fail if the builds differ, e.g. to hold a release until signed off")
+	threshold := fs.Float64("size-threshold", 0, "Only report the size changes of the outputs larger than the given percentage")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: xgo diff-manifest [flags] <golden.json> <new.json>\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("expected the build reports of a golden and a new build")
+	}
+	golden, err := loadReport(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	current, err := loadReport(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	changes := diffReports(os.Stdout, golden, current, *threshold)
+	if changes == 0 {
+		fmt.Println("No differences")
+		return nil
+	}
+	if *exitCode {
+		return fmt.Errorf("%d differences between the builds", changes)
+	}
+	return nil
+}
+
+// loadReport reads a JSON build report.
+func loadReport(path string) (*xgo.Report, error) {
+	blob, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	report := new(xgo.Report)
+	if err := json.Unmarshal(blob, report); err != nil {
+		return nil, fmt.Errorf("invalid build report %s: %v", path, err)
+	}
+	return report, nil
+}
+
+// diffReports prints the differences between two build reports, returning how
+// many were found: the build environment and flags, the targets added, removed
+// or failing, the outputs added, removed or resized beyond the threshold (in
+// percent), and the Go and module versions embedded into the binaries.
+func diffReports(w io.Writer, a, b *xgo.Report, threshold float64) int {
+	changes := 0
+	field := func(name, va, vb string) {
+		if va != vb {
+			fmt.Fprintf(w, "%s:\n  - %s\n  + %s\n", name, dash(va), dash(vb))
+			changes++
+		}
+	}
+	field("image", a.Image, b.Image)
+	field("image digest", a.Digest, b.Digest)
+	field("success", strconv.FormatBool(a.Success), strconv.FormatBool(b.Success))
+	for _, name := range unionKeys(a.Flags, b.Flags) {
+		field("flag "+name, a.Flags[name], b.Flags[name])
+	}
+
+	// Targets and their outputs, the artifacts of no target keyed by the empty one
+	ta, tb := reportTargets(a), reportTargets(b)
+	for _, key := range unionKeys(ta, tb) {
+		ra, oka := ta[key]
+		rb, okb := tb[key]
+		switch {
+		case !oka:
+			fmt.Fprintf(w, "target %s: added\n", key)
+			changes++
+			continue
+		case !okb:
+			fmt.Fprintf(w, "target %s: removed\n", key)
+			changes++
+			continue
+		case ra.Success != rb.Success:
+			fmt.Fprintf(w, "target %s: %s -> %s\n", key, targetStatus(ra), targetStatus(rb))
+			changes++
+		}
+		changes += diffOutputs(w, key, ra.Outputs, rb.Outputs, threshold)
+	}
+
+	// Versions embedded into the binaries, merged across them
+	ga, ma := reportModules(a)
+	gb, mb := reportModules(b)
+	field("go version", ga, gb)
+	for _, path := range unionKeys(ma, mb) {
+		va, oka := ma[path]
+		vb, okb := mb[path]
+		switch {
+		case !oka:
+			fmt.Fprintf(w, "module %s: added %s\n", path, vb)
+			changes++
+		case !okb:
+			fmt.Fprintf(w, "module %s: removed %s\n", path, va)
+			changes++
+		case va != vb:
+			fmt.Fprintf(w, "module %s: %s -> %s\n", path, va, vb)
+			changes++
+		}
+	}
+	return changes
+}
+
+// diffOutputs prints the outputs of a target added, removed or resized between
+// two builds. Outputs are matched by file name, a single unmatched output on
+// each side being matched anyway, as versioned names change across releases.
+func diffOutputs(w io.Writer, target string, a, b []xgo.OutputReport, threshold float64) int {
+	oa, ob := make(map[string]xgo.OutputReport), make(map[string]xgo.OutputReport)
+	for _, output := range a {
+		oa[filepath.Base(output.Path)] = output
+	}
+	for _, output := range b {
+		ob[filepath.Base(output.Path)] = output
+	}
+	var added, removed []string
+	for _, name := range unionKeys(oa, ob) {
+		if _, ok := oa[name]; !ok {
+			added = append(added, name)
+		} else if _, ok := ob[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	if len(added) == 1 && len(removed) == 1 {
+		oa[added[0]] = oa[removed[0]]
+		delete(oa, removed[0])
+		added, removed = nil, nil
+	}
+
+	label := target
+	if label == "" {
+		label = "files"
+	}
+	changes := 0
+	for _, name := range removed {
+		fmt.Fprintf(w, "output %s (%s): removed\n", name, label)
+		changes++
+	}
+	for _, name := range added {
+		fmt.Fprintf(w, "output %s (%s): added (%s)\n", name, label, xgo.FormatSize(ob[name].Size))
+		changes++
+	}
+	for _, name := range unionKeys(oa, ob) {
+		va, oka := oa[name]
+		vb, okb := ob[name]
+		if !oka || !okb || va.Size == vb.Size {
+			continue
+		}
+		delta := vb.Size - va.Size
+		percent := math.Inf(1)
+		if va.Size > 0 {
+			percent = float64(delta) * 100 / float64(va.Size)
+		}
+		if math.Abs(percent) <= threshold {
+			continue
+		}
+		sign := "+"
+		if delta < 0 {
+			sign, delta = "-", -delta
+		}
+		fmt.Fprintf(w, "output %s (%s): size %s -> %s (%s%s, %+.1f%%)\n", name, label, xgo.FormatSize(va.Size), xgo.FormatSize(vb.Size), sign, xgo.FormatSize(delta), percent)
+		changes++
+	}
+	return changes
+}
+
+// reportTargets indexes the targets of a build report by feature:target (the
+// target alone without feature variants), the artifacts of no target being
+// listed under the empty key.
+func reportTargets(report *xgo.Report) map[string]xgo.TargetReport {
+	targets := make(map[string]xgo.TargetReport)
+	for _, target := range report.Targets {
+		key := target.Target
+		if target.Feature != "" {
+			key = target.Feature + ":" + key
+		}
+		targets[key] = target
+	}
+	if len(report.Files) > 0 {
+		targets[""] = xgo.TargetReport{Success: true, Outputs: report.Files}
+	}
+	return targets
+}
+
+// targetStatus describes the outcome of a target.
+func targetStatus(target xgo.TargetReport) string {
+	if target.Success {
+		return "succeeded"
+	}
+	return "failed (" + target.Error + ")"
+}
+
+// reportModules merges the Go and module versions embedded into the outputs of a
+// build report, the versions differing across outputs being listed together.
+func reportModules(report *xgo.Report) (string, map[string]string) {
+	goVersions := make(map[string]bool)
+	versions := make(map[string]map[string]bool)
+	for _, target := range report.Targets {
+		for _, output := range target.Outputs {
+			if output.GoVersion != "" {
+				goVersions[output.GoVersion] = true
+			}
+			for path, version := range output.Modules {
+				if versions[path] == nil {
+					versions[path] = make(map[string]bool)
+				}
+				versions[path][version] = true
+			}
+		}
+	}
+	modules := make(map[string]string)
+	for path, set := range versions {
+		modules[path] = strings.Join(unionKeys(set), ", ")
+	}
+	return strings.Join(unionKeys(goVersions), ", "), modules
+}
+
+// unionKeys returns the sorted union of the keys of string keyed maps.
+func unionKeys(maps ...interface{}) []string {
+	seen := make(map[string]bool)
+	for _, m := range maps {
+		switch m := m.(type) {
+		case map[string]string:
+			for key := range m {
+				seen[key] = true
+			}
+		case map[string]bool:
+			for key := range m {
+				seen[key] = true
+			}
+		case map[string]xgo.TargetReport:
+			for key := range m {
+				seen[key] = true
+			}
+		case map[string]xgo.OutputReport:
+			for key := range m {
+				seen[key] = true
+			}
+		}
+	}
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/build"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/crazy-max/xgo/pkg/xgo"
+)
+
+// toolchainProbe prints the Go version of a build environment followed by all
+// the C cross compilers it has available.
+const toolchainProbe = `go version
+for dir in $(echo "$PATH" | tr ':' ' ') /osxcross/bin; do ls "$dir" 2>/dev/null; done | grep -E -- '-(gcc|clang)$' | sort -u`
+
+// EnvReport is the effective build environment xgo would cross compile with.
+type EnvReport struct {
+	Image       string     `json:"image"`        // Docker image selected for the build
+	ImageDigest string     `json:"image_digest"` // Content digest of the docker image, if available locally
+	GoVersion   string     `json:"go_version"`   // Go version shipped in the build environment
+	Toolchains  []string   `json:"toolchains"`   // C cross compilers available in the build environment
+	Caches      []EnvCache `json:"caches"`       // Host side caches used by the builds
+	Env         []string   `json:"env"`          // Environment passed to the build script
+}
+
+// EnvCache is a host side cache location along with its current size.
+type EnvCache struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// runEnv reports the effective build environment of the given build specs,
+// either human readable or as JSON.
+func runEnv(cfg xgo.Config, asJSON bool) error {
+	image := cfg.Image
+	report := &EnvReport{
+		Image: image,
+		Caches: []EnvCache{
+			{Name: "dependencies", Path: depsCache},
+			{Name: "go modules", Path: filepath.Join(build.Default.GOPATH, "pkg", "mod")},
+			{Name: "build history", Path: historyPath()},
+		},
+	}
+	if cache := cfg.ProjectCache; cache != "" {
+		if !filepath.IsAbs(cache) {
+			cache = filepath.Join(cfg.Project.ProjectPath, cache)
+		}
+		report.Caches = append(report.Caches[:1], append([]EnvCache{{Name: "project dependencies", Path: cache}}, report.Caches[1:]...)...)
+	}
+	for i := range report.Caches {
+		report.Caches[i].Size = pathSize(report.Caches[i].Path)
+	}
+	// Probe the build environment, either the docker image or the current system
+	var probe *exec.Cmd
+	if image != "" {
+		if out, err := runtimeCommand("image", "inspect", "--format", "{{.Id}}", image).Output(); err == nil {
+			report.ImageDigest = strings.TrimSpace(string(out))
+			probe = runtimeCommand("run", "--rm", "--entrypoint", "sh", image, "-c", toolchainProbe)
+		}
+		// The exact environment is only known after assembling the container
+		args, err := xgo.ContainerArgs(cfg)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < len(args)-1; i++ {
+			if args[i] == "-e" {
+				report.Env = append(report.Env, args[i+1])
+			}
+		}
+	} else {
+		probe = exec.Command("sh", "-c", toolchainProbe)
+		report.Env = xgo.BuildEnv(cfg)
+	}
+	if probe != nil {
+		if out, err := probe.Output(); err == nil {
+			lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+			report.GoVersion = strings.TrimPrefix(lines[0], "go version ")
+			report.Toolchains = lines[1:]
+		}
+	}
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	return report.print()
+}
+
+// print writes the human readable form of the report to the standard output.
+func (r *EnvReport) print() error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+
+	image, digest, goVersion := r.Image, r.ImageDigest, r.GoVersion
+	if image == "" {
+		image = "none (running inside xgo)"
+	} else if digest == "" {
+		digest = "unavailable (image not pulled)"
+	}
+	if goVersion == "" {
+		goVersion = "unknown"
+	}
+	fmt.Fprintf(w, "Image:\t%s\n", image)
+	if digest != "" {
+		fmt.Fprintf(w, "Image digest:\t%s\n", digest)
+	}
+	fmt.Fprintf(w, "Go version:\t%s\n", goVersion)
+
+	fmt.Fprintf(w, "\nToolchains:\n")
+	for _, toolchain := range r.Toolchains {
+		fmt.Fprintf(w, "  %s\n", toolchain)
+	}
+	fmt.Fprintf(w, "\nCaches:\n")
+	for _, cache := range r.Caches {
+		fmt.Fprintf(w, "  %s:\t%s\t%s\n", cache.Name, cache.Path, xgo.FormatSize(cache.Size))
+	}
+	fmt.Fprintf(w, "\nEnvironment:\n")
+	for _, env := range r.Env {
+		fmt.Fprintf(w, "  %s\n", env)
+	}
+	return w.Flush()
+}
+
+// pathSize calculates the total size of a file or folder, zero if missing.
+func pathSize(path string) int64 {
+	var size int64
+	filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
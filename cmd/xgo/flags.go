@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/crazy-max/xgo/pkg/xgo"
+)
+
+// targetFlags is a repeatable command line flag holding a global value and any
+// number of per-target overrides given in the form of os/arch=value.
+type targetFlags xgo.TargetValues
+
+// String implements flag.Value, formatting the flags as they were given.
+func (f targetFlags) String() string {
+	var parts []string
+	for target, value := range f {
+		if target == "" {
+			parts = append(parts, value)
+		} else {
+			parts = append(parts, target+"="+value)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Set implements flag.Value, storing either a per-target override if the value
+// is prefixed by an os/arch pair, or the global value otherwise.
+func (f targetFlags) Set(value string) error {
+	if !strings.HasPrefix(value, "-") {
+		if idx := strings.Index(value, "="); idx > 0 && strings.Contains(value[:idx], "/") {
+			f[value[:idx]] = value[idx+1:]
+			return nil
+		}
+	}
+	f[""] = value
+	return nil
+}
+
+// listFlag is a repeatable command line flag collecting all the given values.
+type listFlag []string
+
+// String implements flag.Value, formatting the values as they were given.
+func (f *listFlag) String() string {
+	return strings.Join(*f, " ")
+}
+
+// Set implements flag.Value, appending another value.
+func (f *listFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// parsePackageRules converts package rule flags given in the form of
+// <os/arch,...>=<format,...> into package rules, all using the same compression
+// level and extra files.
+func parsePackageRules(values []string, level int, files []string) ([]xgo.PackageRule, error) {
+	var rules []xgo.PackageRule
+	for _, value := range values {
+		idx := strings.LastIndex(value, "=")
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid package rule %q, must be <os/arch,...>=<format,...>", value)
+		}
+		rule := xgo.PackageRule{Targets: strings.Split(value[:idx], ","), Level: level, Files: files}
+		for _, format := range strings.Split(value[idx+1:], ",") {
+			if format = strings.TrimSpace(format); format != "" {
+				rule.Formats = append(rule.Formats, format)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// parseGenerators converts generator flags given in the form of <args> [> output]
+// into generators, completion and man selecting the built-in generators.
+func parseGenerators(values []string) []xgo.Generator {
+	var generators []xgo.Generator
+	for _, value := range values {
+		var gen xgo.Generator
+		switch strings.TrimSpace(value) {
+		case xgo.GenerateCompletion, xgo.GenerateMan:
+			generators = append(generators, xgo.Generator{Mode: strings.TrimSpace(value)})
+			continue
+		}
+		if idx := strings.LastIndex(value, ">"); idx >= 0 {
+			value, gen.Output = value[:idx], strings.TrimSpace(value[idx+1:])
+		}
+		gen.Args = strings.Fields(value)
+		generators = append(generators, gen)
+	}
+	return generators
+}
+
+// parseRenderFiles converts rendered file flags given in the form of
+// <template>=<output> into rendered files.
+func parseRenderFiles(values []string) []xgo.RenderFile {
+	var files []xgo.RenderFile
+	for _, value := range values {
+		file := xgo.RenderFile{Template: value}
+		if idx := strings.LastIndex(value, "="); idx >= 0 {
+			file.Template, file.Output = value[:idx], value[idx+1:]
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+// parseSecrets converts secret flags given in the form of NAME=VALUE, or NAME to
+// take the value of the host environment variable, into secrets.
+func parseSecrets(values []string) (map[string]string, error) {
+	secrets := make(map[string]string)
+	for _, value := range values {
+		if idx := strings.Index(value, "="); idx >= 0 {
+			secrets[value[:idx]] = value[idx+1:]
+			continue
+		}
+		secret, ok := os.LookupEnv(value)
+		if !ok {
+			return nil, fmt.Errorf("secret %s not set in the environment", value)
+		}
+		secrets[value] = secret
+	}
+	return secrets, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+)
+
+// hostGoEnv returns the values of Go environment variables on the host, as
+// reported by the local Go toolchain (thus including those set with go env -w)
+// or taken from the environment if there is none.
+func hostGoEnv(names ...string) map[string]string {
+	env := make(map[string]string)
+	if out, err := exec.Command("go", append([]string{"env", "-json"}, names...)...).Output(); err == nil {
+		if err := json.Unmarshal(out, &env); err == nil {
+			return env
+		}
+	}
+	for _, name := range names {
+		env[name] = os.Getenv(name)
+	}
+	return env
+}
+
+// defaultGoEnv defaults the private module settings not given as flags to those
+// of the host, so private module setups work in the build containers as well.
+func defaultGoEnv() {
+	settings := map[string]*string{
+		"GOPRIVATE":  goPrivate,
+		"GONOPROXY":  goNoProxy,
+		"GONOSUMDB":  goNoSumDB,
+		"GOINSECURE": goInsecure,
+		"GOFLAGS":    goFlags,
+	}
+	var names []string
+	for name, value := range settings {
+		if *value == "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+	for name, value := range hostGoEnv(names...) {
+		if setting, ok := settings[name]; ok {
+			*setting = value
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// detectGoVersion returns the Go version a module project requires, preferring
+// its go.mod toolchain directive over the go one. Language versions without a
+// point release (e.g. go 1.20) are widened to the latest point release (1.20.x).
+func detectGoVersion(project string) string {
+	blob, err := os.ReadFile(filepath.Join(project, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	var lang, toolchain string
+	for _, line := range strings.Split(string(blob), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "go":
+			lang = fields[1]
+		case "toolchain":
+			toolchain = strings.TrimPrefix(fields[1], "go")
+		}
+	}
+	if toolchain != "" && toolchain != "default" {
+		return toolchain
+	}
+	if strings.Count(lang, ".") == 1 {
+		return lang + ".x"
+	}
+	return lang
+}
+
+// autoGoVersion selects the image tag matching the Go version of the project,
+// falling back to the latest release if none is declared or no image exists
+// for it.
+func autoGoVersion(repo string) string {
+	version := detectGoVersion(*projectPath)
+	if version == "" {
+		log.Printf("INFO: No Go version found in the project go.mod, using latest")
+		return "latest"
+	}
+	image := fmt.Sprintf("%s:%s", repo, version)
+	if runtimeCommand("image", "inspect", image).Run() != nil && runtimeCommand("manifest", "inspect", image).Run() != nil {
+		log.Printf("WARNING: No image %s found for the Go version of the project, using latest", image)
+		return "latest"
+	}
+	log.Printf("INFO: Detected Go version %s from the project go.mod", version)
+	return version
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/crazy-max/xgo/pkg/xgo"
+)
+
+// HistoryEntry is a single build recorded in the local build history.
+type HistoryEntry struct {
+	ID          int               `json:"id"`           // Sequential identifier of the build
+	Time        time.Time         `json:"time"`         // Time the build was started at
+	Duration    time.Duration     `json:"duration"`     // Wall clock time the build took
+	Project     string            `json:"project"`      // Project path that was built
+	ConfigHash  string            `json:"config_hash"`  // Hash of the build configuration and flags
+	Image       string            `json:"image"`        // Docker image the build ran in
+	ImageDigest string            `json:"image_digest"` // Content digest of the docker image
+	Targets     []string          `json:"targets"`      // Targets requested to be built
+	Success     bool              `json:"success"`      // Whether the build succeeded
+	Artifacts   map[string]string `json:"artifacts"`    // SHA256 digests of the produced artifacts
+}
+
+// historyPath returns the location of the local build history store.
+func historyPath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "xgo", "history.json")
+}
+
+// loadHistory reads all the builds recorded in the local history store.
+func loadHistory() ([]*HistoryEntry, error) {
+	blob, err := os.ReadFile(historyPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var history []*HistoryEntry
+	if err := json.Unmarshal(blob, &history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// lockHistory takes the lock file guarding the local history store against the
+// concurrent builds, breaking it if left behind by a crashed one. The returned
+// function releases it.
+func lockHistory() (func(), error) {
+	path := historyPath() + ".lock"
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	for start := time.Now(); ; time.Sleep(50 * time.Millisecond) {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > 10*time.Second {
+			os.Remove(path) // Stale, the history is only held for a moment
+			continue
+		}
+		if time.Since(start) > 30*time.Second {
+			return nil, fmt.Errorf("timed out waiting for history lock %s", path)
+		}
+	}
+}
+
+// recordHistory appends a build to the local history store, assigning it the
+// next sequential identifier. The store is replaced atomically under its lock,
+// for concurrent builds not to lose or corrupt each other's records.
+func recordHistory(entry *HistoryEntry) error {
+	unlock, err := lockHistory()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	history, err := loadHistory()
+	if err != nil {
+		return err
+	}
+	entry.ID = 1
+	if len(history) > 0 {
+		entry.ID = history[len(history)-1].ID + 1
+	}
+	history = append(history, entry)
+
+	blob, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(historyPath()), "history-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(blob); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), historyPath())
+}
+
+// newHistoryEntry assembles the history record of a finished build, hashing the
+// configuration and all the artifacts it produced.
+func newHistoryEntry(cfg xgo.Config, start time.Time, artifacts []xgo.Artifact, success bool) *HistoryEntry {
+	entry := &HistoryEntry{
+		Time:      start,
+		Duration:  time.Since(start),
+		Project:   cfg.Project.ProjectPath,
+		Image:     cfg.Image,
+		Targets:   cfg.Project.Targets,
+		Success:   success,
+		Artifacts: make(map[string]string),
+	}
+	if blob, err := json.Marshal([]interface{}{cfg.Project, cfg.Flags}); err == nil {
+		sum := sha256.Sum256(blob)
+		entry.ConfigHash = hex.EncodeToString(sum[:])
+	}
+	if cfg.Image != "" {
+		if out, err := runtimeCommand("image", "inspect", "--format", "{{.Id}}", cfg.Image).Output(); err == nil {
+			entry.ImageDigest = strings.TrimSpace(string(out))
+		}
+	}
+	for _, artifact := range artifacts {
+		if digest, err := fileDigest(artifact.Path); err == nil {
+			rel, err := filepath.Rel(cfg.Project.BinPath, artifact.Path)
+			if err != nil {
+				rel = filepath.Base(artifact.Path)
+			}
+			entry.Artifacts[filepath.ToSlash(rel)] = digest
+		}
+	}
+	return entry
+}
+
+// fileDigest calculates the hex encoded SHA256 digest of a file.
+func fileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// runHistory implements the history subcommand, listing, showing and diffing
+// the builds recorded in the local history store.
+func runHistory(args []string) error {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: xgo history [-n count] | show <id> | diff <id1> <id2>\n")
+		fs.PrintDefaults()
+	}
+	limit := fs.Int("n", 20, "Number of most recent builds to list")
+	fs.Parse(args)
+
+	if *limit < 0 {
+		return fmt.Errorf("invalid number of builds %d, must not be negative", *limit)
+	}
+	history, err := loadHistory()
+	if err != nil {
+		return fmt.Errorf("failed to load build history: %v", err)
+	}
+	switch fs.Arg(0) {
+	case "":
+		if len(history) > *limit {
+			history = history[len(history)-*limit:]
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tTIME\tDURATION\tSTATUS\tCONFIG\tTARGETS\tARTIFACTS")
+		for _, entry := range history {
+			status := "failed"
+			if entry.Success {
+				status = "ok"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%.12s\t%s\t%d\n", entry.ID, entry.Time.Format(time.RFC3339),
+				entry.Duration.Round(time.Second), status, entry.ConfigHash, strings.Join(entry.Targets, ","), len(entry.Artifacts))
+		}
+		return w.Flush()
+
+	case "show":
+		entry, err := findHistory(history, fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		blob, _ := json.MarshalIndent(entry, "", "  ")
+		fmt.Println(string(blob))
+		return nil
+
+	case "diff":
+		a, err := findHistory(history, fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		b, err := findHistory(history, fs.Arg(2))
+		if err != nil {
+			return err
+		}
+		diffHistory(os.Stdout, a, b)
+		return nil
+
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown history command %q", fs.Arg(0))
+	}
+}
+
+// findHistory looks up a recorded build by its identifier.
+func findHistory(history []*HistoryEntry, id string) (*HistoryEntry, error) {
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid build id %q", id)
+	}
+	for _, entry := range history {
+		if entry.ID == n {
+			return entry, nil
+		}
+	}
+	return nil, fmt.Errorf("build %d not found in history", n)
+}
+
+// diffHistory prints the differences between two recorded builds.
+func diffHistory(w io.Writer, a, b *HistoryEntry) {
+	field := func(name, va, vb string) {
+		if va != vb {
+			fmt.Fprintf(w, "%s:\n  - %s\n  + %s\n", name, va, vb)
+		}
+	}
+	field("project", a.Project, b.Project)
+	field("config", a.ConfigHash, b.ConfigHash)
+	field("image", a.Image, b.Image)
+	field("image digest", a.ImageDigest, b.ImageDigest)
+	field("targets", strings.Join(a.Targets, ","), strings.Join(b.Targets, ","))
+	field("success", strconv.FormatBool(a.Success), strconv.FormatBool(b.Success))
+
+	names := make(map[string]struct{})
+	for name := range a.Artifacts {
+		names[name] = struct{}{}
+	}
+	for name := range b.Artifacts {
+		names[name] = struct{}{}
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	for _, name := range sorted {
+		da, oka := a.Artifacts[name]
+		db, okb := b.Artifacts[name]
+		switch {
+		case !oka:
+			fmt.Fprintf(w, "artifact %s: added (%.12s)\n", name, db)
+		case !okb:
+			fmt.Fprintf(w, "artifact %s: removed (%.12s)\n", name, da)
+		case da != db:
+			fmt.Fprintf(w, "artifact %s: changed (%.12s -> %.12s)\n", name, da, db)
+		}
+	}
+}
@@ -0,0 +1,605 @@
+// Wrapper around the GCO cross compiler docker container.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/crazy-max/xgo/pkg/xgo"
+)
+
+var version = "dev"
+var depsCache = xgo.DefaultDepsCache
+
+// Cross compilation docker containers
+var dockerDist = "ghcr.io/crazy-max/xgo"
+
+// Command line arguments to fine tune the compilation
+var (
+	// 项目配置文件，默认为项目根目录下的 .xgo.yml 或 xgo.toml
+	configPath = flag.String("config", "", "Project config file (default: .xgo.yml, .xgo.yaml or xgo.toml in the project path)")
+	// 以JSON格式输出 env 报告
+	envJSON = flag.Bool("json", false, "Print the env report as JSON")
+	// 容器运行时，默认自动检测
+	runtimeFlag = flag.String("runtime", "", "Container runtime to build with (docker|podman), detected automatically if empty")
+	// 远程容器引擎，通过复制而非挂载传输源码和构建产物
+	remoteEngineFlag = flag.String("remote-engine", "auto", "Whether the container engine is remote, transferring sources and outputs by copy instead of bind mounts (auto|true|false)")
+	// 镜像拉取策略：总是拉取、缺失时拉取或从不拉取
+	pullPolicy = flag.String("pull", "missing", "When to pull the build image from the registry (always|missing|never)")
+	// 私有镜像仓库的登录凭据，密码从标准输入读取
+	registryUser          = flag.String("registry-user", "", "User to log in to the registry of the build image as before pulling it, instead of relying on a previous docker login")
+	registryPasswordStdin = flag.Bool("registry-password-stdin", false, "Read the password (or access token) of the registry user from the standard input")
+	// 组织的镜像白名单策略文件，拒绝使用白名单之外的构建镜像
+	imagePolicyPath = flag.String("image-policy", "", "Organization policy file allowlisting the build images (YAML or TOML), XGO_IMAGE_POLICY or "+defaultImagePolicy+" if empty")
+	policyOverride  = flag.Bool("policy-override", false, "Build in an image outside of the image policy allowlist, with a warning")
+	// 纯Go目标使用本地Go工具链构建，无需容器
+	noDocker = flag.Bool("no-docker", false, "Build pure Go targets with the local Go toolchain, only using containers for CGO targets")
+	// 仅构建单个纯Go目标时直接使用本地Go工具链，跳过构建镜像
+	fastPath = flag.Bool("fast-path", false, "Build a single requested pure Go target with the local Go toolchain, skipping the build image")
+	// 构建容器的网络，例如仅支持IPv6的主机上使用 host
+	containerNetwork = flag.String("network", "", "Network of the build container (e.g. host on IPv6-only hosts, or a custom IPv6 enabled network)")
+	// 仅打印构建命令、挂载卷、环境变量和目标，不执行构建
+	dryRun = flag.Bool("dry-run", false, "Print the container commands, mounted volumes, environment and resolved targets of the build without running anything")
+	// 按目标解析项目的包，检查看起来并非有意的构建约束，不执行构建
+	checkConstraints = flag.Bool("check-constraints", false, "Parse the packages of the project per target and report the files excluded or included by build constraints in ways that look unintentional, without building")
+	// 并行构建的目标数量
+	parallelBuilds = flag.Int("parallel", 1, "Number of targets to build concurrently, each in its own container")
+	// 失败目标的重试次数，每次使用新的容器
+	retryTargets = flag.Int("retry-targets", 0, "Number of times to retry a failed target, each time in a fresh container, before marking it failed")
+	// 构建失败时保留容器，或在相同环境中启动调试 shell
+	keepOnFailure = flag.Bool("keep-on-failure", false, "Keep failed build containers for inspection instead of removing them")
+	debugShell    = flag.Bool("debug-shell", false, "Start an interactive shell in a snapshot of a failed build container, with the same volumes and environment")
+	// 临时数据的工作目录，默认为系统临时目录，构建结束后自动清理
+	workDir  = flag.String("work-dir", "", "Folder to stage the temporary build data in (generated files, remote build inputs), the system temp folder if empty")
+	keepWork = flag.Bool("keep-work", false, "Keep the work folder of the build for inspection instead of removing it")
+	// 远程构建产物缓存，按源码、构建参数和镜像摘要复用各目标的输出
+	artifactCache = flag.String("artifact-cache", "", "Remote cache of the outputs of every target (s3://bucket/prefix or an HTTP(S) URL), reused across machines when the sources, flags and image are unchanged")
+	// Go版本，为空或 auto 时根据项目 go.mod 自动检测
+	goVersion = flag.String("go-version", "", "Go version of the build image, detected from the project go.mod if empty or auto (falling back to latest)")
+	// Go代理地址
+	goProxy = flag.String("go-proxy", "", "Go模块设置全局代理")
+	// Go校验和数据库，例如内网镜像或 off
+	goSumDB = flag.String("go-sumdb", "", "Checksum database to verify modules with (GOSUMDB), e.g. a corporate mirror or off")
+	// 不使用校验和数据库验证的模块
+	goNoSumDB = flag.String("go-nosumdb", "", "Module path patterns not to verify with the checksum database (GONOSUMDB), defaulting to the host one")
+	// 私有模块设置，默认使用主机的 go env 配置
+	goPrivate  = flag.String("go-private", "", "Module path patterns of private modules (GOPRIVATE), defaulting to the host one")
+	goNoProxy  = flag.String("go-noproxy", "", "Module path patterns not to download through the proxy (GONOPROXY), defaulting to the host one")
+	goInsecure = flag.String("go-insecure", "", "Module path patterns allowed to be fetched insecurely (GOINSECURE), defaulting to the host one")
+	goFlags    = flag.String("go-flags", "", "Default flags of the go commands within the build container (GOFLAGS), defaulting to the host ones")
+	// 转发主机的 SSH agent，通过 SSH 拉取私有模块
+	sshAgent = flag.Bool("ssh-agent", false, "Forward the host SSH agent (and known_hosts) into the build container to fetch private modules over SSH")
+	// 转发 .netrc 凭据，通过 HTTPS 拉取私有模块
+	netrc = flag.String("netrc", "", "Credentials file (.netrc) to fetch private modules over HTTPS with, auto to detect the host one ($NETRC or ~/.netrc)")
+	// 转发主机的 git 配置及凭据（只读），保留 insteadOf 重写和凭据助手
+	forwardGitConfig = flag.Bool("forward-git-config", false, "Forward the host git configuration (read-only) and the credentials its helpers hold for the private module hosts into the build container, along with the .netrc unless given")
+	// 构建前预取模块及校验和数据
+	warmModules = flag.Bool("warm", false, "Download and verify all modules (and checksum database data) in a networked container before building, allowing --network=none builds")
+	// 将构建好CGO依赖的容器提交为本地镜像，后续构建直接复用
+	warmStart = flag.Bool("warm-start", false, "Commit the build containers once their CGO dependencies are built into local images keyed by the dependency settings, reused by later builds instead of rebuilding the dependencies")
+	// git 子模块，未验证参数是否可用
+	srcPackage = flag.String("pkg", "", "git 子模块，未验证参数是否可用:Sub-package(s) to build if not root import, comma separated")
+	// 只构建/排除匹配的包
+	srcInclude = flag.String("include", "", "Package patterns to build, comma or space separated (e.g. ./cmd/...,./plugins/foo)")
+	srcExclude = flag.String("exclude", "", "Package patterns to exclude from the build, comma or space separated")
+	// 只读挂载项目源码，构建写入的文件进入临时的覆盖层
+	readOnlySource = flag.Bool("read-only-source", false, "Mount the project sources read-only, files written by the build (e.g. generated code) going to a throwaway overlay")
+	// 项目Git远程仓库
+	srcRemote = flag.String("remote", "", "项目Git远程仓库")
+	// 项目Git分支
+	srcBranch = flag.String("branch", "", "项目Git分支")
+
+	crossDeps = flag.String("deps", "", "CGO dependencies (configure/make based archive URLs, git+<url>@<tag> repositories or local folders)")
+	// 全局依赖缓存目录，默认为用户缓存目录下的 xgo/deps
+	cacheDir = flag.String("cache-dir", "", "Global CGO dependency cache folder (default: "+xgo.DefaultDepsCache+")")
+	// 项目专属的依赖缓存目录（相对于项目根目录），优先于全局缓存
+	projectCache = flag.String("project-deps-cache", "", "Project specific CGO dependency cache layer relative to the project path (e.g. .xgo-cache), consulted before and downloaded into instead of the global cache")
+	crossArgs    = flag.String("depsargs", "", "CGO dependency configure arguments")
+	// 交叉编译目标
+	targets = flag.String("targets", "*/*", "要构建的目标 os/arch 的逗号分隔列表: */* or linux/amd64,darwin/amd64")
+	// 交互式选择构建目标，记住上次的选择
+	interactive = flag.Bool("interactive", false, "Pick the targets to build from a checklist of the supported ones, preselecting the last picked targets")
+	dockerRepo  = flag.String("docker-repo", "", "使用自定义docker repo而不是官方分发")
+	dockerImage = flag.String("docker-image", "", "使用自定义docker图像而不是官方分发")
+	// 项目根目录
+	projectPath = flag.String("project-path", "", "项目根目录")
+	// 项目命令所在相对目录，为空时默认为项目根目录 例如：cmd/xxx
+	cmdPath = flag.String("cmd-path", ".", "项目命令所在相对目录，为空时默认为项目根目录 例如：cmd/xxx")
+	// Go构建命令目录
+	binPath = flag.String("bin-path", "bin", "Go构建命令目录")
+	// Go构建命令前缀
+	commandPrefix = flag.String("command-prefix", "", "Go构建命令前缀")
+	// 输出文件名模板
+	nameTemplate = flag.String("name-template", "", "Template of the output file names, e.g. {{.Name}}-{{.Version}}-{{.OS}}-{{.Arch}}{{.Ext}} (fields: Name, Version, OS, Arch, Variant, GoVersion, Tag, Commit, Ext)")
+	// 按 docker 平台目录（例如 linux/arm64/）输出 Linux 构建产物
+	platformDirs = flag.Bool("platform-dirs", false, "Write the Linux outputs into docker platform folders of the bin path (e.g. linux/amd64/, linux/arm/v7/) for multi-arch docker buildx builds")
+	// 自定义目标工具链配置文件
+	targetProfiles = flag.String("profiles", "", "JSON file of custom target toolchain profiles keyed by os/arch(-variant)")
+	// 校验生成的二进制文件是否与目标平台一致
+	verifyBinaries = flag.Bool("verify", true, "Verify that the produced binaries match their declared os/arch")
+	verifyLinkage  = flag.String("linkage", "", "Expected linkage of the produced Linux binaries (static|dynamic)")
+	// 允许动态链接的库，为空时不检查
+	allowedLibs = flag.String("allowed-libs", "", "Comma separated library name patterns the Linux/macOS binaries may dynamically link (e.g. libc.so.*,libpthread.so.*)")
+	// 使用云端密钥管理服务中的密钥对Windows二进制文件进行Authenticode签名
+	codeSignKey = flag.String("code-sign-key", "", "Cloud held key to Authenticode sign the Windows binaries with: awskms:<region>/<key>, gcpkms:<key ring>/cryptoKeys/<key> or azurekv:<vault>/<certificate>")
+	// 使用 PFX 证书和 osslsigncode 对Windows二进制文件进行Authenticode签名
+	windowsSignPFX = flag.String("windows-sign-pfx", "", "PFX certificate to Authenticode sign the Windows binaries with using osslsigncode, its password read from XGO_WINDOWS_SIGN_PASSWORD")
+	// 使用 codesign（macOS 主机）或 rcodesign（其他主机）对 macOS 二进制文件进行签名，并可提交公证
+	macSignIdentity = flag.String("macos-sign-identity", "", "Keychain identity to codesign the macOS binaries with on macOS hosts (e.g. 'Developer ID Application: Name (TEAMID)')")
+	macSignKeychain = flag.String("macos-sign-keychain", "", "Keychain holding the macOS signing identity, the default search list if empty")
+	macSignP12      = flag.String("macos-sign-p12", "", "PKCS#12 certificate to sign the macOS binaries with using rcodesign on any host, its password read from XGO_MACOS_SIGN_PASSWORD")
+	macNotarize     = flag.Bool("macos-notarize", false, "Submit the signed macOS binaries to the Apple notary service, waiting for the verdict")
+	// 根据约定式提交或模板生成发布说明，附加到发布的版本中
+	releaseNotes = flag.String("release-notes", "", "Release notes of the published releases: conventional to group the conventional commits since the previous tag, or a template file")
+	// 将每个目标的构建产物打包为归档文件
+	archiveFormat = flag.String("archive", "", "Archive the outputs of every target (tar.gz|zip|auto), auto using zip for windows and tar.gz elsewhere")
+	// 打包压缩级别
+	packageLevel = flag.Int("package-level", 0, "Compression level of the packages (e.g. 1-9 for gzip, xz and zip, 1-19 for zstd), the format's default if 0")
+	// 生成构建产物的校验和文件
+	checksums = flag.String("checksum", "", "Comma separated algorithms to write checksum files of the artifacts with into the bin path (sha1|sha256|sha512), e.g. sha256 for SHA256SUMS")
+	// 输出JSON格式的构建报告
+	reportJSON = flag.String("report-json", "", "Write a JSON report of the build (targets, outputs, sizes, durations, checksums, failures) to the given file")
+	// 记录构建历史
+	recordBuilds = flag.Bool("history", true, "Record the build in the local build history (see 'xgo history')")
+	// 运行流水线时跳过的步骤
+	skipSteps = flag.String("skip-steps", "", "Comma separated steps of the pipeline to skip (run-pipeline only), e.g. lint,publish")
+)
+
+// Command line arguments to pass to go build
+var (
+	// Go编译时打印包的名称
+	buildVerbose = flag.Bool("v", false, "Go编译时打印包的名称")
+	// 命令在执行生成时打印命令
+	buildSteps = flag.Bool("x", false, "命令在执行生成时打印命令")
+	// 启用数据竞争检测（仅在amd64上支持）
+	buildRace = flag.Bool("race", false, "启用数据竞争检测（仅在amd64上支持）")
+
+	buildTags     = flag.String("tags", "", "List of build tags to consider satisfied during the build")
+	buildLdFlags  = flag.String("build-ldflags", "", "每次go工具链接调用时传递的参数，支持模板变量，例如 -X main.version={{.Version}} -X main.commit={{.Commit}} -X main.date={{.Date}}")
+	buildMode     = flag.String("build-mode", "default", "Indicates which kind of object file to build (default|archive|exe|pie|c-archive|c-shared|auto), the C build modes producing a library and its C header per target, auto selecting pie on the Linux targets supporting it")
+	buildVCS      = flag.String("build-vcs", "", "Whether to stamp binaries with version control information (none|git|hg|svn|bzr)")
+	buildTrimPath = flag.Bool("build-trim-path", false, "从生成的可执行文件中删除所有文件系统路径")
+	// 确定性构建：裁剪路径、禁用VCS信息、清空构建ID并固定 SOURCE_DATE_EPOCH
+	reproducible = flag.Bool("reproducible", false, "Build deterministically: trimmed paths, no VCS stamping, empty build IDs and a fixed SOURCE_DATE_EPOCH, the last commit time unless given")
+	// 自动将 git 版本信息注入约定的版本变量（如 main.version）
+	autoVersion = flag.Bool("auto-version", false, "Stamp the conventional version variables of the project (main.version, main.commit, main.buildDate, <module>/internal/version.Version...) with its git metadata via -X linker flags")
+	// 构建和打包使用的 SOURCE_DATE_EPOCH，git 表示取最后一次提交的时间
+	sourceDateEpoch = flag.String("source-date-epoch", "", "SOURCE_DATE_EPOCH of the builds and packages: seconds since the Unix epoch, or git for the last commit time")
+	// 每个目标构建两次并比较校验和，报告不确定的输出
+	verifyReproducible = flag.Bool("verify-reproducible", false, "Build every target twice reproducibly and compare the checksums of the outputs, reporting any nondeterminism")
+
+	buildSynthMod = flag.Bool("synth-module", false, "Build GOPATH mode projects as modules with a temporary go.mod generated from Gopkg.lock/vendor")
+	buildArmABI   = flag.String("arm-float-abi", "", "Float ABI of the 32 bit ARM targets (soft|hard), defaulting to soft-float for arm-5/arm-6 and hard-float for arm-7")
+	buildLibc     = flag.String("libc", "", "C library of the Linux targets (glibc|musl), musl building the targets having a musl toolchain as fully static <target>-musl")
+
+	// Windows 目标的子系统，gui 程序启动时不弹出控制台窗口
+	buildSubsystem = flag.String("windows-subsystem", "", "Subsystem of the Windows targets (gui|console), gui apps not opening a console window when started")
+
+	buildCgoCFlags  = targetFlags{}
+	buildCgoLdFlags = targetFlags{}
+
+	targetBinPaths = targetFlags{}
+	depsMirrors    = listFlag{}
+	packageRules   = listFlag{}
+	packageFiles   = listFlag{}
+	archiveFiles   = listFlag{}
+	generators     = listFlag{}
+	renderFiles    = listFlag{}
+	publishSpecs   = listFlag{}
+	buildSecrets   = listFlag{}
+
+	containerDNS       = listFlag{}
+	containerDNSSearch = listFlag{}
+	containerHosts     = listFlag{}
+)
+
+func init() {
+	flag.Var(&containerDNS, "dns", "Custom DNS server of the build container, repeatable")
+	flag.Var(&containerDNSSearch, "dns-search", "Custom DNS search domain of the build container, repeatable")
+	flag.Var(&containerHosts, "add-host", "Custom host-to-IP mapping of the build container, repeatable (host:ip)")
+	flag.Var(&depsMirrors, "deps-mirror", "URL rewrite rule for CGO dependency downloads, repeatable (e.g. 'https://zlib.net/* -> https://mirror.corp/zlib/*')")
+	flag.Var(&packageRules, "package-rule", "Package formats to bundle the outputs of some targets into, repeatable in the form of <os/arch,...>=<tar.gz|tar.xz|tar.zst|zip|deb|none,...> (globs allowed, first match wins)")
+	flag.Var(&packageFiles, "package-file", "Extra file to include in the packages, repeatable glob relative to the project path (e.g. LICENSE)")
+	flag.Var(&archiveFiles, "archive-include", "Extra file to include in the archives, repeatable glob relative to the project path (e.g. LICENSE)")
+	flag.Var(&generators, "generate", "Arguments to run a built binary with to generate files to bundle into the packages, repeatable, storing the output in a file if redirected (e.g. 'gen-docs > docs/app.md'), or completion (bash, zsh and fish completions) or man (man page) for the built-in generators")
+	flag.Var(&renderFiles, "render", "Template to render from the build manifest into the bin path, repeatable in the form of <template>=<output> (e.g. install.sh.tmpl=install.sh)")
+	flag.Var(&buildSecrets, "secret", "Secret to hand to the build as a file (/run/secrets/NAME) exported as $NAME and masked in the output, repeatable in the form of NAME=VALUE or NAME to take it from the environment")
+	flag.Var(&publishSpecs, "publish", "Publisher to distribute the artifacts with once built, repeatable in the form of <name>:<destination> (github:owner/repo, gitlab:group/project, gitea:host/owner/repo, s3://bucket/prefix, registry:ghcr.io/owner/app)")
+	flag.Var(targetBinPaths, "target-bin-path", "Output folder of specific targets, repeatable in the form of os/arch=<path> (globs allowed, e.g. windows/*=installer)")
+	flag.Var(buildCgoCFlags, "cgo-cflags", "Extra CGO_CFLAGS to pass to the C compiler, repeatable with os/arch=<flags> per-target overrides")
+	flag.Var(buildCgoLdFlags, "cgo-ldflags", "Extra CGO_LDFLAGS to pass to the C linker, repeatable with os/arch=<flags> per-target overrides")
+}
+
+func main() {
+	log.SetFlags(0)
+	defer log.Println("INFO: Completed!")
+	log.Printf("INFO: Starting xgo/%s", version)
+
+	// Dispatch the requested subcommand, building if none is given
+	args, name := os.Args[1:], "build"
+	if len(args) > 0 {
+		if _, ok := commands[args[0]]; ok {
+			args, name = args[1:], args[0]
+		}
+	}
+	if err := commands[name].run(args); err != nil {
+		log.Fatalf("ERROR: %v.", err)
+	}
+}
+
+// parseFlags parses the build flags, merging in the project config file if
+// any, returning the loaded config file (empty if none was found).
+func parseFlags(args []string) *FileConfig {
+	// Retrieve the CLI flags and the execution environment
+	flag.CommandLine.Parse(args)
+
+	if *projectPath == "" {
+		*projectPath, _ = filepath.Abs("")
+	}
+	// Merge any project config file into the flags not set on the command line
+	if *configPath == "" {
+		*configPath = findConfig(*projectPath)
+	}
+	fileConfig := new(FileConfig)
+	if *configPath != "" {
+		var err error
+		if fileConfig, err = loadConfig(*configPath); err != nil {
+			log.Fatalf("ERROR: Failed to load config file %s: %v.", *configPath, err)
+		}
+		if err := fileConfig.apply(flag.CommandLine); err != nil {
+			log.Fatalf("ERROR: Failed to apply config file %s: %v.", *configPath, err)
+		}
+		log.Printf("INFO: Using config file %s", *configPath)
+	}
+	if *cacheDir != "" {
+		depsCache = *cacheDir
+	}
+	return fileConfig
+}
+
+// registryPassword reads the password of the registry user from the standard
+// input if requested, stripping the trailing newline.
+func registryPassword() string {
+	if !*registryPasswordStdin {
+		return ""
+	}
+	password, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		log.Fatalf("ERROR: Failed to read registry password: %v.", err)
+	}
+	return strings.TrimRight(string(password), "\r\n")
+}
+
+// imagePolicy loads the image policy of the organization: the given policy file,
+// the one of XGO_IMAGE_POLICY or the system wide one, nil if none.
+func imagePolicy() *xgo.ImagePolicy {
+	path := *imagePolicyPath
+	if path == "" {
+		path = os.Getenv("XGO_IMAGE_POLICY")
+	}
+	if path == "" {
+		if !fileExists(defaultImagePolicy) {
+			return nil
+		}
+		path = defaultImagePolicy
+	}
+	policy, err := loadImagePolicy(path)
+	if err != nil {
+		log.Fatalf("ERROR: Failed to load image policy %s: %v.", path, err)
+	}
+	return policy
+}
+
+// selectImage returns the image to build with, either official or custom.
+func selectImage() string {
+	if *dockerImage != "" {
+		return *dockerImage
+	}
+	repo := dockerDist
+	if *dockerRepo != "" {
+		repo = *dockerRepo
+	}
+	if *goVersion == "" || *goVersion == "auto" {
+		return fmt.Sprintf("%s:%s", repo, autoGoVersion(repo))
+	}
+	return fmt.Sprintf("%s:%s", repo, *goVersion)
+}
+
+// runBuild implements the build subcommand (and the run, env and devcontainer
+// subcommands sharing its flags), cross compiling the requested project.
+func runBuild(command string, args []string) error {
+	fileConfig := parseFlags(args)
+	defaultGoEnv()
+	cfg := buildConfig(command, fileConfig)
+
+	// Report the effective build environment without building if requested
+	if command == "env" {
+		if err := runEnv(cfg, *envJSON); err != nil {
+			log.Fatalf("ERROR: Failed to report build environment: %v.", err)
+		}
+		return nil
+	}
+	resolveBinPath(&cfg)
+
+	// Export the build environment as a devcontainer configuration if requested
+	if command == "devcontainer" {
+		if err := writeDevcontainer(cfg); err != nil {
+			log.Fatalf("ERROR: Failed to write devcontainer configuration: %v.", err)
+		}
+		return nil
+	}
+	// Execute an arbitrary command in the build environment if requested
+	if command == "run" {
+		var err error
+		if os.Getenv("XGO_IN_XGO") != "1" {
+			err = runCommand(cfg, flag.Args())
+		} else {
+			err = runContained(cfg, flag.Args())
+		}
+		if err != nil {
+			log.Fatalf("ERROR: Failed to run command: %v.", err)
+		}
+		return nil
+	}
+	return buildProject(cfg)
+}
+
+// buildConfig assembles the configuration of a build from the parsed flags and
+// the project config file, for the given subcommand.
+func buildConfig(command string, fileConfig *FileConfig) xgo.Config {
+	if *interactive {
+		picked, err := pickTargets(os.Stdin, os.Stdout)
+		if err != nil {
+			log.Fatalf("ERROR: %v.", err)
+		}
+		*targets = strings.Join(picked, ",")
+	}
+	// 组装交叉编译环境和构建选项
+	config := xgo.ConfigFlags{
+		Package:      *srcPackage,
+		Include:      *srcInclude,
+		Exclude:      *srcExclude,
+		Remote:       *srcRemote,
+		Branch:       *srcBranch,
+		Prefix:       *commandPrefix,
+		Dependencies: *crossDeps,
+		Arguments:    *crossArgs,
+		Targets:      strings.Split(*targets, ","),
+		ProjectPath:  *projectPath,
+		BinPath:      filepath.Join(*projectPath, *binPath),
+		CmdPath:      filepath.Join(*projectPath, *cmdPath),
+	}
+	if *targetProfiles != "" {
+		profiles, err := xgo.LoadProfiles(*targetProfiles)
+		if err != nil {
+			log.Fatalf("ERROR: Failed to load target profiles: %v.", err)
+		}
+		config.Profiles = profiles
+	} else if len(fileConfig.Profiles) > 0 {
+		config.Profiles = fileConfig.Profiles
+	}
+	config.Groups = fileConfig.TargetGroups
+	log.Printf("DBG: config: %+v", config)
+	flags := xgo.BuildFlags{
+		Verbose:  *buildVerbose,
+		Steps:    *buildSteps,
+		Race:     *buildRace,
+		Tags:     *buildTags,
+		LdFlags:  *buildLdFlags,
+		Mode:     *buildMode,
+		VCS:      *buildVCS,
+		TrimPath: *buildTrimPath,
+		Epoch:    *sourceDateEpoch,
+		ArmABI:   *buildArmABI,
+		Libc:     *buildLibc,
+		SynthMod: *buildSynthMod,
+
+		CgoCFlags:  xgo.TargetValues(buildCgoCFlags),
+		CgoLdFlags: xgo.TargetValues(buildCgoLdFlags),
+
+		Overrides: fileConfig.Overrides,
+		Subsystem: *buildSubsystem,
+	}
+	log.Printf("DBG: flags: %+v", flags)
+
+	if _, err := xgo.Runtime(*runtimeFlag); err != nil {
+		log.Fatalf("ERROR: %v.", err)
+	}
+	xgoInXgo := os.Getenv("XGO_IN_XGO") == "1"
+	if xgoInXgo {
+		depsCache = "/deps-cache"
+	}
+	cfg := xgo.Config{
+		Project:      config,
+		Flags:        flags,
+		Runtime:      *runtimeFlag,
+		RemoteEngine: *remoteEngineFlag,
+		Pull:         *pullPolicy,
+		Native:       *noDocker && command == "build",
+		FastPath:     *fastPath && command == "build",
+		DryRun:       *dryRun,
+		Reproducible: *reproducible,
+		AutoVersion:  *autoVersion,
+		VerifyRepro:  *verifyReproducible,
+		Constraints:  *checkConstraints,
+		Parallel:     *parallelBuilds,
+		Retries:      *retryTargets,
+		Network:      *containerNetwork,
+		DNS:          containerDNS,
+		DNSSearch:    containerDNSSearch,
+		AddHosts:     containerHosts,
+		GoProxy:      *goProxy,
+		GoSumDB:      *goSumDB,
+		GoNoSumDB:    *goNoSumDB,
+		GoPrivate:    *goPrivate,
+		GoNoProxy:    *goNoProxy,
+		GoInsecure:   *goInsecure,
+		GoFlags:      *goFlags,
+		Warm:         *warmModules,
+		WarmStart:    *warmStart,
+		SSHAgent:     *sshAgent,
+		Netrc:        *netrc,
+		GitConfig:    *forwardGitConfig,
+		DepsCache:    depsCache,
+		ProjectCache: *projectCache,
+		DepsMirrors:  depsMirrors,
+
+		Verify:         *verifyBinaries,
+		Linkage:        *verifyLinkage,
+		TargetBinPaths: targetBinPaths,
+		NameTemplate:   *nameTemplate,
+		PlatformDirs:   *platformDirs,
+		ReportJSON:     *reportJSON,
+		KeepOnFailure:  *keepOnFailure,
+		WorkDir:        *workDir,
+		KeepWork:       *keepWork,
+		ArtifactCache:  *artifactCache,
+		CodeSignKey:    *codeSignKey,
+		WindowsSignPFX: *windowsSignPFX,
+		ReleaseNotes:   *releaseNotes,
+		DebugShell:     *debugShell,
+		ReadOnlySource: *readOnlySource,
+
+		MacSignIdentity: *macSignIdentity,
+		MacSignKeychain: *macSignKeychain,
+		MacSignP12:      *macSignP12,
+		MacNotarize:     *macNotarize,
+	}
+	if len(packageRules) > 0 {
+		rules, err := parsePackageRules(packageRules, *packageLevel, packageFiles)
+		if err != nil {
+			log.Fatalf("ERROR: Failed to parse package rules: %v.", err)
+		}
+		cfg.Packages = rules
+	} else {
+		cfg.Packages = fileConfig.Packages
+	}
+	if *archiveFormat != "" {
+		rules, err := xgo.ArchiveRules(*archiveFormat, archiveFiles)
+		if err != nil {
+			log.Fatalf("ERROR: %v.", err)
+		}
+		for i := range rules {
+			rules[i].Level = *packageLevel
+		}
+		cfg.Packages = append(cfg.Packages, rules...)
+	}
+	if len(generators) > 0 {
+		cfg.Generate = parseGenerators(generators)
+	} else {
+		cfg.Generate = fileConfig.Generate
+	}
+	if len(renderFiles) > 0 {
+		cfg.Render = parseRenderFiles(renderFiles)
+	} else {
+		cfg.Render = fileConfig.Render
+	}
+	cfg.Variants = fileConfig.Variants
+	cfg.SourceIgnore = fileConfig.SourceIgnore
+	cfg.WindowsResources = fileConfig.WindowsRes
+	cfg.Filters = fileConfig.Filters
+	if len(publishSpecs) > 0 {
+		cfg.Publish = publishSpecs
+	} else {
+		cfg.Publish = fileConfig.Publish
+	}
+	if len(buildSecrets) > 0 {
+		secrets, err := parseSecrets(buildSecrets)
+		if err != nil {
+			log.Fatalf("ERROR: Failed to parse secrets: %v.", err)
+		}
+		cfg.Secrets = secrets
+	}
+	if *checksums != "" {
+		cfg.Checksums = strings.Split(*checksums, ",")
+	}
+	if *allowedLibs != "" {
+		cfg.AllowedLibs = strings.Split(*allowedLibs, ",")
+	}
+	// Only use docker images if we're not already inside out own image
+	if !xgoInXgo {
+		cfg.Image = selectImage()
+		cfg.RegistryUser, cfg.RegistryPassword = *registryUser, registryPassword()
+		cfg.ImagePolicy, cfg.PolicyOverride = imagePolicy(), *policyOverride
+	}
+	return cfg
+}
+
+// resolveBinPath makes the bin path of a build absolute.
+func resolveBinPath(cfg *xgo.Config) {
+	if cfg.Project.BinPath != "" {
+		var err error
+		cfg.Project.BinPath, err = filepath.Abs(*binPath)
+		if err != nil {
+			log.Fatalf("ERROR: Failed to resolve destination path (%s): %v.", *binPath, err)
+		}
+	}
+}
+
+// buildProject cross compiles a project, recording the build in the history.
+func buildProject(cfg xgo.Config) error {
+	// 在容器或当前系统中执行交叉编译
+	start := time.Now()
+	artifacts, err := xgo.Build(context.Background(), cfg)
+	if *recordBuilds && !*dryRun {
+		if err := recordHistory(newHistoryEntry(cfg, start, artifacts, err == nil)); err != nil {
+			log.Printf("WARNING: Failed to record build history: %v", err)
+		}
+	}
+	return err
+}
+
+// Checks whether a docker (or podman) installation can be found and is functional.
+// 检查是否可以找到docker安装并且功能正常。
+func checkDocker() error {
+	log.Printf("INFO: Checking %s installation...", containerRuntime())
+	if err := run(runtimeCommand("version")); err != nil {
+		return err
+	}
+	fmt.Println()
+	return nil
+}
+
+// containerRuntime returns the container engine selected by the flags, detecting
+// an installed one if none is requested.
+func containerRuntime() string {
+	runtime, err := xgo.Runtime(*runtimeFlag)
+	if err != nil {
+		return *runtimeFlag
+	}
+	return runtime
+}
+
+// runtimeCommand creates a command invoking the container engine CLI.
+func runtimeCommand(args ...string) *exec.Cmd {
+	return exec.Command(containerRuntime(), args...)
+}
+
+// logRuntimeCommand logs a container engine invocation about to be executed.
+func logRuntimeCommand(args []string) {
+	log.Printf("INFO: %s %s", strings.Title(containerRuntime()), strings.Join(args, " "))
+}
+
+// Executes a command synchronously, redirecting its output to stdout.
+func run(cmd *exec.Cmd) error {
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
+
+// fileExists checks if given file exists
+func fileExists(file string) bool {
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/crazy-max/xgo/pkg/xgo"
+)
+
+// pickerPath returns the location of the targets remembered by the picker.
+func pickerPath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "xgo", "targets.json")
+}
+
+// pickTargets presents a checkbox list of the supported targets on the terminal,
+// preselecting the ones picked the last time, and returns the selection.
+func pickTargets(in io.Reader, out io.Writer) ([]string, error) {
+	if f, ok := in.(*os.File); ok {
+		if info, err := f.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+			return nil, errors.New("interactive target selection requires a terminal")
+		}
+	}
+	selected := make(map[string]bool)
+	if blob, err := os.ReadFile(pickerPath()); err == nil {
+		var remembered []string
+		if err := json.Unmarshal(blob, &remembered); err == nil {
+			for _, target := range remembered {
+				selected[target] = true
+			}
+		}
+	}
+	reader := bufio.NewReader(in)
+	for {
+		fmt.Fprintln(out, "Select the targets to build:")
+		for i, target := range xgo.Targets {
+			mark := " "
+			if selected[target] {
+				mark = "x"
+			}
+			fmt.Fprintf(out, "  %2d [%s] %s\n", i+1, mark, target)
+		}
+		fmt.Fprint(out, "Toggle numbers or ranges (e.g. 1 3-5), a for all, n for none, enter to build: ")
+
+		line, err := reader.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return nil, fmt.Errorf("failed to read target selection: %v", err)
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			var targets []string
+			for _, target := range xgo.Targets {
+				if selected[target] {
+					targets = append(targets, target)
+				}
+			}
+			if len(targets) == 0 {
+				fmt.Fprintln(out, "No targets selected.")
+				continue
+			}
+			if blob, err := json.Marshal(targets); err == nil {
+				os.MkdirAll(filepath.Dir(pickerPath()), 0755)
+				os.WriteFile(pickerPath(), blob, 0644)
+			}
+			return targets, nil
+		}
+		for _, field := range strings.FieldsFunc(line, func(r rune) bool { return r == ' ' || r == ',' }) {
+			switch field {
+			case "a":
+				for _, target := range xgo.Targets {
+					selected[target] = true
+				}
+				continue
+			case "n":
+				selected = make(map[string]bool)
+				continue
+			}
+			first, last, err := parseRange(field, len(xgo.Targets))
+			if err != nil {
+				fmt.Fprintf(out, "Invalid selection %q: %v\n", field, err)
+				continue
+			}
+			for i := first; i <= last; i++ {
+				selected[xgo.Targets[i-1]] = !selected[xgo.Targets[i-1]]
+			}
+		}
+	}
+}
+
+// parseRange parses a single number or an inclusive range of numbers (e.g. 3-5)
+// between 1 and max.
+func parseRange(field string, max int) (int, int, error) {
+	bounds := strings.SplitN(field, "-", 2)
+	first, err := strconv.Atoi(bounds[0])
+	if err != nil {
+		return 0, 0, errors.New("not a number")
+	}
+	last := first
+	if len(bounds) == 2 {
+		if last, err = strconv.Atoi(bounds[1]); err != nil {
+			return 0, 0, errors.New("not a range")
+		}
+	}
+	if first < 1 || last > max || first > last {
+		return 0, 0, fmt.Errorf("must be between 1 and %d", max)
+	}
+	return first, last, nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/crazy-max/xgo/pkg/xgo"
+)
+
+// PipelineStep is a step of a named pipeline of the config file, either one of
+// the built-in stages of an xgo build or a custom command.
+type PipelineStep struct {
+	Name      string `yaml:"name" toml:"name"`           // Step name, build, package, sign and publish being built in
+	Run       string `yaml:"run" toml:"run"`             // Shell command of a custom step, run from the project path
+	Container bool   `yaml:"container" toml:"container"` // Run the command in the build environment instead of the host
+	Key       string `yaml:"key" toml:"key"`             // Cosign key of the sign step, keyless signing if empty
+	Enabled   *bool  `yaml:"enabled" toml:"enabled"`     // Whether the step runs, true if unset
+}
+
+// pipelineStages are the built-in pipeline steps, in the order of the build.
+var pipelineStages = []string{"build", "package", "sign", "publish"}
+
+// pipelinePlan is a pipeline mapped onto a single xgo build, the custom steps
+// running before it, after it or within it as hooks of its stages.
+type pipelinePlan struct {
+	stages map[string]*PipelineStep  // Enabled built-in steps, keyed by name
+	before []PipelineStep            // Custom steps run before the build
+	hooks  map[string][]PipelineStep // Custom steps run once a stage of the build is done
+	after  []PipelineStep            // Custom steps run once the build is done
+}
+
+// planPipeline checks the enabled steps of a pipeline, slotting the custom steps
+// around the built-in ones. Built-in steps run in a single build and thus keep
+// their order, custom steps between sign and publish being impossible as both
+// run as publishers.
+func planPipeline(steps []PipelineStep) (*pipelinePlan, error) {
+	plan := &pipelinePlan{stages: make(map[string]*PipelineStep), hooks: make(map[string][]PipelineStep)}
+
+	// Group the custom steps by the last built-in step preceding them
+	last, slots := -1, make(map[int][]PipelineStep)
+	for i, step := range steps {
+		if step.Name == "" {
+			return nil, fmt.Errorf("step %d has no name", i+1)
+		}
+		stage := stageIndex(step.Name)
+		switch {
+		case stage < 0 && step.Run == "":
+			return nil, fmt.Errorf("step %s has no command to run", step.Name)
+		case stage < 0:
+			slots[last] = append(slots[last], step)
+		case step.Run != "":
+			return nil, fmt.Errorf("built-in step %s can't run a command", step.Name)
+		case plan.stages[step.Name] != nil:
+			return nil, fmt.Errorf("step %s listed twice", step.Name)
+		case stage <= last:
+			return nil, fmt.Errorf("step %s must come before %s", step.Name, pipelineStages[last])
+		default:
+			plan.stages[step.Name], last = &steps[i], stage
+		}
+	}
+	for _, name := range pipelineStages[1:] {
+		if plan.stages[name] != nil && plan.stages["build"] == nil {
+			return nil, fmt.Errorf("step %s requires the build step", name)
+		}
+	}
+	for slot, custom := range slots {
+		switch {
+		case slot == -1:
+			plan.before = custom
+		case slot == last:
+			plan.after = custom
+		case pipelineStages[slot] == "sign":
+			return nil, fmt.Errorf("step %s can't run between sign and publish", custom[0].Name)
+		default:
+			plan.hooks[pipelineStages[slot]] = custom
+		}
+	}
+	return plan, nil
+}
+
+// stageIndex returns the position of a built-in step in the build, -1 if the
+// step is a custom one.
+func stageIndex(name string) int {
+	for i, stage := range pipelineStages {
+		if stage == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// runPipeline implements the run-pipeline subcommand, running a named pipeline
+// of the config file with the build configured by the flags and the file.
+func runPipeline(args []string) error {
+	// The pipeline name may be given before or after the build flags
+	var name string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	fileConfig := parseFlags(args)
+	if name == "" && flag.NArg() > 0 {
+		name = flag.Arg(0)
+	}
+	if name == "" {
+		return errors.New("no pipeline specified, usage: xgo run-pipeline [flags] <name>")
+	}
+	steps, ok := fileConfig.Pipelines[name]
+	if !ok && len(fileConfig.Pipelines) == 0 {
+		return fmt.Errorf("unknown pipeline %s, no pipelines defined in the config file", name)
+	}
+	if !ok {
+		names := make([]string, 0, len(fileConfig.Pipelines))
+		for name := range fileConfig.Pipelines {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown pipeline %s, the config file defines: %s", name, strings.Join(names, ", "))
+	}
+	// Drop the steps disabled by the config file or the command line
+	skipped := make(map[string]bool)
+	for _, name := range strings.Split(*skipSteps, ",") {
+		skipped[strings.TrimSpace(name)] = true
+	}
+	var enabled []PipelineStep
+	for _, step := range steps {
+		if (step.Enabled == nil || *step.Enabled) && !skipped[step.Name] {
+			enabled = append(enabled, step)
+		}
+	}
+	plan, err := planPipeline(enabled)
+	if err != nil {
+		return fmt.Errorf("invalid pipeline %s: %v", name, err)
+	}
+	defaultGoEnv()
+	cfg := buildConfig("build", fileConfig)
+	resolveBinPath(&cfg)
+
+	// Dry runs only list the steps, running the build as a dry run
+	if *dryRun {
+		for _, step := range enabled {
+			if step.Run != "" {
+				log.Printf("INFO: Pipeline %s step %s: %s", name, step.Name, strings.TrimSpace(step.Run))
+			} else {
+				log.Printf("INFO: Pipeline %s step %s", name, step.Name)
+			}
+		}
+		if plan.stages["build"] == nil {
+			return nil
+		}
+		return buildProject(pipelineConfig(cfg, plan, name))
+	}
+	for _, step := range plan.before {
+		if err := runStep(cfg, name, step); err != nil {
+			return err
+		}
+	}
+	if plan.stages["build"] != nil {
+		if err := buildProject(pipelineConfig(cfg, plan, name)); err != nil {
+			return err
+		}
+	}
+	for _, step := range plan.after {
+		if err := runStep(cfg, name, step); err != nil {
+			return err
+		}
+	}
+	log.Printf("INFO: Pipeline %s succeeded", name)
+	return nil
+}
+
+// pipelineConfig narrows the build down to the built-in steps of the pipeline,
+// hooking the custom steps into its stages.
+func pipelineConfig(cfg xgo.Config, plan *pipelinePlan, name string) xgo.Config {
+	if plan.stages["package"] == nil {
+		cfg.Packages = nil
+	}
+	if plan.stages["publish"] == nil {
+		cfg.Publish = nil
+	}
+	if sign := plan.stages["sign"]; sign != nil {
+		key := sign.Key
+		if key == "" {
+			key = "keyless"
+		}
+		cfg.Publish = append([]string{"rekor:" + key}, cfg.Publish...)
+	}
+	cfg.Hooks = make(map[string]xgo.Hook)
+	for stage, steps := range plan.hooks {
+		steps := steps
+		cfg.Hooks[stage] = func(ctx context.Context, artifacts []xgo.Artifact) error {
+			for _, step := range steps {
+				if err := runStep(cfg, name, step); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	return cfg
+}
+
+// runStep runs the command of a custom pipeline step, on the host from the
+// project path or in the build environment if requested.
+func runStep(cfg xgo.Config, pipeline string, step PipelineStep) error {
+	log.Printf("INFO: Running pipeline %s step %s", pipeline, step.Name)
+
+	var err error
+	switch {
+	case step.Container && os.Getenv("XGO_IN_XGO") != "1":
+		err = runCommand(cfg, []string{"sh", "-c", step.Run})
+	case step.Container:
+		err = runContained(cfg, []string{"sh", "-c", step.Run})
+	default:
+		cmd := exec.Command("sh", "-c", step.Run)
+		if runtime.GOOS == "windows" {
+			cmd = exec.Command("cmd", "/C", step.Run)
+		}
+		cmd.Dir = cfg.Project.ProjectPath
+		cmd.Env = append(os.Environ(), "XGO_PIPELINE="+pipeline, "XGO_STEP="+step.Name, "XGO_BIN_PATH="+cfg.Project.BinPath)
+		err = run(cmd)
+	}
+	if err != nil {
+		return fmt.Errorf("pipeline %s step %s failed: %v", pipeline, step.Name, err)
+	}
+	return nil
+}
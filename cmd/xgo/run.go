@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+
+	"github.com/crazy-max/xgo/pkg/xgo"
+)
+
+// runCommand executes an arbitrary command inside the build container, set up
+// with the same mounts and environment as for cross compiling the project. If
+// a single target is requested, its Go platform is also exported.
+func runCommand(cfg xgo.Config, command []string) error {
+	if len(command) == 0 {
+		return errors.New("no command specified, usage: xgo run [flags] -- <command>")
+	}
+	args, err := xgo.ContainerArgs(cfg)
+	if err != nil {
+		return err
+	}
+	for _, env := range xgo.TargetEnv(cfg.Project.Targets) {
+		args = append(args, "-e", env)
+	}
+	if stat, err := os.Stdin.Stat(); err == nil && stat.Mode()&os.ModeCharDevice != 0 {
+		args = append(args, "-it")
+	} else {
+		args = append(args, "-i")
+	}
+	args = append(args, "--entrypoint", command[0], cfg.Image)
+	args = append(args, command[1:]...)
+
+	logRuntimeCommand(args)
+	cmd := runtimeCommand(args...)
+	cmd.Stdin = os.Stdin
+	return run(cmd)
+}
+
+// runContained executes an arbitrary command within the current system with the
+// build environment set, meant to be used from within an xgo image.
+func runContained(cfg xgo.Config, command []string) error {
+	if len(command) == 0 {
+		return errors.New("no command specified, usage: xgo run [flags] -- <command>")
+	}
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Env = append(os.Environ(), xgo.BuildEnv(cfg)...)
+	cmd.Env = append(cmd.Env, xgo.TargetEnv(cfg.Project.Targets)...)
+	cmd.Stdin = os.Stdin
+	return run(cmd)
+}
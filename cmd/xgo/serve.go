@@ -0,0 +1,512 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed web
+var webAssets embed.FS
+
+// daemonBuild is a single build job queued on the daemon.
+type daemonBuild struct {
+	ID       int       `json:"id"`       // Sequential identifier of the build
+	Args     []string  `json:"args"`     // Command line arguments of the build
+	Project  string    `json:"project"`  // Project the build is limited by, empty for the daemon's working folder
+	Priority int       `json:"priority"` // Scheduling priority, higher priority builds running first
+	Status   string    `json:"status"`   // Build status (queued, running, succeeded, failed)
+	Created  time.Time `json:"created"`  // Time the build was queued at
+	Started  time.Time `json:"started"`  // Time the build was started at
+	Finished time.Time `json:"finished"` // Time the build finished at
+	Targets  []string  `json:"targets"`  // Targets compiled so far, in order
+	Outputs  []string  `json:"outputs"`  // Artifacts produced by the build
+
+	dir    string        // Folder to collect the artifacts into
+	log    bytes.Buffer  // Combined output of the build
+	notify chan struct{} // Closed and replaced whenever the build changes
+}
+
+// changed wakes up the event streams following the build, the daemon lock being
+// held by the caller.
+func (b *daemonBuild) changed() {
+	close(b.notify)
+	b.notify = make(chan struct{})
+}
+
+// finished reports whether the build is over, successfully or not.
+func (b *daemonBuild) finished() bool {
+	return b.Status == "succeeded" || b.Status == "failed"
+}
+
+// daemon runs builds submitted over HTTP, exposing their status, logs and
+// artifacts via a JSON API and an embedded web dashboard. The queued builds are
+// started by priority, then in submission order, as long as the concurrency
+// limits of the daemon and of their project allow.
+type daemon struct {
+	dir        string         // Folder holding the artifacts of all the builds
+	root       string         // Folder the local projects of the builds must be within
+	token      string         // Token the API clients authenticate with, empty if authenticated by certificate
+	maxBuilds  int            // Maximum number of builds running concurrently
+	maxProject int            // Maximum number of builds of a single project running concurrently, unlimited if zero
+	builds     []*daemonBuild // Builds submitted to the daemon
+	queue      []*daemonBuild // Builds waiting to be run, in submission order
+	running    map[string]int // Number of running builds, keyed by project
+	lock       sync.RWMutex   // Protects the builds, their logs and the queue
+}
+
+// runServe implements the serve subcommand, running xgo as a shared daemon.
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	listen := fs.String("listen", "127.0.0.1:8080", "Address to serve the API and dashboard on")
+	dir := fs.String("dir", filepath.Join(os.TempDir(), "xgo-serve"), "Folder to store the build artifacts in")
+	maxBuilds := fs.Int("max-builds", 1, "Maximum number of builds to run concurrently")
+	maxProject := fs.Int("max-project-builds", 0, "Maximum number of builds of a single project to run concurrently, unlimited (up to -max-builds) if 0")
+	root := fs.String("project-root", "", "Folder the -project-path of the builds must be within (default the working folder)")
+	token := fs.String("token", "", "Token the API clients must authenticate with (default $XGO_SERVE_TOKEN, else a random one)")
+	tlsCert := fs.String("tls-cert", "", "Certificate to serve the API and dashboard over TLS with")
+	tlsKey := fs.String("tls-key", "", "Private key of the TLS certificate")
+	clientCA := fs.String("tls-client-ca", "", "CA the API clients must present a certificate of (requires -tls-cert)")
+	fs.Parse(args)
+
+	if *maxBuilds < 1 {
+		return fmt.Errorf("invalid maximum number of builds %d, must be at least 1", *maxBuilds)
+	}
+	if *maxProject < 0 {
+		return fmt.Errorf("invalid maximum number of builds per project %d, must not be negative", *maxProject)
+	}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		return fmt.Errorf("-tls-cert and -tls-key must be given together")
+	}
+	if *clientCA != "" && *tlsCert == "" {
+		return fmt.Errorf("-tls-client-ca requires -tls-cert and -tls-key")
+	}
+	if *root == "" {
+		*root, _ = os.Getwd()
+	}
+	d := &daemon{
+		dir:        *dir,
+		root:       *root,
+		maxBuilds:  *maxBuilds,
+		maxProject: *maxProject,
+		running:    make(map[string]int),
+	}
+	var err error
+	if d.token, err = daemonToken(*token, *clientCA); err != nil {
+		return err
+	}
+	if *token == "" && os.Getenv("XGO_SERVE_TOKEN") == "" && d.token != "" {
+		log.Printf("INFO: Generated API token %s, set -token to choose one", d.token)
+	}
+
+	mux := http.NewServeMux()
+	assets, _ := iofs.Sub(webAssets, "web")
+	mux.Handle("/", http.FileServer(http.FS(assets)))
+	mux.HandleFunc("/api/builds", d.authenticate(d.handleBuilds))
+	mux.HandleFunc("/api/builds/", d.authenticate(d.handleBuild))
+
+	server := &http.Server{Addr: *listen, Handler: mux}
+	if *tlsCert == "" {
+		log.Printf("INFO: Serving xgo daemon on http://%s", *listen)
+		return server.ListenAndServe()
+	}
+	if *clientCA != "" {
+		if server.TLSConfig, err = clientTLS(*clientCA); err != nil {
+			return err
+		}
+	}
+	log.Printf("INFO: Serving xgo daemon on https://%s", *listen)
+	return server.ListenAndServeTLS(*tlsCert, *tlsKey)
+}
+
+// schedule starts the queued builds the concurrency limits allow, the highest
+// priority ones first, the daemon lock being held by the caller. Builds of a
+// project at its limit don't hold back the builds of other projects.
+func (d *daemon) schedule() {
+	sort.SliceStable(d.queue, func(i, j int) bool {
+		return d.queue[i].Priority > d.queue[j].Priority
+	})
+	total := 0
+	for _, count := range d.running {
+		total += count
+	}
+	pending := d.queue[:0]
+	for _, build := range d.queue {
+		if total >= d.maxBuilds || (d.maxProject > 0 && d.running[build.Project] >= d.maxProject) {
+			pending = append(pending, build)
+			continue
+		}
+		total++
+		d.running[build.Project]++
+
+		build.Status, build.Started = "running", time.Now()
+		build.changed()
+		go d.run(build)
+	}
+	d.queue = pending
+}
+
+// run executes a single build as a child xgo process, collecting its output and
+// tracking the targets being compiled, then starts the builds waiting for it.
+func (d *daemon) run(build *daemonBuild) {
+	self, err := os.Executable()
+	if err == nil {
+		err = os.MkdirAll(build.dir, 0755)
+	}
+	if err == nil {
+		cmd := exec.Command(self, append(build.Args, "-bin-path", build.dir)...)
+		cmd.Stdout = &daemonLog{d: d, build: build}
+		cmd.Stderr = cmd.Stdout
+		err = cmd.Run()
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	defer d.schedule()
+	defer build.changed()
+
+	if d.running[build.Project]--; d.running[build.Project] == 0 {
+		delete(d.running, build.Project)
+	}
+	build.Status, build.Finished = "succeeded", time.Now()
+	if err != nil {
+		build.Status = "failed"
+		fmt.Fprintf(&build.log, "ERROR: %v\n", err)
+	}
+	filepath.Walk(build.dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(build.dir, path)
+			build.Outputs = append(build.Outputs, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+}
+
+// daemonLog is the output sink of a running build, detecting the start of each
+// target's compilation in the build script's output.
+type daemonLog struct {
+	d       *daemon
+	build   *daemonBuild
+	partial []byte // Trailing incomplete line of the previous write
+}
+
+// Write implements io.Writer, appending to the build log.
+func (l *daemonLog) Write(p []byte) (int, error) {
+	l.d.lock.Lock()
+	defer l.d.lock.Unlock()
+
+	l.partial = append(l.partial, p...)
+	for {
+		idx := bytes.IndexByte(l.partial, '\n')
+		if idx < 0 {
+			break
+		}
+		if target, ok := compilingTarget(string(l.partial[:idx])); ok {
+			l.build.Targets = append(l.build.Targets, target)
+		}
+		l.partial = l.partial[idx+1:]
+	}
+	l.build.changed()
+	return l.build.log.Write(p)
+}
+
+// compilingTarget detects the build script's marker of starting to compile a
+// target, e.g. "Compiling for linux/arm-7...", returning the target.
+func compilingTarget(line string) (string, bool) {
+	_, line = lineTarget(line)
+	if !strings.HasPrefix(line, "Compiling for ") {
+		return "", false
+	}
+	fields := strings.Fields(strings.TrimSuffix(line, "..."))
+	if len(fields) < 3 {
+		return "", false
+	}
+	return fields[2], true
+}
+
+// handleBuilds lists all the builds or queues a new one.
+func (d *daemon) handleBuilds(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		d.lock.RLock()
+		blob, _ := json.Marshal(d.builds)
+		d.lock.RUnlock()
+		writeJSON(w, http.StatusOK, blob)
+
+	case http.MethodPost:
+		var req struct {
+			Args     []string `json:"args"`
+			Project  string   `json:"project"`
+			Priority int      `json:"priority"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := checkDaemonArgs(req.Args, d.root); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if req.Project == "" {
+			req.Project = argsProject(req.Args)
+		}
+		d.lock.Lock()
+		build := &daemonBuild{
+			ID:       len(d.builds) + 1,
+			Args:     req.Args,
+			Project:  req.Project,
+			Priority: req.Priority,
+			Status:   "queued",
+			Created:  time.Now(),
+			notify:   make(chan struct{}),
+		}
+		build.dir = filepath.Join(d.dir, strconv.Itoa(build.ID))
+		d.builds = append(d.builds, build)
+		d.queue = append(d.queue, build)
+		d.schedule()
+		blob, _ := json.Marshal(build)
+		d.lock.Unlock()
+
+		writeJSON(w, http.StatusCreated, blob)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// argsProject returns the project of a build from its arguments: its remote
+// repository or project path, empty if building the daemon's working folder.
+func argsProject(args []string) string {
+	var project string
+	for i, arg := range args {
+		name := strings.TrimLeft(arg, "-")
+		if name == arg {
+			continue
+		}
+		value, inline := "", false
+		if idx := strings.Index(name, "="); idx >= 0 {
+			name, value, inline = name[:idx], name[idx+1:], true
+		}
+		if name != "remote" && name != "project-path" {
+			continue
+		}
+		if !inline && i+1 < len(args) {
+			value = args[i+1]
+		}
+		if name == "remote" || project == "" {
+			project = value
+		}
+	}
+	return project
+}
+
+// handleBuild serves the details, log, events or artifacts of a single build:
+//
+//	/api/builds/<id>
+//	/api/builds/<id>/log[?target=<os/arch>]
+//	/api/builds/<id>/events[?target=<os/arch>]
+//	/api/builds/<id>/artifacts/<name>
+func (d *daemon) handleBuild(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/api/builds/"), "/", 3)
+
+	id, err := strconv.Atoi(parts[0])
+	d.lock.RLock()
+	if err != nil || id < 1 || id > len(d.builds) {
+		d.lock.RUnlock()
+		http.NotFound(w, r)
+		return
+	}
+	build := d.builds[id-1]
+
+	// Event streams wait for the build without holding the lock
+	if len(parts) == 2 && parts[1] == "events" {
+		d.lock.RUnlock()
+		d.streamEvents(w, r, build)
+		return
+	}
+
+	// Copy what is served while holding the lock, writing it out once released
+	// for slow clients not to hold back the builds
+	switch {
+	case len(parts) == 1:
+		blob, _ := json.Marshal(build)
+		d.lock.RUnlock()
+		writeJSON(w, http.StatusOK, blob)
+
+	case parts[1] == "log":
+		blob := append([]byte(nil), targetLog(build.log.Bytes(), r.URL.Query().Get("target"))...)
+		d.lock.RUnlock()
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(blob)
+
+	case parts[1] == "artifacts" && len(parts) == 3:
+		var path string
+		for _, output := range build.Outputs {
+			if output == parts[2] {
+				path = filepath.Join(build.dir, filepath.FromSlash(output))
+				break
+			}
+		}
+		d.lock.RUnlock()
+		if path == "" {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFile(w, r, path)
+
+	default:
+		d.lock.RUnlock()
+		http.NotFound(w, r)
+	}
+}
+
+// daemonLogLine is the payload of the log events of a build stream.
+type daemonLogLine struct {
+	Target string `json:"target,omitempty"` // Target the line belongs to, empty if none
+	Line   string `json:"line"`             // Line of the build log, without its newline
+}
+
+// streamEvents follows a build as server-sent events, replaying it from its
+// start: a log event per line of the build log (of a single target if given), a
+// target event whenever a target starts compiling and a status event whenever
+// the build changes state, ending with a done event once the build finished.
+func (d *daemon) streamEvents(w http.ResponseWriter, r *http.Request, build *daemonBuild) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Keep reverse proxies from buffering the stream
+
+	filter := r.URL.Query().Get("target")
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+
+	var (
+		offset  int    // Offset of the first log line not sent yet
+		status  string // Last status sent
+		current string // Target the unprefixed log lines belong to
+	)
+	for {
+		d.lock.RLock()
+		blob := append([]byte(nil), build.log.Bytes()[offset:]...)
+		finished, notify := build.finished(), build.notify
+		snapshot, _ := json.Marshal(build)
+		changed := build.Status != status
+		status = build.Status
+		d.lock.RUnlock()
+
+		// Hold back the trailing incomplete line until the build is over
+		if !finished {
+			blob = blob[:bytes.LastIndexByte(blob, '\n')+1]
+		}
+		offset += len(blob)
+		for _, line := range strings.SplitAfter(string(blob), "\n") {
+			if line = strings.TrimRight(line, "\r\n"); line == "" {
+				continue
+			}
+			var owner string
+			owner, current = logTarget(current, line)
+			if compiling, ok := compilingTarget(line); ok && (filter == "" || compiling == filter) {
+				writeEvent(w, "target", map[string]string{"target": compiling})
+			}
+			if filter == "" || owner == filter {
+				writeEvent(w, "log", daemonLogLine{Target: owner, Line: line})
+			}
+		}
+		if changed {
+			writeEvent(w, "status", json.RawMessage(snapshot))
+		}
+		if finished {
+			writeEvent(w, "done", json.RawMessage(snapshot))
+			flusher.Flush()
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-notify:
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeEvent writes a server-sent event with a JSON payload.
+func writeEvent(w io.Writer, event string, v interface{}) {
+	blob, _ := json.Marshal(v)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, blob)
+}
+
+// targetLog extracts the section of a build log belonging to a single target,
+// or returns the entire log if no target is requested.
+func targetLog(blob []byte, target string) []byte {
+	if target == "" {
+		return blob
+	}
+	var (
+		out     bytes.Buffer
+		current string
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(blob))
+	for scanner.Scan() {
+		line := scanner.Text()
+		var owner string
+		if owner, current = logTarget(current, line); owner == target {
+			out.WriteString(line + "\n")
+		}
+	}
+	return out.Bytes()
+}
+
+// logTarget attributes a line of a build log to a target: the one of its prefix
+// for parallel builds, else the one being compiled, which the line updates if it
+// starts compiling another target.
+func logTarget(current string, line string) (owner string, next string) {
+	if compiling, ok := compilingTarget(line); ok {
+		current = compiling
+	}
+	if prefix, _ := lineTarget(line); prefix != "" {
+		return prefix, current
+	}
+	return current, current
+}
+
+// lineTarget splits the target prefix off an output line of a parallel build,
+// e.g. "[linux/arm64] go build ...", returning an empty target if missing.
+func lineTarget(line string) (string, string) {
+	if !strings.HasPrefix(line, "[") {
+		return "", line
+	}
+	end := strings.Index(line, "] ")
+	if end < 0 || !strings.Contains(line[:end], "/") {
+		return "", line
+	}
+	return line[1:end], line[end+2:]
+}
+
+// writeJSON writes the JSON response of an API call with the given status code,
+// serialized beforehand so as not to hold the daemon lock while writing.
+func writeJSON(w http.ResponseWriter, status int, blob []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(blob, '\n'))
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// daemonFlags are the build flags clients of the daemon may pass, all others
+// (e.g. -docker-image or -bin-path) choosing what runs on the build host or
+// where it writes being refused.
+var daemonFlags = []string{
+	"remote", "branch", "project-path", "cmd-path", "pkg", "targets", "go-version", "deps",
+	"depsargs", "tags", "build-ldflags", "build-mode", "build-vcs", "build-trim-path",
+	"reproducible", "auto-version", "source-date-epoch", "cgo-cflags", "cgo-ldflags",
+	"arm-float-abi", "libc", "windows-subsystem", "race", "v", "x", "parallel",
+	"retry-targets", "verify", "linkage", "name-template", "platform-dirs", "archive",
+	"checksum", "package-level",
+}
+
+// stubFlag is a flag value discarding what it is set to, used to parse the build
+// arguments of the daemon clients with the same syntax as the build flags.
+type stubFlag struct {
+	values *[]string // Values the flag was set to
+	bool   bool      // Whether the flag is a boolean one
+}
+
+func (f stubFlag) String() string     { return "" }
+func (f stubFlag) IsBoolFlag() bool   { return f.bool }
+func (f stubFlag) Set(v string) error { *f.values = append(*f.values, v); return nil }
+
+// checkDaemonArgs validates the build arguments submitted to the daemon: build
+// flags only, no subcommand nor positional argument, restricted to the allowed
+// flags, with local project paths within the project root and remote (URL or
+// git) dependencies only.
+func checkDaemonArgs(args []string, root string) error {
+	fs := flag.NewFlagSet("build", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	values := make(map[string]*[]string)
+	for _, name := range daemonFlags {
+		f := flag.Lookup(name)
+		if f == nil {
+			continue
+		}
+		boolean, _ := f.Value.(interface{ IsBoolFlag() bool })
+		values[name] = new([]string)
+		fs.Var(stubFlag{values: values[name], bool: boolean != nil && boolean.IsBoolFlag()}, name, "")
+	}
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		return fmt.Errorf("subcommand %s not allowed, only build flags are", args[0])
+	}
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%v (allowed flags: -%s)", err, strings.Join(daemonFlags, ", -"))
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("positional argument %s not allowed, only build flags are", fs.Arg(0))
+	}
+	for _, path := range *values["project-path"] {
+		if !withinFolder(path, root) {
+			return fmt.Errorf("project path %s not allowed, must be within %s", path, root)
+		}
+	}
+	for _, path := range *values["cmd-path"] {
+		if filepath.IsAbs(path) || strings.HasPrefix(filepath.Clean(path), "..") {
+			return fmt.Errorf("command path %s not allowed, must be relative to the project", path)
+		}
+	}
+	for _, deps := range *values["deps"] {
+		for _, spec := range strings.Fields(deps) {
+			if !strings.HasPrefix(spec, "git+") && !strings.Contains(spec, "://") {
+				return fmt.Errorf("local dependency %s not allowed, only remote ones are", spec)
+			}
+		}
+	}
+	return nil
+}
+
+// withinFolder reports whether a path is the given folder or within it, once
+// resolved to an absolute path without symbolic links.
+func withinFolder(path string, root string) bool {
+	resolve := func(path string) (string, error) {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return "", err
+		}
+		if real, err := filepath.EvalSymlinks(abs); err == nil {
+			return real, nil
+		}
+		return abs, nil
+	}
+	path, err := resolve(path)
+	if err != nil {
+		return false
+	}
+	if root, err = resolve(root); err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// daemonToken resolves the token the API clients of the daemon authenticate
+// with: the given one, the one of XGO_SERVE_TOKEN, or a random one if clients
+// aren't authenticated by certificate instead.
+func daemonToken(token string, clientCA string) (string, error) {
+	if token == "" {
+		token = os.Getenv("XGO_SERVE_TOKEN")
+	}
+	if token != "" || clientCA != "" {
+		return token, nil
+	}
+	blob := make([]byte, 16)
+	if _, err := rand.Read(blob); err != nil {
+		return "", fmt.Errorf("failed to generate API token: %v", err)
+	}
+	return hex.EncodeToString(blob), nil
+}
+
+// clientTLS returns the TLS configuration requiring the API clients of the
+// daemon to present a certificate issued by the given CA.
+func clientTLS(clientCA string) (*tls.Config, error) {
+	blob, err := os.ReadFile(clientCA)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(blob) {
+		return nil, errors.New("no certificate found in client CA")
+	}
+	return &tls.Config{ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert}, nil
+}
+
+// authenticate guards an API handler with the token of the daemon, given as a
+// bearer token, or for reads (e.g. event streams and artifact links of the
+// dashboard) as the token query parameter. Builds must be submitted as JSON,
+// keeping browsers from submitting them cross-site without a preflight.
+func (d *daemon) authenticate(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if d.token != "" {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if token == r.Header.Get("Authorization") {
+				token = ""
+			}
+			if token == "" && r.Method == http.MethodGet {
+				token = r.URL.Query().Get("token")
+			}
+			if subtle.ConstantTimeCompare([]byte(token), []byte(d.token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="xgo"`)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		if r.Method == http.MethodPost {
+			if media, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); media != "application/json" {
+				http.Error(w, "builds must be submitted as application/json", http.StatusUnsupportedMediaType)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
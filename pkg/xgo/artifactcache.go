@@ -0,0 +1,361 @@
+package xgo
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// artifactStore is a remote store of the compiled outputs of single targets,
+// keyed by everything the outputs derive from.
+type artifactStore interface {
+	fetch(ctx context.Context, key string, path string) (bool, error) // Downloads an entry into a file, false if missing
+	store(ctx context.Context, key string, path string) error         // Uploads a file as an entry
+}
+
+// newArtifactStore creates the store of an artifact cache URL: s3://bucket/prefix
+// or an HTTP(S) base URL.
+func newArtifactStore(url string) (artifactStore, error) {
+	switch {
+	case strings.HasPrefix(url, "s3://"):
+		return &s3ArtifactStore{url: strings.TrimSuffix(url, "/")}, nil
+	case strings.HasPrefix(url, "http://"), strings.HasPrefix(url, "https://"):
+		return &httpArtifactStore{url: strings.TrimSuffix(url, "/"), token: os.Getenv("XGO_ARTIFACT_CACHE_TOKEN")}, nil
+	}
+	return nil, fmt.Errorf("invalid artifact cache %q, must be an s3:// or HTTP(S) URL", url)
+}
+
+// s3ArtifactStore keeps the entries as objects below an S3 prefix (aws CLI).
+type s3ArtifactStore struct {
+	url string // Prefix of the entries (s3://bucket/prefix)
+}
+
+func (s *s3ArtifactStore) fetch(ctx context.Context, key string, path string) (bool, error) {
+	object := s.url + "/" + key + ".tar.gz"
+	if err := exec.CommandContext(ctx, "aws", "s3", "ls", object).Run(); err != nil {
+		return false, nil // Listing fails for missing objects
+	}
+	if out, err := exec.CommandContext(ctx, "aws", "s3", "cp", "--only-show-errors", object, path).CombinedOutput(); err != nil {
+		return false, fmt.Errorf("aws s3 cp failed: %v\n%s", err, strings.TrimSpace(string(out)))
+	}
+	return true, nil
+}
+
+func (s *s3ArtifactStore) store(ctx context.Context, key string, path string) error {
+	if out, err := exec.CommandContext(ctx, "aws", "s3", "cp", "--only-show-errors", path, s.url+"/"+key+".tar.gz").CombinedOutput(); err != nil {
+		return fmt.Errorf("aws s3 cp failed: %v\n%s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// httpArtifactStore keeps the entries on an HTTP server, fetched with GET and
+// stored with PUT (e.g. a bazel-remote or nginx WebDAV cache).
+type httpArtifactStore struct {
+	url   string // Base URL of the entries
+	token string // Bearer token to authenticate with, none if empty
+}
+
+func (s *httpArtifactStore) request(ctx context.Context, method string, key string, body io.Reader, size int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.url+"/"+key+".tar.gz", body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size // Not all caches accept chunked uploads
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	return HTTPClient.Do(req)
+}
+
+func (s *httpArtifactStore) fetch(ctx context.Context, key string, path string) (bool, error) {
+	res, err := s.request(ctx, http.MethodGet, key, nil, 0)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return false, nil
+	case res.StatusCode != http.StatusOK:
+		return false, fmt.Errorf("unexpected status %s", res.Status)
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		return false, err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, res.Body); err != nil {
+		return false, err
+	}
+	return true, out.Close()
+}
+
+func (s *httpArtifactStore) store(ctx context.Context, key string, path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	res, err := s.request(ctx, http.MethodPut, key, in, info.Size())
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return nil
+}
+
+// artifactKeyData is everything the outputs of a target derive from, hashed into
+// the key of its artifact cache entry.
+type artifactKeyData struct {
+	Version   int            // Format of the entries, bumped on incompatible changes
+	Target    string         // Target the outputs are built for
+	Toolchain string         // Image digest or local Go version building the target
+	Sources   string         // Digest of the project sources
+	Project   ConfigFlags    // Packages, dependencies and naming of the build
+	Profile   *TargetProfile // Custom toolchain of the target if any
+	Flags     BuildFlags     // Flags of the Go builds
+	GoFlags   string         // Default flags of the go commands
+}
+
+// artifactKey computes the artifact cache key of a target.
+func (b *builder) artifactKey(target string, sources string) (string, error) {
+	toolchain := b.digest
+	if b.natives[target] {
+		toolchain = b.goVersion(target)
+	}
+	if toolchain == "" {
+		return "", errors.New("unknown toolchain")
+	}
+	project := b.cfg.Project
+	project.Targets, project.Profiles, project.Groups = nil, nil, nil
+	project.ProjectPath, project.BinPath = "", ""
+	if cmd, err := filepath.Rel(b.cfg.Project.ProjectPath, b.cfg.Project.CmdPath); err == nil {
+		project.CmdPath = filepath.ToSlash(cmd)
+	}
+	blob, err := json.Marshal(&artifactKeyData{
+		Version:   1,
+		Target:    target,
+		Toolchain: toolchain,
+		Sources:   sources,
+		Project:   project,
+		Profile:   b.cfg.Project.Profiles[target],
+		Flags:     b.cfg.Flags,
+		GoFlags:   b.cfg.GoFlags,
+	})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(blob)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// sourceDigest hashes the files of the project, leaving out the version control
+// metadata, the bin path and the project dependency cache.
+func (b *builder) sourceDigest() (string, error) {
+	root := b.cfg.Project.ProjectPath
+	cache := b.cfg.ProjectCache
+	if cache != "" && !filepath.IsAbs(cache) {
+		cache = filepath.Join(root, cache)
+	}
+	hash := sha256.New()
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && (info.Name() == ".git" || path == b.cfg.Project.BinPath || path == cache) {
+			return filepath.SkipDir
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(hash, "%s %o\n", filepath.ToSlash(rel), info.Mode().Perm())
+		return copyFile(hash, path)
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// restoreArtifacts fetches the outputs of the targets found in the artifact cache
+// into the bin path, returning the keys of all the targets and the ones left to
+// build. Failures of the cache only fall back to building.
+func (b *builder) restoreArtifacts(store artifactStore, targets []string) (map[string]string, []string) {
+	sources, err := b.sourceDigest()
+	if err != nil {
+		log.Printf("WARNING: Failed to hash the project sources, not using the artifact cache: %v", err)
+		return nil, targets
+	}
+	keys := make(map[string]string)
+	var missing []string
+	for _, target := range targets {
+		key, err := b.artifactKey(target, sources)
+		if err != nil {
+			log.Printf("WARNING: Not caching the outputs of %s: %v", target, err)
+			missing = append(missing, target)
+			continue
+		}
+		keys[target] = key
+
+		if err := b.restoreArtifact(store, target, key); err != nil {
+			if !errors.Is(err, errCacheMiss) {
+				log.Printf("WARNING: Failed to restore %s from the artifact cache: %v", target, err)
+			}
+			b.stats.OutputMisses++
+			missing = append(missing, target)
+			continue
+		}
+		b.stats.OutputHits++
+		log.Printf("INFO: Restored %s from the artifact cache", target)
+
+		b.lock.Lock()
+		now := time.Now()
+		b.runs[b.runKey(target)] = &targetRun{start: now, end: now}
+		b.lock.Unlock()
+	}
+	return keys, missing
+}
+
+// errCacheMiss is returned when the artifact cache has no entry for a target.
+var errCacheMiss = errors.New("not cached")
+
+// restoreArtifact downloads and extracts the cache entry of a target.
+func (b *builder) restoreArtifact(store artifactStore, target string, key string) error {
+	tmp, err := os.CreateTemp(b.work, "artifact-")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	found, err := store.fetch(b.ctx, key, tmp.Name())
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errCacheMiss
+	}
+	in, err := os.Open(tmp.Name())
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	gz, err := gzip.NewReader(in)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := filepath.FromSlash(header.Name)
+		if header.Typeflag != tar.TypeReg || filepath.IsAbs(name) || strings.HasPrefix(filepath.Clean(name), "..") {
+			return fmt.Errorf("invalid entry %s", header.Name)
+		}
+		path := filepath.Join(b.cfg.Project.BinPath, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		out, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(header.Mode).Perm())
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, tr)
+		out.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// storeArtifacts uploads the outputs of the freshly built targets into the
+// artifact cache, each target as its own entry.
+func (b *builder) storeArtifacts(store artifactStore, keys map[string]string, built []string, artifacts []Artifact) {
+	for _, target := range built {
+		key, ok := keys[target]
+		if !ok {
+			continue
+		}
+		var entries []PackageFile
+		for _, artifact := range artifacts {
+			if !builtFor(artifact.Target, target) {
+				continue
+			}
+			rel, err := filepath.Rel(b.cfg.Project.BinPath, artifact.Path)
+			if err != nil || strings.HasPrefix(rel, "..") {
+				continue
+			}
+			entries = append(entries, PackageFile{Path: artifact.Path, Name: filepath.ToSlash(rel)})
+		}
+		if len(entries) == 0 {
+			continue
+		}
+		if err := b.storeArtifact(store, key, entries); err != nil {
+			log.Printf("WARNING: Failed to store %s into the artifact cache: %v", target, err)
+		} else {
+			log.Printf("INFO: Stored %s into the artifact cache", target)
+		}
+	}
+}
+
+// builtFor reports whether an output target, which may carry the platform version
+// before the architecture (e.g. windows/4.0-amd64), belongs to a build target.
+func builtFor(output string, target string) bool {
+	if output == target {
+		return true
+	}
+	outputs, targets := strings.SplitN(output, "/", 2), strings.SplitN(target, "/", 2)
+	if len(outputs) != 2 || len(targets) != 2 || outputs[0] != strings.SplitN(targets[0], "-", 2)[0] {
+		return false
+	}
+	return strings.HasSuffix(outputs[1], "-"+targets[1])
+}
+
+// storeArtifact uploads a set of outputs as the cache entry of the given key.
+func (b *builder) storeArtifact(store artifactStore, key string, entries []PackageFile) error {
+	tmp, err := os.CreateTemp(b.work, "artifact-")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if err := writeTarball(tmp.Name(), entries, "gz", 0, time.Time{}); err != nil {
+		return err
+	}
+	return store.store(b.ctx, key, tmp.Name())
+}
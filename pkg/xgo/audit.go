@@ -0,0 +1,78 @@
+package xgo
+
+import (
+	"debug/elf"
+	"debug/macho"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// auditOutputs lists the dynamic library dependencies of every Linux and macOS
+// binary produced since the given time in the output folder, failing if any of
+// them is not matched by the allowlist of library name patterns.
+func auditOutputs(dir string, since time.Time, allowed []string) error {
+	var failures []string
+	err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || info.ModTime().Before(since) {
+			return err
+		}
+		goos, _, ok := parseOutputName(info.Name())
+		if !ok || (goos != "linux" && goos != "darwin") {
+			return nil
+		}
+		libs, err := importedLibraries(file, goos)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", file, err))
+			return nil
+		}
+		log.Printf("INFO: Dynamic libraries of %s: [%s]", file, strings.Join(libs, ", "))
+		for _, lib := range libs {
+			if !libraryAllowed(lib, allowed) {
+				failures = append(failures, fmt.Sprintf("%s: links disallowed library %s", file, lib))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%d linkage violations:\n  %s", len(failures), strings.Join(failures, "\n  "))
+	}
+	return nil
+}
+
+// importedLibraries returns the dynamic libraries an ELF or Mach-O binary needs.
+func importedLibraries(file string, goos string) ([]string, error) {
+	if goos == "darwin" {
+		f, err := macho.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return f.ImportedLibraries()
+	}
+	f, err := elf.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.ImportedLibraries()
+}
+
+// libraryAllowed checks whether the base name of a library matches any of the
+// allowed glob patterns, e.g. libc.so.* or libSystem.*.dylib.
+func libraryAllowed(lib string, allowed []string) bool {
+	name := path.Base(lib)
+	for _, pattern := range allowed {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
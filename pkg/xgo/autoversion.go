@@ -0,0 +1,188 @@
+package xgo
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// versionVar is a kind of conventional version metadata variable, stamped by the
+// automatic versioning.
+type versionVar struct {
+	names []string                  // Conventional names of the variable
+	value func(*LdFlagsData) string // Version metadata to stamp the variable with
+}
+
+// versionVars are the conventional version metadata variables.
+var versionVars = []versionVar{
+	{[]string{"version", "Version", "appVersion", "AppVersion"}, func(d *LdFlagsData) string { return d.Describe }},
+	{[]string{"commit", "Commit", "gitCommit", "GitCommit", "revision", "Revision"}, func(d *LdFlagsData) string { return d.FullCommit }},
+	{[]string{"date", "Date", "buildDate", "BuildDate", "buildTime", "BuildTime"}, func(d *LdFlagsData) string { return d.Date }},
+}
+
+// autoVersionFlags returns the linker flags stamping the conventional version
+// metadata variables of a project with its git metadata, e.g. -X main.version=
+// v1.2.3. The string variables are looked up in the main packages and in the
+// packages named version (e.g. example.com/app/internal/version).
+func autoVersionFlags(project string, epoch string) (string, error) {
+	module := modulePath(project)
+	vars := make(map[string]versionVar)
+	err := filepath.Walk(project, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if name := info.Name(); file != project && (name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+			return filepath.SkipDir
+		}
+		if _, err := os.Stat(filepath.Join(file, "go.mod")); err == nil && file != project {
+			return filepath.SkipDir // Nested modules are built on their own
+		}
+		rel, err := filepath.Rel(project, file)
+		if err != nil {
+			return err
+		}
+		return packageVersionVars(file, path.Join(module, filepath.ToSlash(rel)), vars)
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to look up version variables: %v", err)
+	}
+	if len(vars) == 0 {
+		return "", nil
+	}
+	symbols := make([]string, 0, len(vars))
+	for symbol := range vars {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+
+	data := ldFlagsData(project, epoch)
+	var flags []string
+	for _, symbol := range symbols {
+		if value := vars[symbol].value(data); value != "" {
+			flags = append(flags, "-X "+symbol+"="+value)
+		}
+	}
+	return strings.Join(flags, " "), nil
+}
+
+// packageVersionVars collects the conventional version metadata variables of the
+// package in a folder, keyed by their linker symbol, if it is a main package or
+// one named version.
+func packageVersionVars(dir string, importPath string, vars map[string]versionVar) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	fset := token.NewFileSet()
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, 0)
+		if err != nil {
+			continue // Broken files fail the build on their own
+		}
+		prefix := importPath
+		switch file.Name.Name {
+		case "main":
+			prefix = "main"
+		case "version":
+		default:
+			return nil
+		}
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.VAR {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				spec := spec.(*ast.ValueSpec)
+				if !stringVar(spec) {
+					continue
+				}
+				for _, ident := range spec.Names {
+					for _, v := range versionVars {
+						if contains(v.names, ident.Name) {
+							vars[prefix+"."+ident.Name] = v
+						}
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// stringVar reports whether a variable declaration can be set by the linker: a
+// string typed one, or one initialized with string literals.
+func stringVar(spec *ast.ValueSpec) bool {
+	if spec.Type != nil {
+		ident, ok := spec.Type.(*ast.Ident)
+		return ok && ident.Name == "string"
+	}
+	for _, value := range spec.Values {
+		if lit, ok := value.(*ast.BasicLit); !ok || lit.Kind != token.STRING {
+			return false
+		}
+	}
+	return len(spec.Values) > 0
+}
+
+// modulePath returns the module path declared by the go.mod of a project, empty
+// if it has none.
+func modulePath(project string) string {
+	blob, err := os.ReadFile(filepath.Join(project, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(blob), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`)
+		}
+	}
+	return ""
+}
+
+// autoVersion prepends the linker flags stamping the version variables of the
+// project to the global and overridden linker flags, the given ones taking
+// precedence as the linker keeps the last value of a variable.
+func autoVersion(project string, flags BuildFlags) (BuildFlags, error) {
+	if !isLocalPath(project) {
+		log.Printf("WARNING: Version variables can only be looked up in local projects, not stamping them")
+		return flags, nil
+	}
+	stamp, err := autoVersionFlags(project, flags.Epoch)
+	if err != nil || stamp == "" {
+		if err == nil {
+			log.Printf("WARNING: No conventional version variables found in %s, not stamping them", project)
+		}
+		return flags, err
+	}
+	log.Printf("INFO: Stamping version variables: %s", stamp)
+
+	flags.LdFlags = strings.TrimSpace(stamp + " " + flags.LdFlags)
+	if len(flags.Overrides) > 0 {
+		overrides := make(map[string]*TargetOverride, len(flags.Overrides))
+		for pattern, o := range flags.Overrides {
+			if o.LdFlags != "" {
+				copied := *o
+				copied.LdFlags = stamp + " " + o.LdFlags
+				o = &copied
+			}
+			overrides[pattern] = o
+		}
+		flags.Overrides = overrides
+	}
+	return flags, nil
+}
@@ -0,0 +1,129 @@
+package xgo
+
+import (
+	"fmt"
+	"go/build"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// CacheStats are the cache hits and misses of a build, quantifying whether the
+// caches (e.g. of a CI setup) are effective.
+type CacheStats struct {
+	Image         string `json:"image,omitempty"` // Whether the build image was present or pulled, empty if unused
+	DepsHits      int    `json:"deps_hits"`       // CGO dependencies found in the dependency cache
+	DepsMisses    int    `json:"deps_misses"`     // CGO dependencies downloaded
+	ModuleHits    int    `json:"module_hits"`     // Required modules found in the module cache
+	ModuleMisses  int    `json:"module_misses"`   // Required modules missing from the module cache
+	GoCacheHits   int    `json:"gocache_hits"`    // Package builds reused from GOCACHE (native builds only)
+	GoCacheMisses int    `json:"gocache_misses"`  // Package builds compiled (native builds only)
+	OutputHits    int    `json:"output_hits"`     // Targets restored from the artifact cache
+	OutputMisses  int    `json:"output_misses"`   // Targets missing from the artifact cache
+	WarmHits      int    `json:"warm_hits"`       // Build containers started from a warm start image
+	WarmMisses    int    `json:"warm_misses"`     // Build containers building their dependencies into a new warm start image
+}
+
+// String summarizes the cache statistics on a single line.
+func (s *CacheStats) String() string {
+	parts := []string{}
+	if s.Image != "" {
+		parts = append(parts, "image "+s.Image)
+	}
+	ratio := func(name string, hits, misses int) {
+		if hits+misses > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d/%d hits (%.0f%%)", name, hits, hits+misses, 100*float64(hits)/float64(hits+misses)))
+		}
+	}
+	ratio("deps", s.DepsHits, s.DepsMisses)
+	ratio("modules", s.ModuleHits, s.ModuleMisses)
+	ratio("GOCACHE", s.GoCacheHits, s.GoCacheMisses)
+	ratio("outputs", s.OutputHits, s.OutputMisses)
+	ratio("warm start", s.WarmHits, s.WarmMisses)
+	if len(parts) == 0 {
+		return "no caches used"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// moduleCacheStats counts the modules required by a project (listed in its
+// go.sum) that are already downloaded into the module cache shared with the
+// builds, i.e. the one of the host GOPATH.
+func moduleCacheStats(project string) (hits int, misses int) {
+	blob, err := os.ReadFile(filepath.Join(project, "go.sum"))
+	if err != nil {
+		return 0, 0
+	}
+	cache := os.Getenv("GOMODCACHE")
+	if cache == "" {
+		cache = filepath.Join(filepath.SplitList(build.Default.GOPATH)[0], "pkg", "mod")
+	}
+	for _, line := range strings.Split(string(blob), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || strings.HasSuffix(fields[1], "/go.mod") {
+			continue
+		}
+		zip := filepath.Join(cache, "cache", "download", filepath.FromSlash(escapeModule(fields[0])), "@v", escapeModule(fields[1])+".zip")
+		if fileExists(zip) {
+			hits++
+		} else {
+			misses++
+		}
+	}
+	return hits, misses
+}
+
+// escapeModule escapes a module path or version the way the module cache does,
+// replacing the upper case letters with an exclamation mark and their lower case.
+func escapeModule(s string) string {
+	var escaped strings.Builder
+	for _, r := range s {
+		if unicode.IsUpper(r) {
+			escaped.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		escaped.WriteRune(r)
+	}
+	return escaped.String()
+}
+
+// goCacheActions counts the action entries of the local Go build cache, every
+// compiled package adding one, or -1 if the cache can't be found.
+func goCacheActions() int {
+	out, err := exec.Command("go", "env", "GOCACHE").Output()
+	if err != nil || strings.TrimSpace(string(out)) == "" {
+		return -1
+	}
+	count := 0
+	filepath.Walk(strings.TrimSpace(string(out)), func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && strings.HasSuffix(path, "-a") {
+			count++
+		}
+		return nil
+	})
+	return count
+}
+
+// recordGoCache records the GOCACHE hits and misses of a native build, given the
+// number of packages it needed and the new cache actions it added.
+func (b *builder) recordGoCache(packages int, added int) {
+	if added < 0 || packages <= 0 {
+		return
+	}
+	if added > packages {
+		added = packages
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.stats.GoCacheHits += packages - added
+	b.stats.GoCacheMisses += added
+}
+
+// logCacheStats logs the cache statistics of the build.
+func (b *builder) logCacheStats() {
+	log.Printf("INFO: Cache statistics: %s", b.stats.String())
+}
@@ -0,0 +1,86 @@
+package xgo
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// checksumHashes are the supported checksum algorithms.
+var checksumHashes = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// checksumFile returns the name of the checksum file of an algorithm, e.g.
+// SHA256SUMS for sha256.
+func checksumFile(algo string) string {
+	return strings.ToUpper(algo) + "SUMS"
+}
+
+// writeChecksums writes a checksum file per algorithm into the bin path, listing
+// the digests of all the artifacts in the format of the sha*sum tools, sorted by
+// name so the files are reproducible.
+func writeChecksums(dir string, artifacts []Artifact, algos []string) ([]Artifact, error) {
+	var files []Artifact
+	for _, algo := range algos {
+		var lines []string
+		for _, artifact := range artifacts {
+			sum, err := fileChecksum(artifact.Path, checksumHashes[algo])
+			if err != nil {
+				return files, err
+			}
+			name, err := filepath.Rel(dir, artifact.Path)
+			if err != nil {
+				name = filepath.Base(artifact.Path)
+			}
+			lines = append(lines, sum+"  "+filepath.ToSlash(name)+"\n")
+		}
+		sort.Slice(lines, func(i, j int) bool {
+			return lines[i][strings.Index(lines[i], "  "):] < lines[j][strings.Index(lines[j], "  "):]
+		})
+		path := filepath.Join(dir, checksumFile(algo))
+		if err := os.WriteFile(path, []byte(strings.Join(lines, "")), 0644); err != nil {
+			return files, err
+		}
+		log.Printf("INFO: Wrote %s checksums of %d artifacts to %s", algo, len(lines), path)
+		files = append(files, Artifact{Path: path})
+	}
+	return files, nil
+}
+
+// fileChecksum calculates the hex encoded digest of a file.
+func fileChecksum(path string, newHash func() hash.Hash) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hasher := newHash()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// validateChecksums checks that all the requested checksum algorithms are
+// supported.
+func validateChecksums(algos []string) error {
+	for _, algo := range algos {
+		if checksumHashes[algo] == nil {
+			return fmt.Errorf("unsupported checksum algorithm %q, must be sha1, sha256 or sha512", algo)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package xgo
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// codeSignKey is an Authenticode code signing key held by a cloud key service,
+// the signatures being computed by the service (jsign) without the private key
+// ever reaching the build machine.
+type codeSignKey struct {
+	storeType string   // Keystore type of jsign (AWS, GOOGLECLOUD, AZUREKEYVAULT)
+	keystore  string   // Region, key ring or vault holding the key
+	alias     string   // Key or certificate within the keystore
+	token     []string // Command printing an access token of the service, none if unneeded
+}
+
+// parseCodeSignKey parses a code signing key reference: awskms:<region>/<key>,
+// gcpkms:<key ring path>/cryptoKeys/<key>[/cryptoKeyVersions/<n>] or
+// azurekv:<vault>/<certificate>.
+func parseCodeSignKey(ref string) (*codeSignKey, error) {
+	parts := strings.SplitN(ref, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, fmt.Errorf("invalid code signing key %q, must be awskms:, gcpkms: or azurekv:<key>", ref)
+	}
+	switch scheme, key := parts[0], strings.Trim(parts[1], "/"); scheme {
+	case "awskms":
+		if idx := strings.Index(key, "/"); idx > 0 {
+			return &codeSignKey{storeType: "AWS", keystore: key[:idx], alias: key[idx+1:]}, nil
+		}
+		return nil, fmt.Errorf("invalid AWS KMS key %q, must be awskms:<region>/<key id or alias>", ref)
+	case "gcpkms":
+		if idx := strings.Index(key, "/cryptoKeys/"); idx > 0 && strings.HasPrefix(key, "projects/") {
+			return &codeSignKey{storeType: "GOOGLECLOUD", keystore: key[:idx], alias: key[idx+len("/cryptoKeys/"):], token: []string{"gcloud", "auth", "print-access-token"}}, nil
+		}
+		return nil, fmt.Errorf("invalid GCP KMS key %q, must be gcpkms:projects/<project>/locations/<location>/keyRings/<ring>/cryptoKeys/<key>", ref)
+	case "azurekv":
+		if idx := strings.Index(key, "/"); idx > 0 {
+			return &codeSignKey{storeType: "AZUREKEYVAULT", keystore: key[:idx], alias: key[idx+1:], token: []string{"az", "account", "get-access-token", "--resource", "https://vault.azure.net", "--query", "accessToken", "--output", "tsv"}}, nil
+		}
+		return nil, fmt.Errorf("invalid Azure Key Vault certificate %q, must be azurekv:<vault>/<certificate>", ref)
+	default:
+		return nil, fmt.Errorf("unknown key service %s in %q, must be awskms, gcpkms or azurekv", scheme, ref)
+	}
+}
+
+// windowsBinaries returns the Windows executables and DLLs of the artifacts.
+func windowsBinaries(artifacts []Artifact) []string {
+	var paths []string
+	for _, artifact := range artifacts {
+		if goos, _, _ := targetPlatform(artifact.Target); goos != "windows" {
+			continue
+		}
+		if ext := outputExt(artifact.Path); ext == ".exe" || ext == ".dll" {
+			paths = append(paths, artifact.Path)
+		}
+	}
+	return paths
+}
+
+// signWindows Authenticode signs the Windows binaries of the artifacts in place,
+// with the PFX certificate of the build if any, else with its cloud held code
+// signing key. The certificate chain of the AWS and GCP keys is read from
+// XGO_CODESIGN_CERT, the access token of the service from XGO_CODESIGN_TOKEN
+// (or its CLI) and the timestamping authority from XGO_CODESIGN_TSA.
+func (b *builder) signWindows(artifacts []Artifact) error {
+	paths := windowsBinaries(artifacts)
+	if len(paths) == 0 {
+		return nil
+	}
+	if b.cfg.WindowsSignPFX != "" {
+		return b.signWindowsPFX(paths)
+	}
+	key, err := parseCodeSignKey(b.cfg.CodeSignKey)
+	if err != nil {
+		return err
+	}
+	if _, err := exec.LookPath("jsign"); err != nil {
+		return fmt.Errorf("jsign not found, required to sign with %s", b.cfg.CodeSignKey)
+	}
+	args := []string{"--storetype", key.storeType, "--keystore", key.keystore, "--alias", key.alias}
+	if cert := os.Getenv("XGO_CODESIGN_CERT"); cert != "" {
+		args = append(args, "--certfile", cert)
+	} else if key.storeType != "AZUREKEYVAULT" {
+		return fmt.Errorf("no certificate chain of %s, set XGO_CODESIGN_CERT to its PEM file", b.cfg.CodeSignKey)
+	}
+	token := os.Getenv("XGO_CODESIGN_TOKEN")
+	if token == "" && key.token != nil {
+		out, err := exec.CommandContext(b.ctx, key.token[0], key.token[1:]...).Output()
+		if err != nil {
+			return fmt.Errorf("failed to get an access token with %s: %v", key.token[0], err)
+		}
+		token = strings.TrimSpace(string(out))
+	}
+	if token != "" {
+		args = append(args, "--storepass", token)
+	}
+	if tsa := os.Getenv("XGO_CODESIGN_TSA"); tsa != "" {
+		args = append(args, "--tsaurl", tsa)
+	}
+	for _, path := range paths {
+		log.Printf("INFO: Signing %s with %s", filepath.Base(path), b.cfg.CodeSignKey)
+		cmd := exec.CommandContext(b.ctx, "jsign", append(args, path)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			// The access token is passed on the command line, keep it out of the logs
+			msg := strings.TrimSpace(string(out))
+			if token != "" {
+				msg = strings.ReplaceAll(msg, token, "***")
+			}
+			return fmt.Errorf("jsign failed on %s: %v\n%s", filepath.Base(path), err, msg)
+		}
+	}
+	return nil
+}
+
+// signWindowsPFX Authenticode signs the Windows binaries in place with the PFX
+// (PKCS#12) certificate of the build using osslsigncode, its password read from
+// XGO_WINDOWS_SIGN_PASSWORD and the timestamping authority from XGO_CODESIGN_TSA.
+func (b *builder) signWindowsPFX(paths []string) error {
+	if _, err := exec.LookPath("osslsigncode"); err != nil {
+		return fmt.Errorf("osslsigncode not found, required to sign with %s", b.cfg.WindowsSignPFX)
+	}
+	args := []string{"sign", "-pkcs12", b.cfg.WindowsSignPFX, "-h", "sha256"}
+	if password := os.Getenv("XGO_WINDOWS_SIGN_PASSWORD"); password != "" {
+		// Keep the password out of the process list
+		file, err := b.privateFile("pfx-password", password)
+		if err != nil {
+			return err
+		}
+		args = append(args, "-readpass", file)
+	}
+	if res := b.cfg.WindowsResources; res != nil && res.ProductName != "" {
+		args = append(args, "-n", res.ProductName)
+	}
+	if tsa := os.Getenv("XGO_CODESIGN_TSA"); tsa != "" {
+		args = append(args, "-ts", tsa)
+	}
+	for _, path := range paths {
+		log.Printf("INFO: Signing %s with %s", filepath.Base(path), filepath.Base(b.cfg.WindowsSignPFX))
+
+		// osslsigncode can't sign in place, write the signed binary next to it
+		signed := path + ".signed"
+		cmd := exec.CommandContext(b.ctx, "osslsigncode", append(args, "-in", path, "-out", signed)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			os.Remove(signed)
+			return fmt.Errorf("osslsigncode failed on %s: %v\n%s", filepath.Base(path), err, strings.TrimSpace(string(out)))
+		}
+		if err := os.Rename(signed, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
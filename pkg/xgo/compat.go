@@ -0,0 +1,196 @@
+package xgo
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Severities of the compatibility issues of a build.
+const (
+	SeverityWarning = "warning" // The target builds, but not as requested
+	SeverityError   = "error"   // The target is known to fail, the build is aborted before starting
+)
+
+// CompatIssue is a known-bad combination of a target with the CGO dependencies
+// or the build flags of a build, detected before building.
+type CompatIssue struct {
+	Target   string `json:"target"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// String formats the issue as a log line.
+func (i CompatIssue) String() string {
+	return fmt.Sprintf("%s: %s", i.Target, i.Message)
+}
+
+// raceTargets are the targets the build script builds with the race detector.
+var raceTargets = map[string]bool{"linux/amd64": true, "windows/amd64": true, "darwin/amd64": true, "darwin/arm64": true}
+
+// buildModeTargets are the os/arch platforms supporting the build modes needing
+// more than the default executables, after the tables of the Go toolchain.
+var buildModeTargets = map[string][]string{
+	"c-archive": {"linux/386", "linux/amd64", "linux/arm", "linux/arm64", "linux/loong64", "linux/ppc64le", "linux/riscv64", "linux/s390x", "darwin/*", "windows/*", "freebsd/amd64", "aix/ppc64", "android/*", "ios/*"},
+	"c-shared":  {"linux/386", "linux/amd64", "linux/arm", "linux/arm64", "linux/loong64", "linux/ppc64le", "linux/riscv64", "linux/s390x", "darwin/amd64", "darwin/arm64", "windows/386", "windows/amd64", "windows/arm64", "freebsd/amd64", "illumos/amd64", "android/*"},
+	"pie":       {"linux/386", "linux/amd64", "linux/arm", "linux/arm64", "linux/loong64", "linux/ppc64le", "linux/riscv64", "linux/s390x", "darwin/*", "windows/*", "freebsd/amd64", "aix/ppc64", "android/*", "ios/*"},
+	"plugin":    {"linux/386", "linux/amd64", "linux/arm", "linux/arm64", "linux/loong64", "linux/ppc64le", "linux/riscv64", "linux/s390x", "darwin/amd64", "darwin/arm64", "freebsd/amd64"},
+	"shared":    {"linux/386", "linux/amd64", "linux/arm", "linux/arm64", "linux/ppc64le", "linux/s390x"},
+}
+
+// platformSince are the Go releases having introduced the platforms added since
+// Go 1.14, to tell which release a missing platform requires.
+var platformSince = map[string]string{
+	"linux/riscv64":   "1.14",
+	"freebsd/arm64":   "1.14",
+	"darwin/arm64":    "1.16",
+	"netbsd/arm64":    "1.16",
+	"openbsd/mips64":  "1.16",
+	"windows/arm64":   "1.17",
+	"linux/loong64":   "1.19",
+	"freebsd/riscv64": "1.20",
+	"wasip1/wasm":     "1.21",
+	"openbsd/ppc64":   "1.22",
+	"openbsd/riscv64": "1.23",
+}
+
+// cgoModes are the build modes requiring CGO.
+var cgoModes = map[string]bool{"c-archive": true, "c-shared": true, "plugin": true, "shared": true}
+
+// checkCompat analyzes the requested targets against the CGO dependencies and
+// the build mode of the build, logging the known-bad combinations. Targets with
+// a custom toolchain profile are only checked against the build mode.
+func (b *builder) checkCompat(targets []string) []CompatIssue {
+	config, flags := &b.cfg.Project, &b.cfg.Flags
+
+	var issues []CompatIssue
+	issue := func(target string, severity string, format string, args ...interface{}) {
+		issues = append(issues, CompatIssue{Target: target, Severity: severity, Message: fmt.Sprintf(format, args...)})
+	}
+	missing := b.missingPlatforms()
+	minor, _ := goMinor(b.toolchainVersion())
+	for _, target := range targets {
+		goos, goarch, _ := targetPlatform(target)
+		if goos == "" {
+			continue // Custom profile named after no platform
+		}
+		platform := goos + "/" + goarch
+		cgo := builtinTarget(target) || config.Profiles[target] != nil
+
+		if missing(platform) && config.Profiles[target] == nil {
+			issue(target, SeverityError, "%s", b.unsupportedMessage(platform))
+			continue
+		}
+		if err := checkLevel(target, minor); err != nil && config.Profiles[target] == nil {
+			issue(target, SeverityError, "%v", err)
+			continue
+		}
+		base, libc := splitLibc(target)
+		if libc != "" && config.Profiles[target] == nil && muslTarget(base) == "" {
+			issue(target, SeverityError, "no %s toolchain available for the platform", libc)
+			continue
+		}
+		if flags.Race && (!raceTargets[platform] || libc != "") {
+			issue(target, SeverityWarning, "the race detector is not supported, building without it")
+		}
+		mode := targetMode(flags, target)
+		if platforms, ok := buildModeTargets[mode]; ok && !matchesAny(platforms, platform) {
+			issue(target, SeverityError, "build mode %s is not supported by the Go toolchain", mode)
+		} else if cgoModes[mode] && !cgo {
+			issue(target, SeverityError, "build mode %s requires CGO, not available for the platform", mode)
+		}
+		if config.Dependencies != "" && !cgo {
+			if goarch == "wasm" {
+				issue(target, SeverityError, "CGO dependencies can't be linked into WebAssembly binaries")
+			} else {
+				issue(target, SeverityWarning, "built without CGO, the CGO dependencies are not linked in")
+			}
+		}
+	}
+	for _, issue := range issues {
+		log.Printf("%s: %s", strings.ToUpper(issue.Severity), issue)
+	}
+	return issues
+}
+
+// builtinTarget reports whether a target is built by one of the CGO toolchains
+// of the build script, the others being built without CGO.
+func builtinTarget(target string) bool {
+	goos, goarch, _ := targetPlatform(target)
+	for _, known := range append(append([]string{}, Targets...), MobileTargets...) {
+		if kos, karch, _ := targetPlatform(known); kos == goos && karch == goarch {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAny checks whether a platform matches any of the os/arch patterns.
+func matchesAny(patterns []string, platform string) bool {
+	for _, pattern := range patterns {
+		if matchTarget(pattern, platform) {
+			return true
+		}
+	}
+	return false
+}
+
+// missingPlatforms returns a check of whether a platform is missing from the Go
+// toolchain of the build, listing its platforms if possible, or else ruling out
+// the platforms known to be more recent than its version.
+func (b *builder) missingPlatforms() func(platform string) bool {
+	if dist, err := b.distList(); err == nil && len(dist) > 0 {
+		supported := make(map[string]bool)
+		for _, platform := range dist {
+			supported[platform] = true
+		}
+		return func(platform string) bool { return !supported[platform] }
+	}
+	if minor, ok := goMinor(b.toolchainVersion()); ok {
+		return func(platform string) bool {
+			since, ok := goMinor(platformSince[platform])
+			return ok && since > minor
+		}
+	}
+	return func(string) bool { return false }
+}
+
+// unsupportedMessage explains why a platform is missing from the Go toolchain of
+// the build, naming the release introducing it if known.
+func (b *builder) unsupportedMessage(platform string) string {
+	msg := "not supported by the Go toolchain of the build"
+	if version := b.toolchainVersion(); version != "" && version != "latest" {
+		msg = fmt.Sprintf("not supported by Go %s", version)
+	}
+	if since, ok := platformSince[platform]; ok {
+		msg += fmt.Sprintf(", requires Go %s or later", since)
+	}
+	return msg
+}
+
+// toolchainVersion returns the version of the Go toolchain building the targets,
+// the tag of the build image or the version of the local toolchain.
+func (b *builder) toolchainVersion() string {
+	if b.cfg.Image != "" && !b.cfg.Native {
+		_, tag, _ := splitImage(b.cfg.Image)
+		return tag
+	}
+	out, err := exec.Command("go", "env", "GOVERSION").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.TrimSpace(string(out)), "go")
+}
+
+// goMinor extracts the minor release of a Go 1.x version (e.g. 21 of 1.21.5 or
+// 1.21.x), failing for versions of other forms (e.g. latest).
+func goMinor(version string) (int, bool) {
+	parts := strings.Split(strings.TrimPrefix(version, "go"), ".")
+	if len(parts) < 2 || parts[0] != "1" {
+		return 0, false
+	}
+	minor, err := strconv.Atoi(parts[1])
+	return minor, err == nil
+}
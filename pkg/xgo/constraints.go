@@ -0,0 +1,602 @@
+package xgo
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/build/constraint"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// knownOS and knownArch are the GOOS and GOARCH values known to the Go toolchain
+// as file name suffixes and build tags, after the lists of go/build.
+var (
+	knownOS = []string{
+		"aix", "android", "darwin", "dragonfly", "freebsd", "hurd", "illumos", "ios", "js", "linux",
+		"nacl", "netbsd", "openbsd", "plan9", "solaris", "wasip1", "windows", "zos",
+	}
+	knownArch = []string{
+		"386", "amd64", "amd64p32", "arm", "armbe", "arm64", "arm64be", "loong64", "mips", "mipsle",
+		"mips64", "mips64le", "mips64p32", "mips64p32le", "ppc", "ppc64", "ppc64le", "riscv", "riscv64",
+		"s390", "s390x", "sparc", "sparc64", "wasm",
+	}
+)
+
+// unixOS are the operating systems satisfying the unix build tag.
+var unixOS = map[string]bool{
+	"aix": true, "android": true, "darwin": true, "dragonfly": true, "freebsd": true, "hurd": true, "illumos": true,
+	"ios": true, "linux": true, "netbsd": true, "openbsd": true, "solaris": true,
+}
+
+// ConstraintIssue is a file of the project excluded from, or included into, the
+// builds of some targets by its build constraints in a way that looks
+// unintentional, detected by the constraint checks.
+type ConstraintIssue struct {
+	File    string   `json:"file"`
+	Targets []string `json:"targets,omitempty"`
+	Message string   `json:"message"`
+}
+
+// String formats the issue as a log line.
+func (i ConstraintIssue) String() string {
+	if len(i.Targets) == 0 {
+		return fmt.Sprintf("%s: %s", i.File, i.Message)
+	}
+	return fmt.Sprintf("%s: %s (%s)", i.File, i.Message, strings.Join(i.Targets, ", "))
+}
+
+// constraintFile is a parsed Go file of the project along with its build
+// constraint, nil if unconstrained beyond its name.
+type constraintFile struct {
+	name  string
+	pkg   string // Package name of the file
+	expr  constraint.Expr
+	decls []string // Package level names declared, methods excluded
+	uses  []string // Identifiers referenced, possibly package level names
+}
+
+// constraintContext is a distinct build context of the requested targets.
+type constraintContext struct {
+	targets []string
+	ctx     build.Context
+}
+
+// checkConstraints parses the packages of the project once per requested target
+// and reports the files whose build constraints look unintentional: misspelled
+// GOOS/GOARCH file name suffixes and build tags, constraints excluding a file on
+// every platform, main packages left without files on some targets and names
+// used on a target but only declared in files excluded from it. The build fails
+// if any issue is found.
+func (b *builder) checkConstraints(targets []string) error {
+	root := b.cfg.Project.ProjectPath
+	if !isLocalPath(root) {
+		return fmt.Errorf("build constraints can only be checked on local projects")
+	}
+	contexts, userTags := b.constraintContexts(targets)
+
+	var (
+		issues   []ConstraintIssue
+		packages int
+	)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if name := info.Name(); path != root && (name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+			return filepath.SkipDir
+		}
+		if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil && path != root {
+			return filepath.SkipDir // Nested modules are built on their own
+		}
+		found, ok, err := checkPackageConstraints(root, path, contexts, userTags)
+		if err != nil {
+			return err
+		}
+		if ok {
+			packages++
+			issues = append(issues, found...)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to check build constraints: %v", err)
+	}
+	for _, issue := range issues {
+		log.Printf("WARNING: %s", issue)
+	}
+	if len(issues) > 0 {
+		return fmt.Errorf("%d build constraint issues found", len(issues))
+	}
+	log.Printf("INFO: No build constraint issues found in %d packages across %d targets", packages, len(targets))
+	return nil
+}
+
+// constraintContexts returns the distinct build contexts of the targets, along
+// with the build tags the build may set, overrides and variants included.
+func (b *builder) constraintContexts(targets []string) ([]*constraintContext, map[string]bool) {
+	flags := &b.cfg.Flags
+	splitTags := func(tags string) []string {
+		return strings.FieldsFunc(tags, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+	userTags := make(map[string]bool)
+	for _, tag := range splitTags(flags.Tags) {
+		userTags[tag] = true
+	}
+	for _, o := range flags.Overrides {
+		for _, tag := range splitTags(o.Tags) {
+			userTags[tag] = true
+		}
+	}
+	for _, variant := range b.cfg.Variants {
+		for _, tag := range splitTags(variant.Tags) {
+			userTags[tag] = true
+		}
+	}
+	var contexts []*constraintContext
+	seen := make(map[string]*constraintContext)
+	for _, target := range targets {
+		goos, goarch, _ := targetPlatform(target)
+		if goos == "" {
+			continue
+		}
+		tags := flags.Tags
+		if o := overrideFor(flags.Overrides, target); o != nil && o.Tags != "" {
+			tags = o.Tags
+		}
+		_, libc := splitLibc(target)
+		cgo := (builtinTarget(target) && libc == "") || b.cfg.Project.Profiles[target] != nil
+
+		key := fmt.Sprintf("%s/%s %v %s", goos, goarch, cgo, tags)
+		if c, ok := seen[key]; ok {
+			c.targets = append(c.targets, target)
+			continue
+		}
+		ctx := build.Default
+		ctx.GOOS, ctx.GOARCH, ctx.CgoEnabled, ctx.BuildTags = goos, goarch, cgo, splitTags(tags)
+
+		c := &constraintContext{targets: []string{target}, ctx: ctx}
+		seen[key] = c
+		contexts = append(contexts, c)
+	}
+	return contexts, userTags
+}
+
+// checkPackageConstraints checks the Go files of a single folder against the
+// build contexts, reporting whether it holds a Go package at all.
+func checkPackageConstraints(root string, dir string, contexts []*constraintContext, userTags map[string]bool) ([]ConstraintIssue, bool, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, false, err
+	}
+	rel := func(name string) string {
+		path, _ := filepath.Rel(root, filepath.Join(dir, name))
+		return filepath.ToSlash(path)
+	}
+	var (
+		files  []*constraintFile
+		issues []ConstraintIssue
+		main   bool
+	)
+	fset := token.NewFileSet()
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+			continue
+		}
+		file, err := parseConstraintFile(fset, filepath.Join(dir, name))
+		if err != nil {
+			return nil, false, err
+		}
+		if file.expr != nil && exprHasTag(file.expr, "ignore") {
+			continue // Deliberately excluded, e.g. go:generate programs
+		}
+		main = main || file.pkg == "main"
+		files = append(files, file)
+
+		for _, message := range nameSuffixIssues(name) {
+			issues = append(issues, ConstraintIssue{File: rel(name), Message: message})
+		}
+		if file.expr != nil {
+			for _, message := range tagIssues(file.expr, userTags) {
+				issues = append(issues, ConstraintIssue{File: rel(name), Message: message})
+			}
+			if !satisfiable(name, file.expr) {
+				issues = append(issues, ConstraintIssue{File: rel(name), Message: "excluded on every platform, its build constraint contradicting its file name or itself"})
+			}
+		}
+	}
+	if len(files) == 0 {
+		return issues, false, nil
+	}
+	// Resolve the files of every target, along with the names they declare
+	declaredIn := make(map[string][]string)
+	for _, file := range files {
+		for _, name := range file.decls {
+			declaredIn[name] = append(declaredIn[name], file.name)
+		}
+	}
+	var excluded []string
+	missing := make(map[string]*ConstraintIssue)
+	var order []string
+	for _, c := range contexts {
+		var included []*constraintFile
+		declared := make(map[string]bool)
+		for _, file := range files {
+			if ok, err := c.ctx.MatchFile(dir, file.name); err != nil {
+				return nil, false, err
+			} else if ok {
+				included = append(included, file)
+				for _, name := range file.decls {
+					declared[name] = true
+				}
+			}
+		}
+		if len(included) == 0 {
+			if main {
+				excluded = append(excluded, c.targets...)
+			}
+			continue
+		}
+		for _, file := range included {
+			for _, name := range file.uses {
+				if declared[name] || declaredIn[name] == nil {
+					continue
+				}
+				key := file.name + "\x00" + name
+				issue, ok := missing[key]
+				if !ok {
+					issue = &ConstraintIssue{File: rel(file.name), Message: fmt.Sprintf("%s is undefined, only declared in %s", name, strings.Join(declaredIn[name], ", "))}
+					missing[key] = issue
+					order = append(order, key)
+				}
+				issue.Targets = append(issue.Targets, c.targets...)
+			}
+		}
+	}
+	if len(excluded) > 0 {
+		issues = append(issues, ConstraintIssue{File: rel("."), Targets: excluded, Message: "all Go files of the main package are excluded by build constraints"})
+	}
+	for _, key := range order {
+		issues = append(issues, *missing[key])
+	}
+	return issues, true, nil
+}
+
+// parseConstraintFile parses a Go file, extracting its build constraint and the
+// package level names it declares and references.
+func parseConstraintFile(fset *token.FileSet, path string) (*constraintFile, error) {
+	parsed, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	file := &constraintFile{name: filepath.Base(path), pkg: parsed.Name.Name}
+
+	// Build constraints precede the package clause, go:build lines superseding
+	// the +build ones
+	var plus []constraint.Expr
+	for _, group := range parsed.Comments {
+		if group.Pos() >= parsed.Package {
+			break
+		}
+		for _, comment := range group.List {
+			switch {
+			case constraint.IsGoBuild(comment.Text):
+				if expr, err := constraint.Parse(comment.Text); err == nil {
+					file.expr = expr
+				}
+			case constraint.IsPlusBuild(comment.Text):
+				if expr, err := constraint.Parse(comment.Text); err == nil {
+					plus = append(plus, expr)
+				}
+			}
+		}
+	}
+	if file.expr == nil {
+		for _, expr := range plus {
+			if file.expr == nil {
+				file.expr = expr
+			} else {
+				file.expr = &constraint.AndExpr{X: file.expr, Y: expr}
+			}
+		}
+	}
+	// Collect the declared names, skipping the ones of methods, and the used ones,
+	// skipping selectors, fields and local definitions
+	uses := make(map[string]bool)
+	for _, decl := range parsed.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Recv == nil && decl.Name.Name != "init" && decl.Name.Name != "main" {
+				file.decls = append(file.decls, decl.Name.Name)
+			}
+			if decl.Recv != nil {
+				collectIdents(decl.Recv, uses)
+			}
+			collectIdents(decl.Type, uses)
+			if decl.Body != nil {
+				collectIdents(decl.Body, uses)
+			}
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.ValueSpec:
+					for _, name := range spec.Names {
+						file.decls = append(file.decls, name.Name)
+					}
+					if spec.Type != nil {
+						collectIdents(spec.Type, uses)
+					}
+					for _, value := range spec.Values {
+						collectIdents(value, uses)
+					}
+				case *ast.TypeSpec:
+					file.decls = append(file.decls, spec.Name.Name)
+					collectIdents(spec.Type, uses)
+				}
+			}
+		}
+	}
+	for name := range uses {
+		file.uses = append(file.uses, name)
+	}
+	sort.Strings(file.uses)
+	return file, nil
+}
+
+// collectIdents records the identifiers used within a node, skipping selected
+// names, field names, struct literal keys and the names of local definitions.
+func collectIdents(node ast.Node, uses map[string]bool) {
+	ast.Inspect(node, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.SelectorExpr:
+			collectIdents(node.X, uses)
+			return false
+		case *ast.Field:
+			if node.Type != nil {
+				collectIdents(node.Type, uses)
+			}
+			return false
+		case *ast.KeyValueExpr:
+			if _, ok := node.Key.(*ast.Ident); !ok {
+				collectIdents(node.Key, uses)
+			}
+			collectIdents(node.Value, uses)
+			return false
+		case *ast.AssignStmt:
+			if node.Tok == token.DEFINE {
+				for _, expr := range node.Rhs {
+					collectIdents(expr, uses)
+				}
+				return false
+			}
+		case *ast.RangeStmt:
+			if node.Tok == token.DEFINE {
+				collectIdents(node.X, uses)
+				collectIdents(node.Body, uses)
+				return false
+			}
+		case *ast.ValueSpec:
+			if node.Type != nil {
+				collectIdents(node.Type, uses)
+			}
+			for _, value := range node.Values {
+				collectIdents(value, uses)
+			}
+			return false
+		case *ast.TypeSpec:
+			collectIdents(node.Type, uses)
+			return false
+		case *ast.Ident:
+			uses[node.Name] = true
+		}
+		return true
+	})
+}
+
+// nameSuffixIssues reports the _GOOS and _GOARCH suffixes of a file name that
+// look like misspelled ones, silently building the file on every target.
+func nameSuffixIssues(name string) []string {
+	parts := strings.Split(strings.TrimSuffix(name, ".go"), "_")
+	if len(parts) < 2 {
+		return nil
+	}
+	last := parts[len(parts)-1]
+	if contains(knownArch, last) {
+		if len(parts) < 3 || contains(knownOS, parts[len(parts)-2]) {
+			return nil
+		}
+		if guess := misspelled(parts[len(parts)-2], knownOS); guess != "" {
+			return []string{fmt.Sprintf("file name suffix _%s looks like a misspelled GOOS %s, the file being built for %s on every OS", parts[len(parts)-2], guess, last)}
+		}
+		return nil
+	}
+	if contains(knownOS, last) {
+		return nil
+	}
+	if guess := misspelled(last, append(append([]string{}, knownOS...), knownArch...)); guess != "" {
+		return []string{fmt.Sprintf("file name suffix _%s looks like a misspelled %s, the file being built for every target", last, guess)}
+	}
+	return nil
+}
+
+// tagIssues reports the tags of a build constraint that look like misspelled
+// GOOS or GOARCH values, neither known nor set by the build.
+func tagIssues(expr constraint.Expr, userTags map[string]bool) []string {
+	var issues []string
+	for _, tag := range exprTags(expr) {
+		if knownTag(tag) || userTags[tag] {
+			continue
+		}
+		if guess := misspelled(tag, append(append([]string{}, knownOS...), knownArch...)); guess != "" {
+			issues = append(issues, fmt.Sprintf("build tag %s looks like a misspelled %s, never set by the build", tag, guess))
+		}
+	}
+	return issues
+}
+
+// satisfiable checks whether a file is built on any known platform with some
+// combination of the custom tags of its build constraint.
+func satisfiable(name string, expr constraint.Expr) bool {
+	oses, arches := knownOS, knownArch
+	parts := strings.Split(strings.TrimSuffix(name, ".go"), "_")
+	if n := len(parts); n >= 2 {
+		switch {
+		case n >= 3 && contains(knownOS, parts[n-2]) && contains(knownArch, parts[n-1]):
+			oses, arches = []string{parts[n-2]}, []string{parts[n-1]}
+		case contains(knownOS, parts[n-1]):
+			oses = []string{parts[n-1]}
+		case contains(knownArch, parts[n-1]):
+			arches = []string{parts[n-1]}
+		}
+	}
+	var free []string
+	for _, tag := range exprTags(expr) {
+		if !knownTag(tag) {
+			free = append(free, tag)
+		}
+	}
+	if len(free) > 8 {
+		return true // Too many combinations to tell
+	}
+	for _, goos := range oses {
+		for _, goarch := range arches {
+			for set := 0; set < 1<<len(free); set++ {
+				for _, cgo := range []bool{false, true} {
+					ok := expr.Eval(func(tag string) bool {
+						for i, custom := range free {
+							if tag == custom {
+								return set&(1<<i) != 0
+							}
+						}
+						switch {
+						case tag == goos || tag == goarch || tag == "gc":
+							return true
+						case tag == "cgo":
+							return cgo
+						case tag == "unix":
+							return unixOS[goos]
+						case tag == "linux":
+							return goos == "android"
+						case tag == "darwin":
+							return goos == "ios"
+						case tag == "solaris":
+							return goos == "illumos"
+						}
+						return contains(build.Default.ReleaseTags, tag)
+					})
+					if ok {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// knownTag reports whether a build tag is set by the Go toolchain itself.
+func knownTag(tag string) bool {
+	switch tag {
+	case "cgo", "gc", "gccgo", "unix", "ignore", "race", "msan", "asan", "purego", "boringcrypto", "goexperiment":
+		return true
+	}
+	return contains(knownOS, tag) || contains(knownArch, tag) || strings.HasPrefix(tag, "go1.") || strings.HasPrefix(tag, "goexperiment.")
+}
+
+// exprTags lists the distinct tags of a build constraint.
+func exprTags(expr constraint.Expr) []string {
+	seen := make(map[string]bool)
+	var tags []string
+	var walk func(expr constraint.Expr)
+	walk = func(expr constraint.Expr) {
+		switch expr := expr.(type) {
+		case *constraint.TagExpr:
+			if !seen[expr.Tag] {
+				seen[expr.Tag] = true
+				tags = append(tags, expr.Tag)
+			}
+		case *constraint.NotExpr:
+			walk(expr.X)
+		case *constraint.AndExpr:
+			walk(expr.X)
+			walk(expr.Y)
+		case *constraint.OrExpr:
+			walk(expr.X)
+			walk(expr.Y)
+		}
+	}
+	walk(expr)
+	return tags
+}
+
+// exprHasTag reports whether a build constraint mentions a tag.
+func exprHasTag(expr constraint.Expr, tag string) bool {
+	return contains(exprTags(expr), tag)
+}
+
+// misspelled returns the known value a word is one edit away from (a missing,
+// extra, replaced or swapped letter), if any, words shorter than 3 letters
+// being too ambiguous to tell.
+func misspelled(word string, known []string) string {
+	if len(word) < 3 {
+		return ""
+	}
+	for _, candidate := range known {
+		if len(candidate) >= 3 && editDistance(word, candidate) == 1 {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// editDistance computes the optimal string alignment distance between two words.
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(minInt(d[i-1][j]+1, d[i][j-1]+1), d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+// contains reports whether a list holds a value.
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// minInt returns the smaller of two integers.
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,52 @@
+package xgo
+
+import (
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// debugFailure helps inspecting a failed build container: if requested, a shell
+// is spawned in a snapshot of the container with the same volumes and env, and
+// the container is kept around for later inspection.
+func (b *builder) debugFailure(container string, args []string) {
+	if b.cfg.DebugShell {
+		b.debugShell(container, args)
+	}
+	if b.cfg.KeepOnFailure {
+		log.Printf("INFO: Kept failed build container %s, inspect it with '%s cp %s:/build .' or '%s commit %s', remove it with '%s rm %s'",
+			container, b.runtime, container, b.runtime, container, b.runtime, container)
+	}
+}
+
+// debugShell snapshots a stopped build container into an image and runs an
+// interactive shell in it, with the volumes, env and working directory of the
+// original build, so the /source and /build state can be inspected.
+func (b *builder) debugShell(container string, args []string) {
+	out, err := exec.Command(b.runtime, "commit", container).Output()
+	if err != nil {
+		log.Printf("WARNING: Failed to snapshot build container %s: %v", container, err)
+		return
+	}
+	image := strings.TrimSpace(string(out))
+	defer exec.Command(b.runtime, "rmi", image).Run()
+
+	shell := []string{"run", "--rm", "-it"}
+	for i := 2; i < len(args) && args[i] != b.cfg.Image && !strings.HasPrefix(args[i], warmStartRepo+":"); i++ { // Skip "run --rm"
+		if args[i] == "--entrypoint" || (b.remote && args[i] == "-v") {
+			i++
+			continue
+		}
+		shell = append(shell, args[i])
+	}
+	shell = append(shell, "--entrypoint", "bash", image)
+
+	log.Printf("INFO: Build failed, starting a debug shell in a snapshot of %s (exit to continue)", container)
+	b.logCommand(shell)
+	cmd := exec.Command(b.runtime, shell...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		log.Printf("WARNING: Debug shell exited with: %v", err)
+	}
+}
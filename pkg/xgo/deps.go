@@ -0,0 +1,121 @@
+package xgo
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Kinds of CGO dependencies, by where their sources are retrieved from.
+const (
+	depArchive = "archive" // Tarball downloaded over HTTP(S)
+	depGit     = "git"     // Git repository cloned at a tag or branch
+	depLocal   = "local"   // Local folder copied into the cache on every build
+)
+
+// dependency is a CGO dependency requested via the dependency specs: a tarball
+// URL, a git+<url>@<ref> repository or a local folder.
+type dependency struct {
+	kind string // Where the sources are retrieved from (archive, git, local)
+	src  string // URL of the archive or repository, or path of the folder
+	ref  string // Tag or branch of a git repository to clone
+	name string // Name of the dependency in the cache
+}
+
+// parseDependency parses a dependency spec.
+func parseDependency(spec string) (dependency, error) {
+	switch {
+	case strings.HasPrefix(spec, "git+"):
+		repo, ref := strings.TrimPrefix(spec, "git+"), ""
+		if i := strings.LastIndex(repo, "@"); i > strings.LastIndex(repo, "/") {
+			repo, ref = repo[:i], repo[i+1:]
+		}
+		if ref == "" {
+			return dependency{}, fmt.Errorf("git dependency %s must pin a tag or branch, e.g. %s@v1.0.0", spec, spec)
+		}
+		name := strings.TrimSuffix(path.Base(repo), ".git") + "@" + strings.ReplaceAll(ref, "/", "-")
+		return dependency{kind: depGit, src: repo, ref: ref, name: name}, nil
+	case strings.Contains(spec, "://"):
+		return dependency{kind: depArchive, src: spec, name: filepath.Base(spec)}, nil
+	default:
+		return dependency{kind: depLocal, src: spec, name: filepath.Base(filepath.Clean(spec))}, nil
+	}
+}
+
+// dependencyNames returns the names of the dependencies in the cache, as passed
+// to the build script. Invalid specs are kept as is, failing the download first.
+func dependencyNames(specs string) string {
+	var names []string
+	for _, spec := range strings.Fields(specs) {
+		if dep, err := parseDependency(spec); err == nil {
+			names = append(names, dep.name)
+		} else {
+			names = append(names, spec)
+		}
+	}
+	return strings.Join(names, " ")
+}
+
+// cloneDependency shallow clones a git dependency at its tag or branch into the
+// cache, through a .part folder renamed once complete. The git metadata is left
+// out, keeping the sources identical whatever the git version.
+func (b *builder) cloneDependency(dep dependency, url string, dst string) error {
+	part := dst + ".part"
+	os.RemoveAll(part)
+
+	cmd := exec.CommandContext(b.ctx, "git", "clone", "--quiet", "--depth", "1", "--branch", dep.ref, url, part)
+	cmd.Stdout, cmd.Stderr = b.stderr, b.stderr
+	if err := cmd.Run(); err != nil {
+		os.RemoveAll(part)
+		return fmt.Errorf("failed to clone %s at %s: %v", url, dep.ref, err)
+	}
+	if err := os.RemoveAll(filepath.Join(part, ".git")); err != nil {
+		return err
+	}
+	return os.Rename(part, dst)
+}
+
+// copyDependency copies a local dependency folder into the cache, replacing any
+// previous copy as the sources may have changed since. Files are hard linked if
+// possible, the build script only reading them.
+func copyDependency(src string, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("local dependency %s is not a folder", src)
+	}
+	if err := os.RemoveAll(dst); err != nil {
+		return err
+	}
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case info.IsDir() && info.Name() == ".git":
+			return filepath.SkipDir
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			return duplicateFile(path, target)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,199 @@
+package xgo
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// sdkPlatforms are the operating systems of go tool dist list that can't be built
+// without their SDKs (Android NDK, iOS SDK), left out of the */* wildcard and
+// only built as the MobileTargets of the build script.
+var sdkPlatforms = map[string]bool{"android": true, "ios": true}
+
+// targetCompilers are the C cross compilers of the builtin targets within the
+// build image, with the default float ABI of the arm targets, and of their musl
+// flavors.
+var targetCompilers = map[string]string{
+	"linux/amd64":    "x86_64-linux-gnu-gcc",
+	"linux/386":      "i686-linux-gnu-gcc",
+	"linux/arm-5":    "arm-linux-gnueabi-gcc",
+	"linux/arm-6":    "arm-linux-gnueabi-gcc",
+	"linux/arm-7":    "arm-linux-gnueabihf-gcc",
+	"linux/arm64":    "aarch64-linux-gnu-gcc",
+	"linux/mips64":   "mips64-linux-gnuabi64-gcc",
+	"linux/mips64le": "mips64el-linux-gnuabi64-gcc",
+	"linux/mips":     "mips-linux-gnu-gcc",
+	"linux/mipsle":   "mipsel-linux-gnu-gcc",
+	"linux/ppc64le":  "powerpc64le-linux-gnu-gcc",
+	"linux/riscv64":  "riscv64-linux-gnu-gcc",
+	"linux/s390x":    "s390x-linux-gnu-gcc",
+	"windows/amd64":  "x86_64-w64-mingw32-gcc",
+	"windows/386":    "i686-w64-mingw32-gcc",
+	"darwin/amd64":   "o64-clang",
+	"darwin/arm64":   "o64-clang",
+	"android/arm64":  "aarch64-linux-android21-clang",
+	"android/amd64":  "x86_64-linux-android21-clang",
+	"android/arm-7":  "armv7a-linux-androideabi21-clang",
+	"android/386":    "i686-linux-android21-clang",
+	"ios/arm64":      "clang",
+
+	"linux/amd64-musl":   "x86_64-linux-musl-gcc",
+	"linux/386-musl":     "i686-linux-musl-gcc",
+	"linux/arm-5-musl":   "arm-linux-musleabi-gcc",
+	"linux/arm-6-musl":   "arm-linux-musleabi-gcc",
+	"linux/arm-7-musl":   "arm-linux-musleabihf-gcc",
+	"linux/arm64-musl":   "aarch64-linux-musl-gcc",
+	"linux/ppc64le-musl": "powerpc64le-linux-musl-gcc",
+	"linux/riscv64-musl": "riscv64-linux-musl-gcc",
+	"linux/s390x-musl":   "s390x-linux-musl-gcc",
+}
+
+// TargetInfo describes a target the Go toolchain of a build can build.
+type TargetInfo struct {
+	Target  string `json:"target"`            // Target as requested with --targets, e.g. linux/arm-7
+	OS      string `json:"os"`                // Go operating system
+	Arch    string `json:"arch"`              // Go architecture
+	Variant string `json:"variant,omitempty"` // Variant of the target, e.g. the ARM version
+	CGO     bool   `json:"cgo"`               // Whether the target is built with CGO, pure Go otherwise
+	CC      string `json:"cc,omitempty"`      // C cross compiler of the CGO targets
+	Libc    string `json:"libc,omitempty"`    // C library the CGO targets link against (glibc, musl, msvcrt, libSystem)
+	Profile bool   `json:"profile,omitempty"` // Whether the target is built by a custom target profile
+}
+
+// SupportedTargets lists the targets the Go toolchain of a build configuration
+// can build: the builtin targets with CGO, every other platform of the toolchain
+// without CGO, the musl flavors of the Linux targets and the custom target
+// profiles, the latter overriding the builtin targets they share.
+func SupportedTargets(ctx context.Context, cfg Config) ([]TargetInfo, error) {
+	b, err := newBuilder(ctx, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	missing := b.missingPlatforms()
+
+	var infos []TargetInfo
+	index := make(map[string]int)
+	for _, target := range append(b.platforms(), MuslTargets...) {
+		goos, goarch, variant := targetPlatform(target)
+		if missing(goos + "/" + goarch) {
+			continue
+		}
+		cc := targetCompilers[target]
+		index[target] = len(infos)
+		infos = append(infos, TargetInfo{Target: target, OS: goos, Arch: goarch, Variant: variant, CGO: cc != "", CC: cc, Libc: targetLibc(goos, cc)})
+	}
+	targets := make([]string, 0, len(cfg.Project.Profiles))
+	for target := range cfg.Project.Profiles {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	for _, target := range targets {
+		profile := cfg.Project.Profiles[target]
+		_, _, variant := targetPlatform(target)
+		info := TargetInfo{Target: target, OS: profile.GOOS, Arch: profile.GOARCH, Variant: variant, CGO: true, CC: profile.CC, Libc: targetLibc(profile.GOOS, profile.CC), Profile: true}
+		if i, ok := index[target]; ok {
+			infos[i] = info
+		} else {
+			infos = append(infos, info)
+		}
+	}
+	return infos, nil
+}
+
+// targetLibc guesses the C library a target links against from its C compiler,
+// empty if unknown.
+func targetLibc(goos string, cc string) string {
+	switch {
+	case cc == "":
+		return ""
+	case strings.Contains(cc, "musl"):
+		return "musl"
+	case strings.Contains(cc, "mingw"):
+		return "msvcrt"
+	case goos == "darwin" || goos == "ios":
+		return "libSystem"
+	case goos == "android":
+		return "bionic"
+	case strings.Contains(cc, "-gnu"):
+		return "glibc"
+	}
+	return ""
+}
+
+// unsafeCacheName matches the characters of image references not allowed in the
+// names of the cached platform lists.
+var unsafeCacheName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// platforms returns the concrete targets the wildcard target patterns expand to:
+// the targets of the builtin toolchains, and every other platform the Go
+// toolchain of the build image supports (go tool dist list), built without CGO.
+// The platform lists are cached per image, falling back to the builtin targets
+// if the toolchain can't be queried.
+func (b *builder) platforms() []string {
+	dist, err := b.distList()
+	if err != nil {
+		log.Printf("WARNING: Failed to list the platforms of the Go toolchain, expanding to the builtin targets: %v", err)
+		return Targets
+	}
+	builtin := make(map[string]bool)
+	for _, target := range Targets {
+		goos, goarch, _ := targetPlatform(target)
+		builtin[goos+"/"+goarch] = true
+	}
+	platforms := append(append([]string{}, Targets...), MobileTargets...)
+	for _, platform := range dist {
+		goos, _, _ := targetPlatform(platform)
+		if !builtin[platform] && !sdkPlatforms[goos] {
+			platforms = append(platforms, platform)
+		}
+	}
+	return platforms
+}
+
+// distList lists the platforms supported by the Go toolchain of the build, the
+// one of the image unless building within it or natively, caching them per image
+// digest. Dry runs only consult the cache, not to start any container.
+func (b *builder) distList() ([]string, error) {
+	if b.cfg.Image == "" || b.cfg.Native {
+		out, err := exec.CommandContext(b.ctx, "go", "tool", "dist", "list").Output()
+		if err != nil {
+			return nil, err
+		}
+		return strings.Fields(string(out)), nil
+	}
+	var cache string
+	if dir, err := os.UserCacheDir(); err == nil {
+		key := b.cfg.Image
+		if digest := b.imageDigest(b.cfg.Image); digest != "" {
+			key = digest
+		}
+		cache = filepath.Join(dir, "xgo", "platforms", unsafeCacheName.ReplaceAllString(key, "_"))
+		if blob, err := os.ReadFile(cache); err == nil {
+			return strings.Fields(string(blob)), nil
+		}
+	}
+	if b.cfg.DryRun {
+		return nil, errors.New("not cached yet for the image, dry runs don't query it")
+	}
+	if err := b.checkImagePolicy(b.imageDigest(b.cfg.Image), true); err != nil {
+		return nil, err
+	}
+	out, err := b.command("run", "--rm", "--entrypoint", "go", b.cfg.Image, "tool", "dist", "list").Output()
+	if err != nil {
+		return nil, err
+	}
+	if cache != "" {
+		if err := os.MkdirAll(filepath.Dir(cache), 0755); err == nil {
+			os.WriteFile(cache, out, 0644)
+		}
+	}
+	return strings.Fields(string(out)), nil
+}
@@ -0,0 +1,189 @@
+package xgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTPClient is the HTTP client used for all downloads. Its dialer races the
+// IPv6 and IPv4 addresses of a host (happy eyeballs) and gives up on stalled
+// connections, so downloads don't hang on single stack (e.g. IPv6-only) hosts.
+var HTTPClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:       30 * time.Second,
+			KeepAlive:     30 * time.Second,
+			FallbackDelay: 300 * time.Millisecond,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: time.Minute,
+		ExpectContinueTimeout: time.Second,
+	},
+}
+
+const (
+	downloadAttempts = 4               // Number of attempts of a download before giving up
+	downloadWorkers  = 4               // Number of dependencies downloaded concurrently
+	progressInterval = 5 * time.Second // Interval of the download progress reports
+)
+
+// permanentError is a download failure that retrying won't fix, e.g. a 404.
+type permanentError struct{ error }
+
+// download retrieves a remote file into a local path, retrying failed attempts
+// with exponential backoff. The content is downloaded into a .part file renamed
+// once complete, so interrupted downloads are never mistaken for complete ones
+// and are resumed by the next attempt (or run) if the server supports ranges.
+func download(ctx context.Context, url string, path string) error {
+	var err error
+	for attempt := 1; attempt <= downloadAttempts; attempt++ {
+		if attempt > 1 {
+			delay := time.Duration(1<<(attempt-2)) * time.Second
+			log.Printf("WARNING: Download of %s failed (%v), retrying in %v...", url, err, delay)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if err = downloadPart(ctx, url, path+".part"); err == nil {
+			return os.Rename(path+".part", path)
+		}
+		var permanent permanentError
+		if errors.As(err, &permanent) || ctx.Err() != nil {
+			break
+		}
+	}
+	return err
+}
+
+// downloadPart downloads a remote file into a partial file, resuming from its
+// current size if the server serves the rest of it.
+func downloadPart(ctx context.Context, url string, path string) error {
+	var offset int64
+	if info, err := os.Stat(path); err == nil {
+		offset = info.Size()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return permanentError{err}
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	res, err := HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case res.StatusCode == http.StatusPartialContent && strings.HasPrefix(res.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)):
+		log.Printf("INFO: Resuming download of %s at %s", url, FormatSize(offset))
+		flags |= os.O_APPEND
+	case res.StatusCode == http.StatusOK:
+		flags |= os.O_TRUNC
+		offset = 0
+	case res.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		os.Remove(path) // Stale partial file, start over on the next attempt
+		return fmt.Errorf("unexpected status: %s", res.Status)
+	case res.StatusCode >= 400 && res.StatusCode < 500 && res.StatusCode != http.StatusRequestTimeout && res.StatusCode != http.StatusTooManyRequests:
+		return permanentError{fmt.Errorf("unexpected status: %s", res.Status)}
+	default:
+		return fmt.Errorf("unexpected status: %s", res.Status)
+	}
+	out, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return permanentError{err}
+	}
+	total := int64(-1)
+	if res.ContentLength >= 0 {
+		total = offset + res.ContentLength
+	}
+	progress := &progressReader{r: res.Body, url: url, done: offset, total: total, last: time.Now()}
+	if _, err := io.Copy(out, progress); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if total >= 0 && progress.done != total {
+		return fmt.Errorf("truncated download, got %d of %d bytes", progress.done, total)
+	}
+	return nil
+}
+
+// progressReader is an io.Reader periodically logging the progress of a download.
+type progressReader struct {
+	r     io.Reader
+	url   string
+	done  int64     // Bytes downloaded so far, including the resumed ones
+	total int64     // Size of the download, -1 if unknown
+	last  time.Time // Time of the last progress report
+}
+
+// Read implements io.Reader, counting the downloaded bytes.
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.done += int64(n)
+	if time.Since(p.last) >= progressInterval {
+		p.last = time.Now()
+		if p.total > 0 {
+			log.Printf("INFO: Downloading %s: %s of %s (%d%%)", p.url, FormatSize(p.done), FormatSize(p.total), p.done*100/p.total)
+		} else {
+			log.Printf("INFO: Downloading %s: %s", p.url, FormatSize(p.done))
+		}
+	}
+	return n, err
+}
+
+// downloadAll downloads a set of dependencies (url to local path) concurrently,
+// returning the failures of all the downloads.
+func downloadAll(ctx context.Context, downloads [][2]string) error {
+	var (
+		wg     sync.WaitGroup
+		errs   = make([]error, len(downloads))
+		tokens = make(chan struct{}, downloadWorkers)
+	)
+	for i := range downloads {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			tokens <- struct{}{}
+			defer func() { <-tokens }()
+
+			url, path := downloads[i][0], downloads[i][1]
+			if errs[i] = download(ctx, url, path); errs[i] == nil {
+				log.Printf("INFO: New dependency cached: %s.", path)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var failures []string
+	for i, err := range errs {
+		if err != nil {
+			failures = append(failures, downloads[i][0]+": "+err.Error())
+		}
+	}
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package xgo
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// dryRun prints the resolved targets and the exact commands, mounted volumes and
+// environment of the builds instead of running them.
+func (b *builder) dryRun(natives []string) error {
+	config := b.cfg.Project
+
+	if len(natives) > 0 {
+		fmt.Fprintf(b.stdout, "Native targets: %s\n", strings.Join(natives, " "))
+		if len(config.Targets) == 0 {
+			return nil
+		}
+		fmt.Fprintf(b.stdout, "Container targets: %s\n", strings.Join(ExpandTargets(config.Targets), " "))
+	} else {
+		fmt.Fprintf(b.stdout, "Targets: %s\n", strings.Join(ExpandTargets(config.Targets), " "))
+	}
+	for _, variant := range b.cfg.Variants {
+		flags := variant.flags(b.cfg.Flags)
+		fmt.Fprintf(b.stdout, "Feature variant %s: %s\n", variant.Name, shellJoin([]string{"FLAG_TAGS=" + flags.Tags, "FLAG_LDFLAGS=" + flags.LdFlags}))
+	}
+	if len(b.cfg.Secrets) > 0 {
+		fmt.Fprintf(b.stdout, "Secrets: %s (mounted at /run/secrets)\n", strings.Join(b.secretNames(), " "))
+	}
+	if len(b.cfg.Publish) > 0 {
+		fmt.Fprintf(b.stdout, "Publish: %s\n", strings.Join(b.cfg.Publish, " "))
+	}
+	// Builds within an xgo image run the build script directly
+	if b.cfg.Image == "" {
+		fmt.Fprintln(b.stdout, "\nBuild command:")
+		fmt.Fprintf(b.stdout, "  %s\n", shellJoin([]string{"xgo-build", config.CmdPath}))
+		fmt.Fprintln(b.stdout, "Environment:")
+		for _, env := range buildEnv(&config, &b.cfg.Flags) {
+			fmt.Fprintf(b.stdout, "  %s\n", shellJoin([]string{env}))
+		}
+		return nil
+	}
+	if b.remote {
+		fmt.Fprintf(b.stdout, "Remote %s engine: sources and outputs are copied instead of mounted\n", b.runtime)
+	}
+	if b.cfg.Warm && fileExists(filepath.Join(config.ProjectPath, "go.mod")) {
+		conf := config
+		args, err := b.warmArgs(&conf)
+		if err != nil {
+			return err
+		}
+		b.printCommand(b.stdout, "Module warm up command", args)
+	}
+	targets := ExpandTargets(config.Targets)
+	if b.cfg.Parallel <= 1 || len(targets) <= 1 {
+		targets = []string{""}
+	}
+	for _, target := range targets {
+		conf, title := config, "Build command"
+		if target != "" {
+			conf.Targets, title = []string{target}, "Build command ("+target+")"
+		}
+		args, err := b.containerArgs(&conf)
+		if err != nil {
+			return err
+		}
+		b.printCommand(b.stdout, title, append(args, b.cfg.Image, conf.CmdPath))
+	}
+	return nil
+}
+
+// printCommand prints a container engine invocation along with the volumes it
+// mounts and the environment variables it sets.
+func (b *builder) printCommand(w io.Writer, title string, args []string) {
+	args = redact(args)
+	var volumes, env []string
+	for i := 0; i+1 < len(args); i++ {
+		switch args[i] {
+		case "-v":
+			volumes = append(volumes, args[i+1])
+			i++
+		case "-e":
+			env = append(env, args[i+1])
+			i++
+		}
+	}
+	fmt.Fprintf(w, "\n%s:\n  %s\n", title, shellJoin(append([]string{b.runtime}, args...)))
+	if len(volumes) > 0 {
+		fmt.Fprintln(w, "Volumes:")
+		for _, volume := range volumes {
+			fmt.Fprintf(w, "  %s\n", volume)
+		}
+	}
+	if len(env) > 0 {
+		fmt.Fprintln(w, "Environment:")
+		for _, e := range env {
+			fmt.Fprintf(w, "  %s\n", shellJoin([]string{e}))
+		}
+	}
+}
+
+// shellJoin joins command arguments into a string that can be pasted into a
+// POSIX shell, single quoting the arguments containing special characters.
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_=+/.,:@%") == "" {
+			quoted[i] = arg
+		} else {
+			quoted[i] = "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
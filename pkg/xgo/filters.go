@@ -0,0 +1,202 @@
+package xgo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// ArtifactFilter is a step of the post-build pipeline transforming the artifact
+// set, applied to the artifacts matching its pattern before the files rendered
+// from the manifest, the checksums and the publishing. Exactly one action is set.
+type ArtifactFilter struct {
+	Match   string   `yaml:"match" toml:"match"`     // Glob on the artifact paths relative to the bin path, or their names if without a slash
+	Rename  string   `yaml:"rename" toml:"rename"`   // Template of the new name, keeping the folder
+	Move    string   `yaml:"move" toml:"move"`       // Template of the folder to move into, relative to the bin path
+	Exclude bool     `yaml:"exclude" toml:"exclude"` // Remove the artifact
+	Alias   []string `yaml:"alias" toml:"alias"`     // Templates of the paths of copies, relative to the bin path
+
+	templates []*template.Template // Parsed templates of the action
+}
+
+// FilterData are the fields the templates of the artifact filters are executed
+// with.
+type FilterData struct {
+	Name    string // File name of the artifact
+	Stem    string // File name of the artifact without its extension
+	Ext     string // Extension of the artifact (e.g. .exe or .tar.gz)
+	Target  string // Target the artifact was built for, empty if none
+	OS      string // Go operating system of the target
+	Arch    string // Go architecture of the target
+	Variant string // Architecture variant of the target if any
+	Feature string // Feature variant the artifact was built in if any
+	Version string // Version of the project from its latest git tag, 0.0.0 if untagged
+}
+
+// validate checks that the filter has a valid pattern and a single action, and
+// parses its templates.
+func (f *ArtifactFilter) validate() error {
+	if _, err := path.Match(f.Match, ""); f.Match == "" || err != nil {
+		return fmt.Errorf("invalid artifact filter pattern %q", f.Match)
+	}
+	var (
+		actions int
+		sources []string
+	)
+	if f.Rename != "" {
+		actions, sources = actions+1, append(sources, f.Rename)
+	}
+	if f.Move != "" {
+		actions, sources = actions+1, append(sources, f.Move)
+	}
+	if f.Exclude {
+		actions++
+	}
+	if len(f.Alias) > 0 {
+		actions, sources = actions+1, append(sources, f.Alias...)
+	}
+	if actions != 1 {
+		return fmt.Errorf("artifact filter %s needs exactly one of rename, move, exclude or alias", f.Match)
+	}
+	f.templates = nil
+	for _, source := range sources {
+		tmpl, err := template.New("filter").Option("missingkey=error").Parse(source)
+		if err != nil {
+			return fmt.Errorf("invalid template of artifact filter %s: %v", f.Match, err)
+		}
+		f.templates = append(f.templates, tmpl)
+	}
+	return nil
+}
+
+// matches checks whether the filter applies to an artifact, given its path
+// relative to the bin path.
+func (f *ArtifactFilter) matches(rel string) bool {
+	if !strings.Contains(f.Match, "/") {
+		rel = path.Base(rel)
+	}
+	ok, _ := path.Match(f.Match, rel)
+	return ok
+}
+
+// filterArtifacts runs the artifact set through the configured filters, in
+// order, returning the transformed set.
+func (b *builder) filterArtifacts(dir string, artifacts []Artifact) ([]Artifact, error) {
+	version := projectVersion(b.cfg.Project.ProjectPath)
+	for i := range b.cfg.Filters {
+		filter := &b.cfg.Filters[i]
+
+		var filtered []Artifact
+		for j, artifact := range artifacts {
+			rel, err := filepath.Rel(dir, artifact.Path)
+			if err != nil || !filter.matches(filepath.ToSlash(rel)) {
+				filtered = append(filtered, artifact)
+				continue
+			}
+			outputs, err := filter.apply(dir, artifact, newFilterData(artifact, version))
+			filtered = append(filtered, outputs...)
+			if err != nil {
+				return append(filtered, artifacts[j+1:]...), fmt.Errorf("artifact filter %s: %v", filter.Match, err)
+			}
+		}
+		artifacts = filtered
+	}
+	return artifacts, nil
+}
+
+// apply runs the action of the filter on a matching artifact, returning the
+// artifacts it resulted in.
+func (f *ArtifactFilter) apply(dir string, artifact Artifact, data *FilterData) ([]Artifact, error) {
+	if f.Exclude {
+		log.Printf("INFO: Excluding %s", artifact.Path)
+		if err := os.Remove(artifact.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return []Artifact{artifact}, err
+		}
+		return nil, nil
+	}
+	var paths []string
+	for _, tmpl := range f.templates {
+		var out bytes.Buffer
+		if err := tmpl.Execute(&out, data); err != nil {
+			return []Artifact{artifact}, err
+		}
+		paths = append(paths, filepath.FromSlash(strings.TrimSpace(out.String())))
+	}
+	switch {
+	case f.Rename != "":
+		paths[0] = filepath.Join(filepath.Dir(artifact.Path), paths[0])
+	case f.Move != "":
+		paths[0] = filepath.Join(dir, paths[0], data.Name)
+	default:
+		// Copy the artifact under its aliases, keeping the original
+		outputs := []Artifact{artifact}
+		for _, alias := range paths {
+			copied := artifact
+			copied.Path = filepath.Join(dir, alias)
+			if err := duplicateFile(artifact.Path, copied.Path); err != nil {
+				return outputs, err
+			}
+			log.Printf("INFO: Aliased %s as %s", artifact.Path, copied.Path)
+			outputs = append(outputs, copied)
+		}
+		return outputs, nil
+	}
+	if paths[0] == artifact.Path {
+		return []Artifact{artifact}, nil
+	}
+	if err := moveFile(artifact.Path, paths[0]); err != nil {
+		return []Artifact{artifact}, err
+	}
+	log.Printf("INFO: Moved %s to %s", artifact.Path, paths[0])
+	artifact.Path = paths[0]
+	return []Artifact{artifact}, nil
+}
+
+// newFilterData assembles the template fields of an artifact.
+func newFilterData(artifact Artifact, version string) *FilterData {
+	name := filepath.Base(artifact.Path)
+	ext := filepath.Ext(name)
+	if strings.HasSuffix(name, ".tar"+ext) {
+		ext = ".tar" + ext
+	}
+	data := &FilterData{
+		Name:    name,
+		Stem:    strings.TrimSuffix(name, ext),
+		Ext:     ext,
+		Target:  artifact.Target,
+		Feature: artifact.Feature,
+		Version: version,
+	}
+	data.OS, data.Arch, data.Variant = targetPlatform(artifact.Target)
+	return data
+}
+
+// duplicateFile copies a file to a new location, hard linking it if possible.
+func duplicateFile(src string, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	os.Remove(dst)
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode())
+	if err != nil {
+		return err
+	}
+	if err := copyFile(out, src); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,247 @@
+package xgo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// errForgeNotFound is returned by the forge APIs for missing resources.
+var errForgeNotFound = errors.New("not found")
+
+// forgeRequest sends a request to the REST API of a forge, decoding its JSON
+// response into out if given.
+func forgeRequest(ctx context.Context, method string, endpoint string, header http.Header, body io.Reader, size int64, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	res, err := HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return errForgeNotFound
+	case res.StatusCode/100 != 2:
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("%s %s: unexpected status %s\n%s", method, req.URL.Path, res.Status, strings.TrimSpace(string(msg)))
+	case out != nil:
+		return json.NewDecoder(res.Body).Decode(out)
+	}
+	return nil
+}
+
+// forgeJSON sends a JSON encoded request to the REST API of a forge.
+func forgeJSON(ctx context.Context, method string, endpoint string, header http.Header, in interface{}, out interface{}) error {
+	blob, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	header = header.Clone()
+	header.Set("Content-Type", "application/json")
+	return forgeRequest(ctx, method, endpoint, header, bytes.NewReader(blob), int64(len(blob)), out)
+}
+
+// forgeBaseURL converts a forge host, with or without scheme, into its base URL.
+func forgeBaseURL(host string) string {
+	host = strings.TrimSuffix(host, "/")
+	if !strings.HasPrefix(host, "http://") && !strings.HasPrefix(host, "https://") {
+		host = "https://" + host
+	}
+	return host
+}
+
+// gitLabPackagesPublisher uploads the artifacts into the generic package
+// registry of a GitLab project, as the files of the project version of a
+// package (GITLAB_TOKEN or CI_JOB_TOKEN, GITLAB_HOST).
+type gitLabPackagesPublisher struct {
+	api     string      // Base URL of the GitLab API (e.g. https://gitlab.com/api/v4)
+	project string      // Project to publish the package in (group/project, subgroups allowed)
+	name    string      // Name of the package, the project name if not given
+	header  http.Header // Token header of the API requests
+}
+
+func newGitLabPackagesPublisher(dest string) (Publisher, error) {
+	project, name := dest, ""
+	if idx := strings.LastIndex(dest, ":"); idx >= 0 {
+		project, name = dest[:idx], dest[idx+1:]
+	}
+	if !strings.Contains(project, "/") || strings.HasPrefix(project, "/") || strings.HasSuffix(project, "/") {
+		return nil, errors.New("destination must be a GitLab project (group/project[:package])")
+	}
+	if name == "" {
+		name = project[strings.LastIndex(project, "/")+1:]
+	}
+	p := &gitLabPackagesPublisher{api: gitLabAPI(), project: project, name: name, header: make(http.Header)}
+	switch {
+	case os.Getenv("GITLAB_TOKEN") != "":
+		p.header.Set("PRIVATE-TOKEN", os.Getenv("GITLAB_TOKEN"))
+	case os.Getenv("CI_JOB_TOKEN") != "":
+		p.header.Set("JOB-TOKEN", os.Getenv("CI_JOB_TOKEN"))
+	default:
+		return nil, errors.New("no GitLab token, set GITLAB_TOKEN or run in a GitLab CI job")
+	}
+	return p, nil
+}
+
+// gitLabAPI returns the base URL of the GitLab API: the one of the CI job if
+// running in GitLab CI, else the one of GITLAB_HOST, gitlab.com if unset.
+func gitLabAPI() string {
+	if api := os.Getenv("CI_API_V4_URL"); api != "" {
+		return strings.TrimSuffix(api, "/")
+	}
+	if host := os.Getenv("GITLAB_HOST"); host != "" {
+		return forgeBaseURL(host) + "/api/v4"
+	}
+	return "https://gitlab.com/api/v4"
+}
+
+func (p *gitLabPackagesPublisher) Publish(ctx context.Context, manifest *Manifest) error {
+	// The package files are flat, so the artifacts are published by name
+	seen := make(map[string]string)
+	for _, artifact := range manifest.Artifacts {
+		if other, ok := seen[artifact.Name]; ok {
+			return fmt.Errorf("artifacts %s and %s share the package file name %s", other, artifact.Path, artifact.Name)
+		}
+		seen[artifact.Name] = artifact.Path
+	}
+	base := fmt.Sprintf("%s/projects/%s/packages/generic/%s/%s/", p.api, url.PathEscape(p.project), url.PathEscape(p.name), url.PathEscape(manifest.Version))
+	for _, artifact := range manifest.Artifacts {
+		if err := p.upload(ctx, base+url.PathEscape(artifact.Name), filepath.Join(manifest.Dir, filepath.FromSlash(artifact.Path))); err != nil {
+			return fmt.Errorf("failed to upload %s: %v", artifact.Path, err)
+		}
+	}
+	return nil
+}
+
+func (p *gitLabPackagesPublisher) upload(ctx context.Context, endpoint string, path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	return forgeRequest(ctx, http.MethodPut, endpoint, p.header, in, info.Size(), nil)
+}
+
+// giteaPublisher uploads the artifacts as the assets of the Gitea (or Forgejo)
+// release of the project tag, creating the release with its notes if missing
+// and replacing the assets of the same names (GITEA_TOKEN).
+type giteaPublisher struct {
+	api    string      // Base URL of the repository API (e.g. https://codeberg.org/api/v1/repos/owner/repo)
+	header http.Header // Token header of the API requests
+}
+
+// giteaRelease is the subset of a Gitea release the publisher needs.
+type giteaRelease struct {
+	ID     int64 `json:"id"`
+	Assets []struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	} `json:"assets"`
+}
+
+func newGiteaPublisher(dest string) (Publisher, error) {
+	scheme, rest := "", dest
+	for _, prefix := range []string{"https://", "http://"} {
+		if strings.HasPrefix(rest, prefix) {
+			scheme, rest = prefix, strings.TrimPrefix(rest, prefix)
+		}
+	}
+	parts := strings.Split(strings.Trim(rest, "/"), "/")
+	if len(parts) < 3 || parts[len(parts)-2] == "" || parts[len(parts)-1] == "" {
+		return nil, errors.New("destination must be a Gitea repository (host/owner/repo)")
+	}
+	host, repo := scheme+strings.Join(parts[:len(parts)-2], "/"), strings.Join(parts[len(parts)-2:], "/")
+
+	token := os.Getenv("GITEA_TOKEN")
+	if token == "" {
+		return nil, errors.New("no Gitea token, set GITEA_TOKEN")
+	}
+	header := make(http.Header)
+	header.Set("Authorization", "token "+token)
+	return &giteaPublisher{api: forgeBaseURL(host) + "/api/v1/repos/" + repo, header: header}, nil
+}
+
+func (p *giteaPublisher) Publish(ctx context.Context, manifest *Manifest) error {
+	if manifest.Tag == "" {
+		return errors.New("no git tag to publish a release for")
+	}
+	release := new(giteaRelease)
+	err := forgeRequest(ctx, http.MethodGet, p.api+"/releases/tags/"+url.PathEscape(manifest.Tag), p.header, nil, 0, release)
+	switch {
+	case errors.Is(err, errForgeNotFound):
+		create := map[string]string{"tag_name": manifest.Tag, "name": manifest.Tag, "body": manifest.Notes}
+		if err := forgeJSON(ctx, http.MethodPost, p.api+"/releases", p.header, create, release); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	case manifest.Notes != "":
+		edit := map[string]string{"body": manifest.Notes}
+		if err := forgeJSON(ctx, http.MethodPatch, fmt.Sprintf("%s/releases/%d", p.api, release.ID), p.header, edit, nil); err != nil {
+			return err
+		}
+	}
+	for _, artifact := range manifest.Artifacts {
+		for _, asset := range release.Assets {
+			if asset.Name != artifact.Name {
+				continue
+			}
+			if err := forgeRequest(ctx, http.MethodDelete, fmt.Sprintf("%s/releases/%d/assets/%d", p.api, release.ID, asset.ID), p.header, nil, 0, nil); err != nil {
+				return fmt.Errorf("failed to replace %s: %v", artifact.Name, err)
+			}
+		}
+		if err := p.upload(ctx, release.ID, artifact.Name, filepath.Join(manifest.Dir, filepath.FromSlash(artifact.Path))); err != nil {
+			return fmt.Errorf("failed to upload %s: %v", artifact.Path, err)
+		}
+	}
+	return nil
+}
+
+// upload attaches a file to a release as a multipart form, streamed from disk
+// with a known length.
+func (p *giteaPublisher) upload(ctx context.Context, id int64, name string, path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	var head, tail bytes.Buffer
+	form := multipart.NewWriter(&head)
+	if _, err := form.CreateFormFile("attachment", name); err != nil {
+		return err
+	}
+	tail.WriteString("\r\n--" + form.Boundary() + "--\r\n")
+
+	header := p.header.Clone()
+	header.Set("Content-Type", form.FormDataContentType())
+	body := io.MultiReader(&head, in, &tail)
+	size := int64(head.Len()) + info.Size() + int64(tail.Len())
+	return forgeRequest(ctx, http.MethodPost, fmt.Sprintf("%s/releases/%d/assets?name=%s", p.api, id, url.QueryEscape(name)), header, body, size, nil)
+}
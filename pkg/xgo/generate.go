@@ -0,0 +1,183 @@
+package xgo
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Built-in generators, running the conventional commands of the CLI frameworks
+// and storing their outputs in the conventional layout of the packages.
+const (
+	GenerateCompletion = "completion" // Bash, zsh and fish completions (completion <shell>, as with Cobra) in completions/
+	GenerateMan        = "man"        // Man page printed by the man command in man/man1/<name>.1
+)
+
+// Generator is a command run with a freshly built binary to generate files to
+// bundle into the packages, e.g. shell completions or man pages.
+type Generator struct {
+	Mode   string   `yaml:"mode" toml:"mode"`     // Built-in generator (completion or man), empty for a custom one
+	Args   []string `yaml:"args" toml:"args"`     // Arguments to run the binary with, e.g. completion bash, the command of the built-in generators if set
+	Output string   `yaml:"output" toml:"output"` // File to store the standard output in, relative to the package root
+}
+
+// validate checks the mode of a generator and that custom ones run something.
+func (g *Generator) validate() error {
+	switch g.Mode {
+	case GenerateCompletion, GenerateMan:
+		return nil
+	case "":
+		if len(g.Args) == 0 {
+			return errors.New("generator without mode nor arguments")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown generator mode %q, must be %s or %s", g.Mode, GenerateCompletion, GenerateMan)
+	}
+}
+
+// commands expands a generator into the commands to run for a binary of the
+// given name: one per shell for the completions, storing each in its
+// conventional file, the man page in man/man1/<name>.1 unless another output is
+// given, and custom generators as is.
+func (g *Generator) commands(name string) []Generator {
+	switch g.Mode {
+	case GenerateCompletion:
+		command := g.Args
+		if len(command) == 0 {
+			command = []string{"completion"}
+		}
+		var gens []Generator
+		for _, shell := range []struct{ name, output string }{
+			{"bash", "completions/" + name + ".bash"},
+			{"zsh", "completions/_" + name},
+			{"fish", "completions/" + name + ".fish"},
+		} {
+			args := append(append([]string{}, command...), shell.name)
+			gens = append(gens, Generator{Args: args, Output: shell.output})
+		}
+		return gens
+	case GenerateMan:
+		gen := Generator{Args: g.Args, Output: g.Output}
+		if len(gen.Args) == 0 {
+			gen.Args = []string{"man"}
+		}
+		if gen.Output == "" {
+			gen.Output = "man/man1/" + name + ".1"
+		}
+		return []Generator{gen}
+	default:
+		return []Generator{*g}
+	}
+}
+
+// generate runs the generators with a binary runnable on the host for each of
+// the output names, natively if built for the host or under QEMU user mode
+// emulation if built for linux/amd64. The generated files are stored within the
+// given folder and returned keyed by the name of the outputs they belong to.
+func (b *builder) generate(artifacts []Artifact, root string) (map[string][]PackageFile, error) {
+	host := runtime.GOOS + "/" + runtime.GOARCH
+
+	// Pick the binary to generate with of each output name
+	runners := make(map[string]Artifact)
+	for _, artifact := range artifacts {
+		if artifact.Target == "" || strings.HasSuffix(artifact.Path, ".h") || strings.HasSuffix(artifact.Path, ".a") {
+			continue
+		}
+		name := packagedName(artifact)
+		name = strings.TrimSuffix(name, outputExt(name))
+		switch {
+		case matchTarget(host, artifact.Target):
+			runners[name] = artifact
+		case artifact.Target == "linux/amd64":
+			if _, ok := runners[name]; !ok {
+				runners[name] = artifact
+			}
+		}
+	}
+	if len(runners) == 0 {
+		log.Printf("WARNING: No binary built for %s or linux/amd64 to run the generators with", host)
+	}
+	generated := make(map[string][]PackageFile)
+	for name, runner := range runners {
+		dir := filepath.Join(root, name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+
+		var gens []Generator
+		for i := range b.cfg.Generate {
+			gens = append(gens, b.cfg.Generate[i].commands(name)...)
+		}
+		for _, gen := range gens {
+			cmd, err := generatorCommand(runner, host, gen.Args)
+			if err != nil {
+				return nil, err
+			}
+			cmd.Dir, cmd.Stderr = dir, b.stderr
+
+			log.Printf("INFO: Running generator %s %s", filepath.Base(runner.Path), strings.Join(gen.Args, " "))
+			if gen.Output != "" {
+				path := filepath.Join(dir, filepath.FromSlash(gen.Output))
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					return nil, err
+				}
+				out, err := os.Create(path)
+				if err != nil {
+					return nil, err
+				}
+				cmd.Stdout = out
+				err = cmd.Run()
+				out.Close()
+				if err != nil {
+					return nil, fmt.Errorf("failed to generate %s: %v", gen.Output, err)
+				}
+			} else {
+				cmd.Stdout = b.stdout
+				if err := cmd.Run(); err != nil {
+					return nil, fmt.Errorf("failed to run generator %s: %v", strings.Join(gen.Args, " "), err)
+				}
+			}
+		}
+		// Collect everything the generators produced
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			generated[name] = append(generated[name], PackageFile{Path: path, Name: filepath.ToSlash(rel), Doc: true})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return generated, nil
+}
+
+// generatorCommand creates the command running a binary with the arguments of a
+// generator, emulating it via QEMU if it wasn't built for the host.
+func generatorCommand(runner Artifact, host string, args []string) (*exec.Cmd, error) {
+	if matchTarget(host, runner.Target) {
+		return exec.Command(runner.Path, args...), nil
+	}
+	if runtime.GOOS != "linux" {
+		return nil, fmt.Errorf("no binary built for %s to run the generators with", host)
+	}
+	qemu, err := exec.LookPath("qemu-x86_64")
+	if err != nil {
+		qemu, err = exec.LookPath("qemu-x86_64-static")
+	}
+	if err != nil {
+		return nil, errors.New("running the linux/amd64 binary for the generators requires qemu-x86_64 to be installed")
+	}
+	return exec.Command(qemu, append([]string{runner.Path}, args...)...), nil
+}
@@ -0,0 +1,135 @@
+package xgo
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// gitConfigScript sets up the forwarded git configuration within a build
+// container: the host files are included into the global configuration of the
+// container, the credential helpers of the host (which can't run within it)
+// being replaced by the credentials they resolved, if any.
+const gitConfigScript = `if [ -n "$GIT_CONFIG_INCLUDES" ] || [ -n "$GITCONFIG_DATA" ] || [ -n "$GIT_CREDENTIALS_DATA" ]; then
+  for f in $GIT_CONFIG_INCLUDES; do git config --global --add include.path "$f"; done
+  if [ -n "$GITCONFIG_DATA" ]; then
+    (umask 077 && printf '%s\n' "$GITCONFIG_DATA" > ~/.gitconfig-host)
+    git config --global --add include.path ~/.gitconfig-host
+  fi
+  git config --global --add credential.helper ""
+  if [ -n "$GIT_CREDENTIALS_DATA" ]; then
+    (umask 077 && printf '%s\n' "$GIT_CREDENTIALS_DATA" > ~/.git-credentials)
+    git config --global --add credential.helper store
+  fi
+fi
+unset GITCONFIG_DATA GIT_CREDENTIALS_DATA`
+
+// gitConfigPaths lists the global git configuration files of the host: the
+// user's one ($GIT_CONFIG_GLOBAL or ~/.gitconfig) and the XDG one.
+func gitConfigPaths() []string {
+	var paths []string
+	home, _ := os.UserHomeDir()
+	if path := os.Getenv("GIT_CONFIG_GLOBAL"); path != "" {
+		paths = append(paths, path)
+	} else if home != "" {
+		paths = append(paths, filepath.Join(home, ".gitconfig"))
+	}
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		paths = append(paths, filepath.Join(dir, "git", "config"))
+	} else if home != "" {
+		paths = append(paths, filepath.Join(home, ".config", "git", "config"))
+	}
+	var found []string
+	for _, path := range paths {
+		if fileExists(path) {
+			found = append(found, path)
+		}
+	}
+	return found
+}
+
+// gitConfigArgs assembles the container arguments forwarding the git
+// configuration of the host into a build container, so that its URL rewrites
+// (url.<base>.insteadOf) and credentials apply to the private modules. The files
+// are mounted read-only where possible, their content only being injected on
+// remote engines. The credentials of the private module hosts (GOPRIVATE) are
+// resolved by the credential helpers of the host, as they can't run within the
+// container, except for dry runs.
+func (b *builder) gitConfigArgs() ([]string, error) {
+	var (
+		args     []string
+		includes []string
+		content  []string
+	)
+	for i, path := range gitConfigPaths() {
+		if !b.remote {
+			include := fmt.Sprintf("/xgo-git/config-%d", i)
+			args = append(args, "-v", volume(path, include, "ro"))
+			includes = append(includes, include)
+			continue
+		}
+		blob, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read git config: %v", err)
+		}
+		content = append(content, string(blob))
+	}
+	if len(includes) > 0 {
+		args = append(args, "-e", "GIT_CONFIG_INCLUDES="+strings.Join(includes, " "))
+	}
+	if len(content) > 0 {
+		args = append(args, "-e", "GITCONFIG_DATA="+strings.Join(content, "\n"))
+	}
+	if !b.cfg.DryRun {
+		if credentials := b.gitCredentials(privateHosts(b.cfg.GoPrivate)); len(credentials) > 0 {
+			args = append(args, "-e", "GIT_CREDENTIALS_DATA="+strings.Join(credentials, "\n"))
+		}
+	}
+	return args, nil
+}
+
+// gitCredentials asks the credential helpers of the host for the credentials of
+// the given hosts, returning them in the format of the git credential store.
+// Hosts without credentials are skipped, the helpers never prompting for any.
+func (b *builder) gitCredentials(hosts []string) []string {
+	var credentials []string
+	for _, host := range hosts {
+		cmd := exec.CommandContext(b.ctx, "git", "credential", "fill")
+		cmd.Stdin = strings.NewReader("protocol=https\nhost=" + host + "\n\n")
+		cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GCM_INTERACTIVE=never")
+		out, err := cmd.Output()
+		if err != nil {
+			continue
+		}
+		values := make(map[string]string)
+		scanner := bufio.NewScanner(strings.NewReader(string(out)))
+		for scanner.Scan() {
+			if parts := strings.SplitN(scanner.Text(), "=", 2); len(parts) == 2 {
+				values[parts[0]] = parts[1]
+			}
+		}
+		if values["username"] == "" || values["password"] == "" {
+			continue
+		}
+		u := url.URL{Scheme: "https", Host: host, User: url.UserPassword(values["username"], values["password"])}
+		credentials = append(credentials, u.String())
+	}
+	return credentials
+}
+
+// privateHosts extracts the hosts of the private module path patterns, skipping
+// the patterns with globs in their host.
+func privateHosts(patterns string) []string {
+	var hosts []string
+	for _, pattern := range strings.Split(patterns, ",") {
+		host := strings.SplitN(strings.TrimSpace(pattern), "/", 2)[0]
+		if host != "" && !strings.ContainsAny(host, "*?[") {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
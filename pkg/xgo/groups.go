@@ -0,0 +1,82 @@
+package xgo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TargetGroups are the built-in named groups of targets, usable in the target
+// patterns in place of the targets they stand for (e.g. desktop,!windows/*).
+var TargetGroups = map[string][]string{
+	"desktop": {"linux/amd64", "linux/arm64", "darwin/amd64", "darwin/arm64", "windows/amd64", "windows/arm64"},
+	"server":  {"linux/amd64", "linux/arm64", "linux/ppc64le", "linux/s390x", "linux/riscv64", "freebsd/amd64"},
+	"mobile":  {"android/arm64", "android/amd64", "ios/arm64"},
+	"bsd":     {"freebsd/*", "netbsd/*", "openbsd/*", "dragonfly/*"},
+}
+
+// expandGroups replaces the group names among the target patterns by the
+// patterns of their groups, the given user defined groups taking precedence
+// over the built-in ones and possibly referencing other groups. Excluded groups
+// exclude all their patterns, leaving out their own exclusions. Names of neither a group nor a target profile are
+// rejected, not to hand them to the build script.
+func expandGroups(patterns []string, groups map[string][]string, profiles map[string]*TargetProfile) ([]string, error) {
+	var (
+		expanded []string
+		expand   func(pattern string, negate bool, seen []string) error
+	)
+	expand = func(pattern string, negate bool, seen []string) error {
+		if pattern = strings.TrimSpace(pattern); strings.HasPrefix(pattern, "!") {
+			if negate {
+				return nil
+			}
+			pattern, negate = strings.TrimPrefix(pattern, "!"), true
+		}
+		if pattern == "" || strings.Contains(pattern, "/") || profiles[pattern] != nil {
+			if pattern != "" && negate {
+				pattern = "!" + pattern
+			}
+			expanded = append(expanded, pattern)
+			return nil
+		}
+		group, ok := groups[pattern]
+		if !ok {
+			group, ok = TargetGroups[pattern]
+		}
+		if !ok {
+			return fmt.Errorf("unknown target or target group %s, known groups: %s", pattern, strings.Join(groupNames(groups), ", "))
+		}
+		for _, name := range seen {
+			if name == pattern {
+				return fmt.Errorf("target group %s includes itself", pattern)
+			}
+		}
+		for _, member := range group {
+			if err := expand(member, negate, append(seen, pattern)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, pattern := range patterns {
+		if err := expand(pattern, false, nil); err != nil {
+			return nil, err
+		}
+	}
+	return expanded, nil
+}
+
+// groupNames lists the names of the built-in and the given target groups.
+func groupNames(groups map[string][]string) []string {
+	var names []string
+	for name := range TargetGroups {
+		names = append(names, name)
+	}
+	for name := range groups {
+		if _, ok := TargetGroups[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
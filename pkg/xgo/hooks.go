@@ -0,0 +1,29 @@
+package xgo
+
+import (
+	"context"
+	"fmt"
+)
+
+// Stages of a build after which hooks can be run, letting embedders interleave
+// their own steps (e.g. tests of the binaries) with the ones of xgo.
+const (
+	StageBuild   = "build"   // Outputs compiled, verified and moved into their folders
+	StagePackage = "package" // Packages, rendered files and checksum files written
+)
+
+// Hook is run once a build stage is done, with the artifacts produced so far. An
+// error fails the build, skipping the stages left.
+type Hook func(ctx context.Context, artifacts []Artifact) error
+
+// runHook runs the hook of a build stage if any.
+func (b *builder) runHook(stage string, artifacts []Artifact) error {
+	hook := b.cfg.Hooks[stage]
+	if hook == nil {
+		return nil
+	}
+	if err := hook(b.ctx, artifacts); err != nil {
+		return fmt.Errorf("%s hook failed: %v", stage, err)
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package xgo
+
+import (
+	"archive/tar"
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFile is the file of a project listing the patterns of the files kept out
+// of the build containers, in the .gitignore syntax.
+const IgnoreFile = ".xgoignore"
+
+// ignoreRule is a single pattern of an ignore file.
+type ignoreRule struct {
+	pattern  string // Slash separated glob, ** matching any number of folders
+	negate   bool   // Whether the pattern re-includes the files (!pattern)
+	dirOnly  bool   // Whether the pattern only matches folders (pattern/)
+	anchored bool   // Whether the pattern matches from the project root, else at any depth
+}
+
+// sourceFilter is the set of ignore rules of a project, the last matching rule
+// deciding whether a file is ignored.
+type sourceFilter struct {
+	rules []ignoreRule
+}
+
+// loadSourceFilter reads the ignore file of a project, followed by the extra
+// patterns given, returning nil if there are no patterns at all.
+func loadSourceFilter(project string, patterns []string) (*sourceFilter, error) {
+	var lines []string
+	file, err := os.Open(filepath.Join(project, IgnoreFile))
+	switch {
+	case err == nil:
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		file.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", IgnoreFile, err)
+		}
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+	filter := new(sourceFilter)
+	for _, line := range append(lines, patterns...) {
+		if line = strings.TrimSpace(line); line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var rule ignoreRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate, line = true, line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly, line = true, strings.TrimRight(line, "/")
+		}
+		if strings.HasPrefix(line, "**/") {
+			line = line[3:]
+		}
+		rule.anchored = strings.Contains(line, "/")
+		rule.pattern = strings.TrimPrefix(line, "/")
+		if rule.pattern == "" {
+			continue
+		}
+		if _, err := path.Match(strings.Replace(rule.pattern, "**", "*", -1), ""); err != nil {
+			return nil, fmt.Errorf("invalid ignore pattern %q: %v", line, err)
+		}
+		filter.rules = append(filter.rules, rule)
+	}
+	if len(filter.rules) == 0 {
+		return nil, nil
+	}
+	return filter, nil
+}
+
+// ignored checks whether a file of the project, given by its slash separated
+// path relative to the project root, is to be kept out of the build containers.
+func (f *sourceFilter) ignored(rel string, dir bool) bool {
+	ignored := false
+	for _, rule := range f.rules {
+		if rule.dirOnly && !dir {
+			continue
+		}
+		var match bool
+		if rule.anchored {
+			match = globMatch(strings.Split(rule.pattern, "/"), strings.Split(rel, "/"))
+		} else {
+			match, _ = path.Match(rule.pattern, path.Base(rel))
+		}
+		if match {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// globMatch matches the segments of a path against the segments of a pattern,
+// ** segments matching any number of path segments.
+func globMatch(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if globMatch(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
+
+// writeSourceTar streams the files of the project not ignored by the filter as
+// a tar archive, rooted at the given folder name. Ignored folders are skipped as
+// a whole, their files not being re-includable. The number of ignored files and
+// folders is returned.
+func writeSourceTar(w io.Writer, project string, root string, filter *sourceFilter) (int, error) {
+	tw := tar.NewWriter(w)
+	skipped := 0
+	err := filepath.Walk(project, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(project, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel != "." && filter.ignored(rel, info.IsDir()) {
+			skipped++
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(file); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = path.Join(root, rel)
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		src, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		_, err = io.Copy(tw, src)
+		return err
+	})
+	if err != nil {
+		return skipped, err
+	}
+	return skipped, tw.Close()
+}
+
+// copySource copies the project sources, without the ignored files, into the
+// given folder of a created build container, streaming them as a tar archive.
+func (b *builder) copySource(id string, project string, dest string) error {
+	reader, writer := io.Pipe()
+	cmd := b.command("cp", "-", id+":/")
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = reader, b.stdout, b.stderr
+
+	var (
+		skipped  int
+		archived = make(chan error, 1)
+	)
+	go func() {
+		n, err := writeSourceTar(writer, project, strings.TrimPrefix(dest, "/"), b.ignore)
+		skipped = n
+		writer.CloseWithError(err)
+		archived <- err
+	}()
+	err := cmd.Run()
+	reader.CloseWithError(io.ErrClosedPipe) // Unblock the archiver if the copy failed early
+
+	if aerr := <-archived; aerr != nil && aerr != io.ErrClosedPipe {
+		return fmt.Errorf("failed to archive sources: %v", aerr)
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("INFO: Copied %s into build container folder %s, ignoring %d entries", project, dest, skipped)
+	return nil
+}
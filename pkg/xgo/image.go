@@ -0,0 +1,50 @@
+package xgo
+
+import (
+	"strings"
+)
+
+// splitImage splits an image reference into its repository, tag and digest, e.g.
+// ghcr.io/crazy-max/xgo:1.21.x@sha256:abcd into ghcr.io/crazy-max/xgo, 1.21.x
+// and sha256:abcd. The tag and digest are empty if not specified.
+func splitImage(image string) (repo string, tag string, digest string) {
+	if idx := strings.Index(image, "@"); idx >= 0 {
+		image, digest = image[:idx], image[idx+1:]
+	}
+	if idx := strings.LastIndex(image, ":"); idx > strings.LastIndex(image, "/") {
+		image, tag = image[:idx], image[idx+1:]
+	}
+	return image, tag, digest
+}
+
+// imageDigest resolves the content digest of a local image: the pinned digest of
+// digest references, the registry digest of pulled images or the image ID of the
+// images built locally (which have no registry digest).
+func (b *builder) imageDigest(image string) string {
+	repo, _, digest := splitImage(image)
+	if digest != "" {
+		return digest
+	}
+	out, err := b.command("image", "inspect", "--format", "{{range .RepoDigests}}{{println .}}{{end}}", image).Output()
+	if err != nil {
+		return ""
+	}
+	var fallback string
+	for _, ref := range strings.Fields(string(out)) {
+		name, _, digest := splitImage(ref)
+		if name == repo {
+			return digest
+		}
+		if fallback == "" {
+			fallback = digest
+		}
+	}
+	if fallback != "" {
+		return fallback
+	}
+	out, err = b.command("image", "inspect", "--format", "{{.Id}}", image).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
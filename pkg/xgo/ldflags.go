@@ -0,0 +1,93 @@
+package xgo
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// LdFlagsData is the data the linker flags are executed with as templates, e.g.
+// -X main.version={{.Version}} -X main.commit={{.Commit}}.
+type LdFlagsData struct {
+	Version    string // Version of the project from its latest git tag, 0.0.0 if untagged
+	Tag        string // Latest git tag of the project, empty if untagged
+	Describe   string // Most recent tag, commits since and dirty flag (git describe --tags --always --dirty), e.g. v1.2.3-4-gabcdef0
+	Commit     string // Short git commit of the project, empty if not a repository
+	FullCommit string // Full git commit of the project, empty if not a repository
+	Branch     string // Current git branch of the project, empty if detached or not a repository
+	Dirty      bool   // Whether the project has uncommitted changes
+	Date       string // Build date in RFC 3339 format, the SOURCE_DATE_EPOCH if set
+	CommitDate string // Date of the last commit in RFC 3339 format, empty if not a repository
+}
+
+// ldFlagsData resolves the linker flags template data of a project from git.
+func ldFlagsData(project string, epoch string) *LdFlagsData {
+	date := epochTime(epoch)
+	if date.IsZero() {
+		date = time.Now().UTC()
+	}
+	data := &LdFlagsData{
+		Version:    projectVersion(project),
+		Tag:        gitOutput(project, "describe", "--tags", "--abbrev=0"),
+		Describe:   gitOutput(project, "describe", "--tags", "--always", "--dirty"),
+		Commit:     gitOutput(project, "rev-parse", "--short", "HEAD"),
+		FullCommit: gitOutput(project, "rev-parse", "HEAD"),
+		Branch:     gitOutput(project, "symbolic-ref", "--short", "-q", "HEAD"),
+		Dirty:      gitOutput(project, "status", "--porcelain") != "",
+		Date:       date.Format(time.RFC3339),
+	}
+	if commit := epochTime(gitOutput(project, "log", "-1", "--format=%ct")); !commit.IsZero() {
+		data.CommitDate = commit.Format(time.RFC3339)
+	}
+	return data
+}
+
+// templateLdFlags executes the global and overridden linker flags as templates
+// with the version metadata of the project, resolved once for all targets. Flags
+// without any template action are left untouched, git not even being queried.
+func templateLdFlags(project string, flags BuildFlags) (BuildFlags, error) {
+	templated := strings.Contains(flags.LdFlags, "{{")
+	for _, o := range flags.Overrides {
+		templated = templated || strings.Contains(o.LdFlags, "{{")
+	}
+	if !templated {
+		return flags, nil
+	}
+	data := ldFlagsData(project, flags.Epoch)
+
+	var err error
+	if flags.LdFlags, err = executeLdFlags(flags.LdFlags, data); err != nil {
+		return flags, err
+	}
+	overrides := make(map[string]*TargetOverride, len(flags.Overrides))
+	for pattern, o := range flags.Overrides {
+		if strings.Contains(o.LdFlags, "{{") {
+			copied := *o
+			if copied.LdFlags, err = executeLdFlags(o.LdFlags, data); err != nil {
+				return flags, fmt.Errorf("override %s: %v", pattern, err)
+			}
+			o = &copied
+		}
+		overrides[pattern] = o
+	}
+	flags.Overrides = overrides
+	return flags, nil
+}
+
+// executeLdFlags executes a linker flags template with the given data.
+func executeLdFlags(ldflags string, data *LdFlagsData) (string, error) {
+	if !strings.Contains(ldflags, "{{") {
+		return ldflags, nil
+	}
+	tmpl, err := template.New("ldflags").Option("missingkey=error").Parse(ldflags)
+	if err != nil {
+		return "", fmt.Errorf("invalid linker flags template: %v", err)
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("failed to execute linker flags template: %v", err)
+	}
+	return out.String(), nil
+}
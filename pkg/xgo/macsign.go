@@ -0,0 +1,191 @@
+package xgo
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// validateMacSign checks that the macOS signing settings select a single signing
+// tool, and that notarization has signatures to submit.
+func validateMacSign(cfg *Config) error {
+	if cfg.MacSignIdentity != "" && cfg.MacSignP12 != "" {
+		return errors.New("both a macOS signing identity and a .p12 certificate given, select one of codesign or rcodesign")
+	}
+	if cfg.MacSignKeychain != "" && cfg.MacSignIdentity == "" {
+		return errors.New("macOS signing keychain given without a signing identity")
+	}
+	if cfg.MacNotarize && cfg.MacSignIdentity == "" && cfg.MacSignP12 == "" {
+		return errors.New("macOS notarization requested without a signing identity or .p12 certificate")
+	}
+	return nil
+}
+
+// macBinaries returns the macOS executables and dynamic libraries of the artifacts.
+func macBinaries(artifacts []Artifact) []string {
+	var paths []string
+	for _, artifact := range artifacts {
+		if goos, _, _ := targetPlatform(artifact.Target); goos != "darwin" {
+			continue
+		}
+		if ext := outputExt(artifact.Path); ext == "" || ext == ".dylib" {
+			paths = append(paths, artifact.Path)
+		}
+	}
+	return paths
+}
+
+// signMac signs the macOS binaries of the artifacts in place with the hardened
+// runtime and a secure timestamp, as notarization requires: with codesign and an
+// identity of the keychain on macOS hosts, or with rcodesign and a PKCS#12
+// certificate anywhere else, its password read from XGO_MACOS_SIGN_PASSWORD.
+// The signed binaries are then submitted for notarization if requested.
+func (b *builder) signMac(artifacts []Artifact) error {
+	paths := macBinaries(artifacts)
+	if len(paths) == 0 {
+		return nil
+	}
+	var (
+		tool string
+		args []string
+	)
+	if b.cfg.MacSignIdentity != "" {
+		tool, args = "codesign", []string{"--force", "--options", "runtime", "--timestamp", "--sign", b.cfg.MacSignIdentity}
+		if b.cfg.MacSignKeychain != "" {
+			args = append(args, "--keychain", b.cfg.MacSignKeychain)
+		}
+	} else {
+		tool, args = "rcodesign", []string{"sign", "--code-signature-flags", "runtime", "--p12-file", b.cfg.MacSignP12}
+		if password := os.Getenv("XGO_MACOS_SIGN_PASSWORD"); password != "" {
+			// Keep the password out of the process list
+			file, err := b.privateFile("p12-password", password)
+			if err != nil {
+				return err
+			}
+			args = append(args, "--p12-password-file", file)
+		}
+	}
+	if _, err := exec.LookPath(tool); err != nil {
+		return fmt.Errorf("%s not found, required to sign the macOS binaries", tool)
+	}
+	for _, path := range paths {
+		log.Printf("INFO: Signing %s with %s", filepath.Base(path), tool)
+		cmd := exec.CommandContext(b.ctx, tool, append(args, path)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("%s failed on %s: %v\n%s", tool, filepath.Base(path), err, strings.TrimSpace(string(out)))
+		}
+	}
+	if b.cfg.MacNotarize {
+		return b.notarizeMac(paths)
+	}
+	return nil
+}
+
+// notarizeMac submits the signed macOS binaries to the Apple notary service in a
+// single zip archive, waiting for the verdict. The service is authenticated with
+// the App Store Connect API key of XGO_NOTARY_KEY (.p8 file), XGO_NOTARY_KEY_ID
+// and XGO_NOTARY_ISSUER, or with the notarytool keychain profile of
+// XGO_NOTARY_PROFILE on macOS hosts. Bare binaries can't hold a stapled ticket,
+// Gatekeeper looking the notarization up online instead.
+func (b *builder) notarizeMac(paths []string) error {
+	key, keyID, issuer, profile := os.Getenv("XGO_NOTARY_KEY"), os.Getenv("XGO_NOTARY_KEY_ID"), os.Getenv("XGO_NOTARY_ISSUER"), os.Getenv("XGO_NOTARY_PROFILE")
+	apiKey := key != "" && keyID != "" && issuer != ""
+	if !apiKey && (profile == "" || b.cfg.MacSignIdentity == "") {
+		return errors.New("no notary service credentials, set XGO_NOTARY_KEY, XGO_NOTARY_KEY_ID and XGO_NOTARY_ISSUER to an App Store Connect API key")
+	}
+	archive, err := zipFiles(b.work, paths)
+	if err != nil {
+		return fmt.Errorf("failed to archive binaries for notarization: %v", err)
+	}
+	log.Printf("INFO: Submitting %d macOS binaries for notarization", len(paths))
+
+	var cmd *exec.Cmd
+	if b.cfg.MacSignIdentity != "" {
+		args := []string{"notarytool", "submit", archive, "--wait", "--output-format", "json"}
+		if apiKey {
+			args = append(args, "--key", key, "--key-id", keyID, "--issuer", issuer)
+		} else {
+			args = append(args, "--keychain-profile", profile)
+		}
+		cmd = exec.CommandContext(b.ctx, "xcrun", args...)
+	} else {
+		// rcodesign takes the API key as a JSON file encoding its parts
+		encoded := filepath.Join(b.work, "notary-key.json")
+		encode := exec.CommandContext(b.ctx, "rcodesign", "encode-app-store-connect-api-key", "--output-path", encoded, issuer, keyID, key)
+		if out, err := encode.CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to encode App Store Connect API key: %v\n%s", err, strings.TrimSpace(string(out)))
+		}
+		cmd = exec.CommandContext(b.ctx, "rcodesign", "notary-submit", "--api-key-file", encoded, "--wait", archive)
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("notarization failed: %v\n%s", err, strings.TrimSpace(string(out)))
+	}
+	// notarytool reports rejected submissions in its output only
+	var result struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+	if json.Unmarshal(out, &result) == nil && result.Status != "" && result.Status != "Accepted" {
+		return fmt.Errorf("notarization of submission %s %s, see xcrun notarytool log %s", result.ID, strings.ToLower(result.Status), result.ID)
+	}
+	log.Printf("INFO: Notarized %d macOS binaries", len(paths))
+	return nil
+}
+
+// zipFiles archives files into a new zip file of the given folder, keeping their
+// permissions.
+func zipFiles(dir string, paths []string) (string, error) {
+	file, err := os.CreateTemp(dir, "notarize-*.zip")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	zw := zip.NewWriter(file)
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return "", err
+		}
+		header.Method = zip.Deflate
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			return "", err
+		}
+		src, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(w, src)
+		src.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// privateFile writes a secret value into a file of the work folder readable by
+// the current user only.
+func (b *builder) privateFile(name string, value string) (string, error) {
+	path := filepath.Join(b.work, name)
+	if err := os.WriteFile(path, []byte(value), 0600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
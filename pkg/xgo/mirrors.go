@@ -0,0 +1,51 @@
+package xgo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// mirrorRule rewrites download URLs matching a pattern to an alternate location.
+// A trailing * in the pattern matches any suffix, substituted into the mirror.
+type mirrorRule struct {
+	pattern string
+	mirror  string
+}
+
+// parseMirrors parses URL rewrite rules given as `<pattern> -> <mirror>` or
+// `<pattern>=<mirror>`, e.g. https://zlib.net/* -> https://mirror.corp/zlib/*.
+func parseMirrors(rules []string) ([]mirrorRule, error) {
+	var mirrors []mirrorRule
+	for _, rule := range rules {
+		sep := "->"
+		if !strings.Contains(rule, sep) {
+			sep = "="
+		}
+		idx := strings.Index(rule, sep)
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid mirror rule %q, must be <pattern> -> <mirror>", rule)
+		}
+		pattern := strings.TrimSpace(rule[:idx])
+		mirror := strings.TrimSpace(rule[idx+len(sep):])
+		if strings.Contains(mirror, "*") && !strings.HasSuffix(pattern, "*") {
+			return nil, fmt.Errorf("invalid mirror rule %q, wildcard mirror needs wildcard pattern", rule)
+		}
+		mirrors = append(mirrors, mirrorRule{pattern: pattern, mirror: mirror})
+	}
+	return mirrors, nil
+}
+
+// rewriteURL applies the first matching mirror rule to a download URL.
+func rewriteURL(url string, mirrors []mirrorRule) string {
+	for _, rule := range mirrors {
+		if strings.HasSuffix(rule.pattern, "*") {
+			prefix := strings.TrimSuffix(rule.pattern, "*")
+			if strings.HasPrefix(url, prefix) {
+				return strings.Replace(rule.mirror, "*", strings.TrimPrefix(url, prefix), 1)
+			}
+		} else if url == rule.pattern {
+			return rule.mirror
+		}
+	}
+	return url
+}
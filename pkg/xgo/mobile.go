@@ -0,0 +1,273 @@
+package xgo
+
+import (
+	"archive/zip"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// MobileTargets are the Android and iOS targets the build script can cross
+// compile with CGO, using the Android NDK of the image and an iOS SDK added to
+// it. Being bound to their SDKs, they are left out of the */* wildcard.
+var MobileTargets = []string{"android/arm64", "android/amd64", "android/arm-7", "android/386", "ios/arm64"}
+
+// androidABIs maps the Go architectures to the Android ABIs of the native
+// libraries within Android archives.
+var androidABIs = map[string]string{
+	"arm64": "arm64-v8a",
+	"amd64": "x86_64",
+	"arm":   "armeabi-v7a",
+	"386":   "x86",
+}
+
+// unsafeJavaName matches the characters not allowed in Java package names.
+var unsafeJavaName = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// mobileLibrary is a library built for the mobile targets, with its output for
+// each of them.
+type mobileLibrary struct {
+	name    string            // Name of the library, the outputs' up to their platform
+	feature string            // Feature variant the library was built in, empty if none
+	outputs map[string]string // Library outputs keyed by target
+	headers map[string]string // C headers of the library outputs keyed by target
+}
+
+// targets lists the targets the library was built for, sorted, the bundles being
+// written next to the output of the last one.
+func (l *mobileLibrary) targets() []string {
+	targets := make([]string, 0, len(l.outputs))
+	for target := range l.outputs {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// bundleMobile bundles the Android shared libraries of a c-shared build into an
+// Android archive (.aar) and the iOS static libraries of a c-archive build into
+// a zipped XCFramework, as consumed by Gradle and Swift packages, one bundle per
+// library. The bundles are written next to the outputs.
+func (b *builder) bundleMobile(artifacts []Artifact) ([]Artifact, error) {
+	var bundles []Artifact
+	for _, kind := range []struct{ goos, mode, ext string }{{"android", "c-shared", ".so"}, {"ios", "c-archive", ".a"}} {
+		bundled, err := b.bundleLibraries(artifacts, kind.goos, kind.mode, kind.ext)
+		bundles = append(bundles, bundled...)
+		if err != nil {
+			return bundles, err
+		}
+	}
+	return bundles, nil
+}
+
+// bundleLibraries bundles the libraries of the targets of an OS built with the
+// given build mode, their outputs having the given extension.
+func (b *builder) bundleLibraries(artifacts []Artifact, goos string, mode string, ext string) ([]Artifact, error) {
+	libraries := make(map[string]*mobileLibrary)
+	var keys []string
+	for _, artifact := range artifacts {
+		if platform, _, _ := targetPlatform(artifact.Target); platform != goos || targetMode(&b.cfg.Flags, artifact.Target) != mode {
+			continue
+		}
+		base := filepath.Base(artifact.Path)
+		idx := strings.LastIndex(base, "-"+goos+"-")
+		if idx <= 0 {
+			continue
+		}
+		key := artifact.Feature + "/" + base[:idx]
+		library, ok := libraries[key]
+		if !ok {
+			library = &mobileLibrary{name: base[:idx], feature: artifact.Feature, outputs: make(map[string]string), headers: make(map[string]string)}
+			libraries[key] = library
+			keys = append(keys, key)
+		}
+		switch outputExt(base) {
+		case ext:
+			library.outputs[artifact.Target] = artifact.Path
+		case ".h":
+			library.headers[artifact.Target] = artifact.Path
+		}
+	}
+	sort.Strings(keys)
+
+	var bundles []Artifact
+	for _, key := range keys {
+		library := libraries[key]
+		if len(library.outputs) == 0 {
+			continue
+		}
+		var (
+			path string
+			err  error
+		)
+		if goos == "android" {
+			path, err = b.writeAAR(library)
+		} else {
+			path, err = b.writeXCFramework(library)
+		}
+		if err != nil {
+			return bundles, fmt.Errorf("failed to bundle %s: %v", library.name, err)
+		}
+		log.Printf("INFO: Bundled %d %s libraries into %s", len(library.outputs), goos, path)
+		bundles = append(bundles, Artifact{Path: path, Feature: library.feature})
+	}
+	return bundles, nil
+}
+
+// writeAAR bundles the Android outputs of a library into an Android archive
+// holding them as the JNI libraries of their ABIs, without any Java code.
+func (b *builder) writeAAR(library *mobileLibrary) (string, error) {
+	tmp, err := os.MkdirTemp(b.work, "aar-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+
+	manifest := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<manifest xmlns:android="http://schemas.android.com/apk/res/android" package="go.%s">
+  <uses-sdk android:minSdkVersion="%s"/>
+</manifest>
+`, strings.ToLower(unsafeJavaName.ReplaceAllString(library.name, "_")), androidAPI())
+
+	// Android archives must carry a jar, even if empty of classes
+	jar := filepath.Join(tmp, "classes.jar")
+	if err := writeEmptyJar(jar); err != nil {
+		return "", err
+	}
+	entries := []PackageFile{{Path: jar, Name: "classes.jar"}}
+	for name, content := range map[string]string{"AndroidManifest.xml": manifest, "R.txt": ""} {
+		path := filepath.Join(tmp, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return "", err
+		}
+		entries = append(entries, PackageFile{Path: path, Name: name})
+	}
+	var dir string
+	for _, target := range library.targets() {
+		output := library.outputs[target]
+		_, goarch, _ := targetPlatform(target)
+		abi, ok := androidABIs[goarch]
+		if !ok {
+			return "", fmt.Errorf("no Android ABI known for %s", target)
+		}
+		entries = append(entries, PackageFile{Path: output, Name: "jni/" + abi + "/lib" + library.name + ".so"})
+		dir = filepath.Dir(output)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+
+	path := filepath.Join(dir, library.name+".aar")
+	return path, writeZip(path, entries, 0, epochTime(b.cfg.Flags.Epoch))
+}
+
+// writeEmptyJar writes a jar archive holding only its manifest.
+func writeEmptyJar(path string) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	zw := zip.NewWriter(out)
+	w, err := zw.Create("META-INF/MANIFEST.MF")
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte("Manifest-Version: 1.0\r\nCreated-By: xgo\r\n\r\n")); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// mobileEnv forwards the settings of the mobile toolchains set on the host (API
+// level, iOS version and SDK) to the build script.
+func mobileEnv() []string {
+	var env []string
+	for _, name := range []string{"ANDROID_API", "IOS_DEFAULT_TARGET", "IOS_SDK"} {
+		if value := os.Getenv(name); value != "" {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
+
+// androidAPI returns the minimum Android API level the libraries are built for.
+func androidAPI() string {
+	if api := os.Getenv("ANDROID_API"); api != "" {
+		return api
+	}
+	return "21"
+}
+
+// writeXCFramework bundles the iOS outputs of a library into a zipped XCFramework
+// holding the static library of every platform along with its C header.
+func (b *builder) writeXCFramework(library *mobileLibrary) (string, error) {
+	tmp, err := os.MkdirTemp(b.work, "xcframework-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+
+	root := library.name + ".xcframework/"
+	var (
+		entries   []PackageFile
+		available []string
+		dir       string
+	)
+	for _, target := range library.targets() {
+		output := library.outputs[target]
+		_, goarch, _ := targetPlatform(target)
+		id := "ios-" + goarch
+		entries = append(entries, PackageFile{Path: output, Name: root + id + "/lib" + library.name + ".a"})
+		headers := ""
+		if header, ok := library.headers[target]; ok {
+			entries = append(entries, PackageFile{Path: header, Name: root + id + "/Headers/" + library.name + ".h"})
+			headers = "\n\t\t\t<key>HeadersPath</key>\n\t\t\t<string>Headers</string>"
+		}
+		available = append(available, fmt.Sprintf(`		<dict>%s
+			<key>LibraryIdentifier</key>
+			<string>%s</string>
+			<key>LibraryPath</key>
+			<string>lib%s.a</string>
+			<key>SupportedArchitectures</key>
+			<array>
+				<string>%s</string>
+			</array>
+			<key>SupportedPlatform</key>
+			<string>ios</string>
+		</dict>
+`, headers, id, library.name, goarch))
+		dir = filepath.Dir(output)
+	}
+	sort.Strings(available)
+
+	plist := filepath.Join(tmp, "Info.plist")
+	content := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>AvailableLibraries</key>
+	<array>
+` + strings.Join(available, "") + `	</array>
+	<key>CFBundlePackageType</key>
+	<string>XFWK</string>
+	<key>XCFrameworkFormatVersion</key>
+	<string>1.0</string>
+</dict>
+</plist>
+`
+	if err := os.WriteFile(plist, []byte(content), 0644); err != nil {
+		return "", err
+	}
+	entries = append(entries, PackageFile{Path: plist, Name: root + "Info.plist"})
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+
+	path := filepath.Join(dir, library.name+".xcframework.zip")
+	return path, writeZip(path, entries, 0, epochTime(b.cfg.Flags.Epoch))
+}
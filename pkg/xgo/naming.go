@@ -0,0 +1,117 @@
+package xgo
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// NameData is the data the output name template is executed with.
+type NameData struct {
+	Name      string // Name of the output without its target and feature variant, e.g. geth
+	Version   string // Version of the project from its latest git tag, 0.0.0 if untagged
+	OS        string // Go operating system of the target, e.g. linux
+	Arch      string // Go architecture of the target, e.g. arm
+	Variant   string // Architecture variant of the target if any, e.g. 7 for arm-7
+	Feature   string // Feature variant the output was built in if any, e.g. enterprise
+	GoVersion string // Go version the project was built with, e.g. 1.21.5
+	Tag       string // Latest git tag of the project, empty if untagged
+	Commit    string // Short git commit of the project, empty if not a repository
+	Ext       string // Extension of the output, e.g. .exe for Windows binaries
+}
+
+// nameData assembles the name template data of an output.
+func (b *builder) nameData(artifact Artifact) *NameData {
+	name := packagedName(artifact)
+	ext := outputExt(name)
+
+	parts := strings.SplitN(artifact.Target, "/", 2)
+	arch, variant := parts[1], ""
+	if idx := strings.Index(arch, "-"); idx >= 0 {
+		arch, variant = arch[:idx], arch[idx+1:]
+	}
+	return &NameData{
+		Name:      strings.TrimSuffix(strings.TrimSuffix(name, ext), "-"+artifact.Feature),
+		Version:   projectVersion(b.cfg.Project.ProjectPath),
+		OS:        strings.SplitN(parts[0], "-", 2)[0],
+		Arch:      arch,
+		Variant:   variant,
+		Feature:   artifact.Feature,
+		GoVersion: b.goVersion(artifact.Target),
+		Tag:       gitOutput(b.cfg.Project.ProjectPath, "describe", "--tags", "--abbrev=0"),
+		Commit:    gitOutput(b.cfg.Project.ProjectPath, "rev-parse", "--short", "HEAD"),
+		Ext:       ext,
+	}
+}
+
+// outputName returns the file name of an output, either rendered from the name
+// template with the given extension or its default one.
+func (b *builder) outputName(artifact Artifact, ext string) (string, error) {
+	if b.nameTmpl == nil {
+		name := filepath.Base(artifact.Path)
+		return strings.TrimSuffix(name, outputExt(name)) + ext, nil
+	}
+	data := b.nameData(artifact)
+	data.Ext = ext
+
+	var name bytes.Buffer
+	if err := b.nameTmpl.Execute(&name, data); err != nil {
+		return "", err
+	}
+	// Keep the outputs in their folder, the template only naming the files
+	rendered := name.String()
+	if rendered == "" || rendered == "." || rendered == ".." || strings.ContainsAny(rendered, `/\`) {
+		return "", fmt.Errorf("invalid output name %q rendered for %s, must be a non-empty file name", rendered, artifact.Target)
+	}
+	return rendered, nil
+}
+
+// renameOutputs renames the outputs of the targets after the name template.
+func (b *builder) renameOutputs(artifacts []Artifact) error {
+	for i, artifact := range artifacts {
+		if artifact.Target == "" {
+			continue
+		}
+		name, err := b.outputName(artifact, outputExt(artifact.Path))
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(filepath.Dir(artifact.Path), name)
+		if path == artifact.Path {
+			continue
+		}
+		if err := moveFile(artifact.Path, path); err != nil {
+			return err
+		}
+		artifacts[i].Path = path
+	}
+	return nil
+}
+
+// goVersion returns the Go version a target was built with, the tag of the build
+// image if containerized or the local toolchain's otherwise.
+func (b *builder) goVersion(target string) string {
+	if b.cfg.Image != "" && !b.natives[target] {
+		_, tag, _ := splitImage(b.cfg.Image)
+		return tag
+	}
+	out, err := exec.Command("go", "env", "GOVERSION").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.TrimSpace(string(out)), "go")
+}
+
+// gitOutput runs a git command in the project, returning its trimmed output or
+// an empty string on failure.
+func gitOutput(project string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = project
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
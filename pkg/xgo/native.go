@@ -0,0 +1,257 @@
+package xgo
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// nativeTargets splits the requested targets into the pure Go ones that can be
+// cross compiled by the local Go toolchain and the ones needing a container for
+// their CGO toolchains. Everything requires a container if the build relies on
+// CGO specific options (C dependencies, race detector), and the targets built
+// with the C build modes or pie do so on their own.
+func (b *builder) nativeTargets() (native []string, contained []string) {
+	config, flags := &b.cfg.Project, &b.cfg.Flags
+
+	targets := ExpandTargets(config.Targets)
+	if config.Dependencies != "" || flags.Race {
+		return nil, targets
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		log.Printf("WARNING: No local Go toolchain found, building all targets in containers")
+		return nil, targets
+	}
+	packages, err := b.nativePackages(os.Environ())
+	if err != nil {
+		log.Printf("WARNING: Failed to list packages to build, building all targets in containers: %v", err)
+		return nil, targets
+	}
+	for _, target := range targets {
+		env := TargetEnv([]string{target})
+		override := overrideFor(flags.Overrides, target)
+		// Only android/arm64 links without CGO among the mobile targets
+		goos, _, _ := targetPlatform(target)
+		if sdkPlatforms[goos] && target != "android/arm64" {
+			contained = append(contained, target)
+			continue
+		}
+		if mode := targetMode(flags, target); mode != "" && mode != "default" && mode != "exe" && mode != "archive" {
+			contained = append(contained, target)
+			continue
+		}
+		if env == nil || config.Profiles[target] != nil || flags.CgoCFlags[target] != "" || flags.CgoLdFlags[target] != "" || (override != nil && (override.CC != "" || override.CXX != "")) {
+			contained = append(contained, target)
+			continue
+		}
+		// Check whether any non-standard dependency uses CGO on the target
+		args := append([]string{"list", "-deps", "-f", "{{if and (not .Standard) .CgoFiles}}{{.ImportPath}}{{end}}"}, packages...)
+		cmd := exec.CommandContext(b.ctx, "go", args...)
+		cmd.Dir = config.ProjectPath
+		cmd.Env = append(append(os.Environ(), env...), "CGO_ENABLED=1")
+
+		out, err := cmd.Output()
+		if err != nil || strings.TrimSpace(string(out)) != "" {
+			contained = append(contained, target)
+			continue
+		}
+		native = append(native, target)
+	}
+	return native, contained
+}
+
+// nativePackages resolves the packages to build natively, relative to the
+// project path, applying the include and exclude patterns if any.
+func (b *builder) nativePackages(env []string) ([]string, error) {
+	config := &b.cfg.Project
+
+	var packages []string
+	for _, pack := range strings.Split(config.Package, ",") {
+		if pack = strings.TrimSpace(pack); pack != "" {
+			packages = append(packages, "./"+filepath.ToSlash(pack))
+		}
+	}
+	if len(packages) == 0 {
+		rel, err := filepath.Rel(config.ProjectPath, config.CmdPath)
+		if err != nil {
+			return nil, err
+		}
+		packages = []string{"./" + filepath.ToSlash(rel)}
+	}
+	if config.Include == "" && config.Exclude == "" {
+		return packages, nil
+	}
+	list := func(patterns string) ([]string, error) {
+		cmd := exec.CommandContext(b.ctx, "go", append([]string{"list"}, strings.FieldsFunc(patterns, func(r rune) bool { return r == ',' || r == ' ' })...)...)
+		cmd.Dir, cmd.Env = config.ProjectPath, env
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, err
+		}
+		return strings.Fields(string(out)), nil
+	}
+	if config.Include != "" {
+		included, err := list(config.Include)
+		if err != nil {
+			return nil, err
+		}
+		packages = included
+	} else {
+		included, err := list(strings.Join(packages, ","))
+		if err != nil {
+			return nil, err
+		}
+		packages = included
+	}
+	excluded := make(map[string]bool)
+	if config.Exclude != "" {
+		list, err := list(config.Exclude)
+		if err != nil {
+			return nil, err
+		}
+		for _, pkg := range list {
+			excluded[pkg] = true
+		}
+	}
+	var filtered []string
+	for _, pkg := range packages {
+		if !excluded[pkg] {
+			filtered = append(filtered, pkg)
+		}
+	}
+	if len(filtered) == 0 {
+		return nil, fmt.Errorf("no packages left to build after applying the include/exclude patterns")
+	}
+	return filtered, nil
+}
+
+// compileNative cross compiles pure Go targets with the local Go toolchain and
+// CGO disabled, naming the outputs the same way as the container builds.
+func (b *builder) compileNative(targets []string) error {
+	config, flags := &b.cfg.Project, &b.cfg.Flags
+
+	packages, err := b.nativePackages(os.Environ())
+	if err != nil {
+		return err
+	}
+	if b.winres != "" && hasWindowsTarget(targets) {
+		cleanup, err := b.placeWindowsResources(packages)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+	}
+	name := config.Prefix
+	if name == "" {
+		name = filepath.Base(config.CmdPath)
+		if blob, err := os.ReadFile(filepath.Join(config.ProjectPath, "go.mod")); err == nil {
+			for _, line := range strings.Split(string(blob), "\n") {
+				if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "module" {
+					name = filepath.Base(strings.Trim(fields[1], `"`))
+				}
+			}
+		}
+	}
+	args := []string{"build"}
+	if flags.Verbose {
+		args = append(args, "-v")
+	}
+	if flags.Steps {
+		args = append(args, "-x")
+	}
+	if flags.TrimPath {
+		args = append(args, "-trimpath")
+	}
+	if flags.VCS != "" {
+		args = append(args, "-buildvcs="+flags.VCS)
+	}
+	if info, err := os.Stat(filepath.Join(config.ProjectPath, "vendor")); err == nil && info.IsDir() {
+		args = append(args, "-mod=vendor")
+	}
+	for _, target := range targets {
+		env := append(TargetEnv([]string{target}), b.secretVars()...)
+		if flags.ArmABI == "soft" && strings.HasPrefix(target, "linux/arm-") {
+			env = append(env, "GOARM=5")
+		}
+		if _, libc := splitLibc(target); libc != "" {
+			env = append(env, "CGO_ENABLED=0") // Pure Go binaries link against no C library at all
+		}
+		if flags.Epoch != "" {
+			env = append(env, "SOURCE_DATE_EPOCH="+flags.Epoch)
+		}
+		if b.cfg.GoCache != "" {
+			env = append(env, "GOCACHE="+b.cfg.GoCache)
+		}
+		goos, goarch := strings.SplitN(strings.TrimPrefix(env[0], "GOOS="), "-", 2)[0], strings.SplitN(target, "/", 2)[1]
+
+		// Apply any per-target overrides of the build tags, linker flags and env
+		tags, ldflags, subsystem := flags.Tags, flags.LdFlags, flags.Subsystem
+		if override := overrideFor(flags.Overrides, target); override != nil {
+			if override.Tags != "" {
+				tags = override.Tags
+			}
+			if override.LdFlags != "" {
+				ldflags = override.LdFlags
+			}
+			if override.Subsystem != "" {
+				subsystem = override.Subsystem
+			}
+			env = append(env, override.env()...)
+		}
+		ldflags = strings.TrimSpace(ldflags + " " + subsystemFlags(target, subsystem))
+		mode := targetMode(flags, target)
+		targetArgs := append([]string{}, args...)
+		if mode != "" && mode != "default" {
+			targetArgs = append(targetArgs, "-buildmode="+mode)
+		}
+		if tags != "" {
+			targetArgs = append(targetArgs, "-tags", tags)
+		}
+		if ldflags != "" {
+			targetArgs = append(targetArgs, "-ldflags", ldflags)
+		}
+
+		ext := ""
+		switch {
+		case mode == "archive":
+			ext = ".a"
+		case goos == "windows":
+			ext = ".exe"
+		}
+		fmt.Fprintf(b.stdout, "Compiling for %s natively...\n", target)
+		b.startTarget(target, "")
+		before := -1
+		if b.cfg.GoCache == "" {
+			before = goCacheActions() // Only the host cache is accounted for
+		}
+		for _, pkg := range packages {
+			out := name
+			if len(packages) > 1 {
+				out = filepath.Base(pkg)
+			}
+			out = filepath.Join(config.BinPath, fmt.Sprintf("%s-%s-%s%s", out, goos, goarch, ext))
+
+			cmd := exec.CommandContext(b.ctx, "go", append(targetArgs, "-o", out, pkg)...)
+			cmd.Dir = config.ProjectPath
+			cmd.Env = append(append(os.Environ(), env...), "CGO_ENABLED=0")
+			if err := b.run(cmd); err != nil {
+				err = fmt.Errorf("failed to build %s for %s: %v", pkg, target, err)
+				b.finishTargets([]string{target}, err)
+				return err
+			}
+		}
+		b.finishTargets([]string{target}, nil)
+
+		// Compare the packages needed with the ones compiled into the build cache
+		list := exec.CommandContext(b.ctx, "go", append(append([]string{"list", "-deps"}, targetArgs[1:]...), packages...)...)
+		list.Dir = config.ProjectPath
+		list.Env = append(append(os.Environ(), env...), "CGO_ENABLED=0")
+		if out, err := list.Output(); err == nil && before >= 0 {
+			b.recordGoCache(len(strings.Fields(string(out))), goCacheActions()-before)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package xgo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	goruntime "runtime"
+	"strings"
+)
+
+// secretEnv are the environment variables of the build containers carrying
+// credentials, redacted whenever a container engine invocation is echoed.
+var secretEnv = []string{"NETRC_DATA", "GITCONFIG_DATA", "GIT_CREDENTIALS_DATA"}
+
+// netrcPath resolves the credentials file to forward into the build containers,
+// "auto" looking up the one the go command would use ($NETRC or ~/.netrc).
+func netrcPath(netrc string) (string, error) {
+	if netrc != "auto" {
+		if !fileExists(netrc) {
+			return "", fmt.Errorf("netrc file %s not found", netrc)
+		}
+		return filepath.Abs(netrc)
+	}
+	if path := os.Getenv("NETRC"); path != "" {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", nil
+	}
+	name := ".netrc"
+	if goruntime.GOOS == "windows" {
+		name = "_netrc"
+	}
+	if path := filepath.Join(home, name); fileExists(path) {
+		return path, nil
+	}
+	return "", nil
+}
+
+// netrcArgs assembles the container arguments handing the .netrc credentials of
+// the host to the go and git commands of a build container, so that modules can
+// be fetched over HTTPS from private repositories. The file is mounted read-only
+// where possible, its content only being injected on remote engines.
+func (b *builder) netrcArgs() ([]string, error) {
+	path, err := netrcPath(b.cfg.Netrc)
+	if err != nil || path == "" {
+		return nil, err
+	}
+	if !b.remote {
+		return []string{"-v", volume(path, "/root/.netrc", "ro")}, nil
+	}
+	blob, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read netrc file: %v", err)
+	}
+	return []string{"-e", "NETRC_DATA=" + string(blob)}, nil
+}
+
+// injectsNetrc checks whether container arguments inject the .netrc credentials
+// to be written out by the container.
+func injectsNetrc(args []string) bool {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "NETRC_DATA=") {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardsGitConfig checks whether container arguments forward the git
+// configuration of the host to be set up by the container.
+func forwardsGitConfig(args []string) bool {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "GIT_CONFIG_INCLUDES=") || strings.HasPrefix(arg, "GITCONFIG_DATA=") || strings.HasPrefix(arg, "GIT_CREDENTIALS_DATA=") {
+			return true
+		}
+	}
+	return false
+}
+
+// redact masks the values of the secret environment variables of container
+// engine arguments, before echoing them.
+func redact(args []string) []string {
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		redacted[i] = arg
+		for _, name := range secretEnv {
+			if strings.HasPrefix(arg, name+"=") {
+				redacted[i] = name + "=<redacted>"
+			}
+		}
+	}
+	return redacted
+}
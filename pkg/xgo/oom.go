@@ -0,0 +1,88 @@
+package xgo
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// killMarkers are the messages the Go and C toolchains print when one of their
+// processes is killed by a signal, typically by the OOM killer.
+var killMarkers = [][]byte{
+	[]byte("signal: killed"),
+	[]byte("Killed signal terminated program"),
+}
+
+// killWatcher is an io.Writer forwarding the output of a build while watching it
+// for compilers killed by a signal.
+type killWatcher struct {
+	out    io.Writer
+	lock   sync.Mutex
+	tail   []byte // End of the previous write, to match markers split across writes
+	killed bool
+}
+
+// Write implements io.Writer, forwarding everything to the wrapped writer.
+func (w *killWatcher) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	if !w.killed {
+		buf := append(w.tail, p...)
+		for _, marker := range killMarkers {
+			if bytes.Contains(buf, marker) {
+				w.killed = true
+			}
+		}
+		if len(buf) > 64 {
+			buf = buf[len(buf)-64:]
+		}
+		w.tail = append(w.tail[:0], buf...)
+	}
+	w.lock.Unlock()
+
+	return w.out.Write(p)
+}
+
+// containerName generates a unique name for a build container, allowing it to be
+// inspected once it exits.
+func containerName() string {
+	id := make([]byte, 6)
+	rand.Read(id)
+	return "xgo-build-" + hex.EncodeToString(id)
+}
+
+// oomError checks whether a failed build container was killed by the OOM killer,
+// or a compiler within it by a signal, returning a descriptive error including the
+// memory limit in effect if so. Otherwise the original error is returned.
+func (b *builder) oomError(container string, killed bool, err error) error {
+	out, ierr := exec.Command(b.runtime, "inspect", "--format", "{{.State.OOMKilled}} {{.State.ExitCode}} {{.HostConfig.Memory}}", container).Output()
+	if ierr != nil {
+		return err
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) != 3 {
+		return err
+	}
+	oom, code := fields[0] == "true", fields[1]
+	if !oom && !killed && code != "137" {
+		return err
+	}
+	limit := "no container limit"
+	if memory, _ := strconv.ParseInt(fields[2], 10, 64); memory > 0 {
+		limit = "container limit " + FormatSize(memory)
+	} else if out, ierr := exec.Command(b.runtime, "info", "--format", "{{.MemTotal}}").Output(); ierr == nil {
+		if total, _ := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64); total > 0 {
+			limit = "no container limit, engine has " + FormatSize(total)
+		}
+	}
+	reason := "build container was killed by the OOM killer"
+	if !oom {
+		reason = "compiler was killed, most likely by the OOM killer"
+	}
+	return fmt.Errorf("%v: %s (%s); lower --parallel or raise the memory available to the %s engine", err, reason, limit, b.runtime)
+}
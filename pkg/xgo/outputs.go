@@ -0,0 +1,139 @@
+package xgo
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// outputExts are the file extensions of all the outputs the build modes produce.
+var outputExts = append([]string{".a", ".lib", ".h"}, binaryExts...)
+
+// outputExt returns the extension of an output, empty if it has none, not to
+// mistake the dots of the targets for one (e.g. geth-linux-arm64-v8.2).
+func outputExt(name string) string {
+	ext := filepath.Ext(name)
+	for _, known := range outputExts {
+		if ext == known {
+			return ext
+		}
+	}
+	return ""
+}
+
+// outputTarget extracts the os/arch(-variant) target an output was built for
+// from its name, e.g. linux/arm-7 from geth-linux-arm-7.
+func outputTarget(name string) (string, bool) {
+	ext := filepath.Ext(name)
+	for _, known := range outputExts {
+		if ext == known {
+			name = strings.TrimSuffix(name, ext)
+		}
+	}
+	name = strings.TrimSuffix(name, "-race")
+
+	for _, goos := range targetOSes {
+		if idx := strings.LastIndex(name, "-"+goos+"-"); idx >= 0 {
+			return goos + "/" + name[idx+len(goos)+2:], true
+		}
+	}
+	return "", false
+}
+
+// matchTarget checks whether a target matches a target pattern, which may use
+// globs (e.g. linux/*) or omit the variant of the architecture (e.g. linux/arm).
+func matchTarget(pattern string, target string) bool {
+	if ok, _ := path.Match(pattern, target); ok {
+		return true
+	}
+	if idx := strings.LastIndex(target, "-"); idx > strings.Index(target, "/") {
+		if ok, _ := path.Match(pattern, target[:idx]); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// routeOutputs moves the outputs produced since the given time into the output
+// folders configured for their targets, the most specific pattern winning. The
+// new locations of the moved outputs are returned keyed by their old ones.
+func routeOutputs(dir string, since time.Time, routes map[string]string) (map[string]string, error) {
+	patterns := make([]string, 0, len(routes))
+	for pattern := range routes {
+		if pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		return strings.Count(patterns[i], "*") < strings.Count(patterns[j], "*") ||
+			(strings.Count(patterns[i], "*") == strings.Count(patterns[j], "*") && len(patterns[i]) > len(patterns[j]))
+	})
+	var moves [][2]string
+	err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || info.ModTime().Before(since) {
+			return err
+		}
+		target, ok := outputTarget(info.Name())
+		if !ok {
+			return nil
+		}
+		for _, pattern := range patterns {
+			if matchTarget(pattern, target) {
+				moves = append(moves, [2]string{file, filepath.Join(routes[pattern], info.Name())})
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	moved := make(map[string]string)
+	for _, move := range moves {
+		log.Printf("INFO: Moving %s to %s", move[0], move[1])
+		if err := moveFile(move[0], move[1]); err != nil {
+			return moved, fmt.Errorf("failed to move %s: %v", move[0], err)
+		}
+		moved[move[0]] = move[1]
+	}
+	return moved, nil
+}
+
+// moveFile moves a file to a new location, falling back to copying it if the
+// destination is on a different file system.
+func moveFile(src string, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
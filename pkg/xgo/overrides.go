@@ -0,0 +1,182 @@
+package xgo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TargetOverride holds the build settings replacing the global ones for the
+// targets matching its os/arch pattern, e.g. different tags for windows/*.
+type TargetOverride struct {
+	Tags      string            `yaml:"tags" toml:"tags"`             // Build tags, replacing the global ones if set
+	LdFlags   string            `yaml:"ldflags" toml:"ldflags"`       // Linker flags, replacing the global ones if set
+	BuildMode string            `yaml:"build-mode" toml:"build-mode"` // Build mode (e.g. pie), replacing the global one if set
+	CC        string            `yaml:"cc" toml:"cc"`                 // C cross compiler, replacing the builtin one if set
+	CXX       string            `yaml:"cxx" toml:"cxx"`               // C++ cross compiler, replacing the builtin one if set
+	Env       map[string]string `yaml:"env" toml:"env"`               // Extra environment variables of the Go build
+
+	Subsystem string `yaml:"windows-subsystem" toml:"windows-subsystem"` // Windows subsystem (gui, console), replacing the global one if set
+}
+
+// validate checks that the override only sets valid environment variables.
+func (o *TargetOverride) validate(pattern string) error {
+	for name := range o.Env {
+		if name == "" || strings.ContainsAny(name, "=\t\n") {
+			return fmt.Errorf("invalid environment variable %q in override of %s", name, pattern)
+		}
+	}
+	if o.Subsystem != "" && o.Subsystem != "gui" && o.Subsystem != "console" {
+		return fmt.Errorf("invalid windows subsystem %q in override of %s, must be gui or console", o.Subsystem, pattern)
+	}
+	for _, value := range []string{o.Tags, o.LdFlags, o.BuildMode, o.CC, o.CXX} {
+		if strings.ContainsAny(value, "\t\n") {
+			return fmt.Errorf("invalid value %q in override of %s, must be a single line", value, pattern)
+		}
+	}
+	for _, value := range o.Env {
+		if strings.ContainsAny(value, "\t\n") {
+			return fmt.Errorf("invalid value %q in override of %s, must be a single line", value, pattern)
+		}
+	}
+	return nil
+}
+
+// overrideFor merges the overrides matching a target, the settings of the more
+// specific patterns taking precedence over the generic ones.
+func overrideFor(overrides map[string]*TargetOverride, target string) *TargetOverride {
+	patterns := make([]string, 0, len(overrides))
+	for pattern := range overrides {
+		if matchTarget(pattern, target) {
+			patterns = append(patterns, pattern)
+		}
+	}
+	if len(patterns) == 0 {
+		return nil
+	}
+	// Apply the generic patterns first for the specific ones to overwrite them
+	sort.Slice(patterns, func(i, j int) bool {
+		return strings.Count(patterns[i], "*") > strings.Count(patterns[j], "*") ||
+			(strings.Count(patterns[i], "*") == strings.Count(patterns[j], "*") && len(patterns[i]) < len(patterns[j]))
+	})
+	merged := &TargetOverride{Env: make(map[string]string)}
+	for _, pattern := range patterns {
+		o := overrides[pattern]
+		if o.Tags != "" {
+			merged.Tags = o.Tags
+		}
+		if o.LdFlags != "" {
+			merged.LdFlags = o.LdFlags
+		}
+		if o.BuildMode != "" {
+			merged.BuildMode = o.BuildMode
+		}
+		if o.CC != "" {
+			merged.CC = o.CC
+		}
+		if o.CXX != "" {
+			merged.CXX = o.CXX
+		}
+		if o.Subsystem != "" {
+			merged.Subsystem = o.Subsystem
+		}
+		for name, value := range o.Env {
+			merged.Env[name] = value
+		}
+	}
+	return merged
+}
+
+// env returns the environment variables the override adds to a Go build, the
+// C compilers included, sorted by name.
+func (o *TargetOverride) env() []string {
+	var env []string
+	for name, value := range o.Env {
+		env = append(env, name+"="+value)
+	}
+	sort.Strings(env)
+	if o.CC != "" {
+		env = append(env, "CC="+o.CC)
+	}
+	if o.CXX != "" {
+		env = append(env, "CXX="+o.CXX)
+	}
+	return env
+}
+
+// targetMode returns the build mode of a target: the one of its overrides if any,
+// else the global one. The auto mode selects pie for the Linux targets supporting
+// it, as some hardened distributions require, and the default mode elsewhere.
+func targetMode(flags *BuildFlags, target string) string {
+	mode := flags.Mode
+	if o := overrideFor(flags.Overrides, target); o != nil && o.BuildMode != "" {
+		mode = o.BuildMode
+	}
+	if mode == "auto" {
+		goos, goarch, _ := targetPlatform(target)
+		if goos == "linux" && matchesAny(buildModeTargets["pie"], goos+"/"+goarch) {
+			return "pie"
+		}
+		return "default"
+	}
+	return mode
+}
+
+// scriptMode returns the global build mode passed to the build script, the auto
+// mode being resolved per target in the MATRIX on top of the default one.
+func scriptMode(mode string) string {
+	if mode == "auto" {
+		return "default"
+	}
+	return mode
+}
+
+// subsystemFlags returns the linker flags selecting the subsystem of a Windows
+// target: the GUI one doesn't open a console window when started, the console
+// one being the default of the Go linker.
+func subsystemFlags(target string, subsystem string) string {
+	if subsystem == "gui" && strings.HasPrefix(target, "windows") {
+		return "-H windowsgui"
+	}
+	return ""
+}
+
+// matrixEnv serializes the overrides of every requested target into the single
+// MATRIX variable of the build script, one tab separated target, setting and
+// value per line (e.g. "windows/amd64\ttags\tgui"). Platform versions are
+// stripped from the targets, as the build script looks them up by os/arch. The
+// build modes resolved by the auto mode are passed the same way.
+func matrixEnv(targets []string, flags *BuildFlags) string {
+	if len(flags.Overrides) == 0 && flags.Mode != "auto" {
+		return "MATRIX="
+	}
+	if len(targets) == 0 {
+		targets = []string{"*/*"}
+	}
+	var lines []string
+	for _, target := range ExpandTargets(targets) {
+		if parts := strings.SplitN(target, "/", 2); len(parts) == 2 {
+			target = strings.SplitN(parts[0], "-", 2)[0] + "/" + parts[1]
+		}
+		if mode := targetMode(flags, target); mode != scriptMode(flags.Mode) {
+			lines = append(lines, target+"\tbuildmode\t"+mode)
+		}
+		o := overrideFor(flags.Overrides, target)
+		if o == nil {
+			continue
+		}
+		if o.Tags != "" {
+			lines = append(lines, target+"\ttags\t"+o.Tags)
+		}
+		if o.LdFlags != "" {
+			lines = append(lines, target+"\tldflags\t"+o.LdFlags)
+		}
+		if o.Subsystem != "" {
+			lines = append(lines, target+"\tsubsystem\t"+o.Subsystem)
+		}
+		for _, env := range o.env() {
+			lines = append(lines, target+"\tenv\t"+env)
+		}
+	}
+	return "MATRIX=" + strings.Join(lines, "\n")
+}
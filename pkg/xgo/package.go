@@ -0,0 +1,453 @@
+package xgo
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// compressors are the external tools compressing the tarballs of the formats
+// not supported by the standard library.
+var compressors = map[string]string{
+	"xz":  "xz",
+	"zst": "zstd",
+}
+
+// debArches maps the build targets to their Debian architecture names.
+var debArches = map[string]string{
+	"amd64": "amd64", "386": "i386", "arm64": "arm64",
+	"arm-5": "armel", "arm-6": "armel", "arm-7": "armhf",
+	"mips": "mips", "mipsle": "mipsel", "mips64": "mips64", "mips64le": "mips64el",
+	"ppc64le": "ppc64el", "riscv64": "riscv64", "s390x": "s390x",
+}
+
+// PackageRule selects the package formats to produce for the outputs of the
+// targets matching any of its patterns, the first matching rule winning.
+type PackageRule struct {
+	Targets []string `yaml:"targets" toml:"targets"` // Target patterns the rule applies to, globs allowed (e.g. windows/*)
+	Formats []string `yaml:"formats" toml:"formats"` // Package formats to produce (tar.gz, tar.xz, tar.zst, zip, deb or registered ones), none if empty
+	Level   int      `yaml:"level" toml:"level"`     // Compression level, the default of the format if zero
+	Files   []string `yaml:"files" toml:"files"`     // Extra files to include, globs relative to the project (e.g. LICENSE)
+}
+
+// validate checks that the rule only requests supported package formats.
+func (r *PackageRule) validate() error {
+	if len(r.Targets) == 0 {
+		return fmt.Errorf("package rule %v has no targets", r.Formats)
+	}
+	for _, format := range r.Formats {
+		if _, ok := lookupPackager(format); !ok && format != "none" {
+			return fmt.Errorf("unsupported package format %q, must be one of %s", format, strings.Join(packageFormats(), ", "))
+		}
+		if tool := compressors[strings.TrimPrefix(format, "tar.")]; tool != "" {
+			if _, err := exec.LookPath(tool); err != nil {
+				return fmt.Errorf("package format %s requires %s to be installed", format, tool)
+			}
+		}
+	}
+	for _, pattern := range r.Files {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid package file pattern %q: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// ArchiveRules returns the package rules archiving the outputs of every target in
+// the given format (tar.gz, zip), or zip for windows and tar.gz elsewhere if auto,
+// including the given extra files.
+func ArchiveRules(format string, files []string) ([]PackageRule, error) {
+	switch format {
+	case "auto":
+		return []PackageRule{
+			{Targets: []string{"windows/*"}, Formats: []string{"zip"}, Files: files},
+			{Targets: []string{"*/*"}, Formats: []string{"tar.gz"}, Files: files},
+		}, nil
+	case "tar.gz", "zip":
+		return []PackageRule{{Targets: []string{"*/*"}, Formats: []string{format}, Files: files}}, nil
+	}
+	return nil, fmt.Errorf("unsupported archive format %q, must be tar.gz, zip or auto", format)
+}
+
+// packageRule returns the package rule of a target, nil if it has none.
+func packageRule(rules []PackageRule, target string) *PackageRule {
+	for i, rule := range rules {
+		for _, pattern := range rule.Targets {
+			if matchTarget(pattern, target) {
+				return &rules[i]
+			}
+		}
+	}
+	return nil
+}
+
+// PackageFile is a file to be bundled into a package.
+type PackageFile struct {
+	Path string // Location of the file on the host
+	Name string // Location of the file within the package
+	Doc  bool   // Whether the file is an extra documentation file
+}
+
+// packageOutputs bundles the outputs of every target into the package formats
+// its rule requests, placing the packages next to the outputs. Outputs sharing
+// their name up to the extension (e.g. c-archive libraries and their headers)
+// are bundled together.
+func (b *builder) packageOutputs(artifacts []Artifact) ([]Artifact, error) {
+	var (
+		stems  []string
+		groups = make(map[string][]Artifact)
+	)
+	for _, artifact := range artifacts {
+		if artifact.Target == "" {
+			continue
+		}
+		stem := strings.TrimSuffix(artifact.Path, outputExt(artifact.Path))
+		if _, ok := groups[stem]; !ok {
+			stems = append(stems, stem)
+		}
+		groups[stem] = append(groups[stem], artifact)
+	}
+	// Run the generators to bundle their outputs into every package
+	var generated map[string][]PackageFile
+	if len(b.cfg.Generate) > 0 {
+		root, err := os.MkdirTemp(b.work, "generate-")
+		if err != nil {
+			return nil, err
+		}
+
+		if generated, err = b.generate(artifacts, root); err != nil {
+			return nil, err
+		}
+	}
+	var (
+		packages []Artifact
+		version  = projectVersion(b.cfg.Project.ProjectPath)
+	)
+	for _, stem := range stems {
+		files, target := groups[stem], groups[stem][0].Target
+
+		rule := packageRule(b.cfg.Packages, target)
+		if rule == nil {
+			continue
+		}
+		var entries []PackageFile
+		for _, file := range files {
+			entries = append(entries, PackageFile{Path: file.Path, Name: packagedName(file)})
+		}
+		name := packagedName(files[0])
+		entries = append(entries, generated[strings.TrimSuffix(name, outputExt(name))]...)
+
+		for _, pattern := range rule.Files {
+			matches, _ := filepath.Glob(filepath.Join(b.cfg.Project.ProjectPath, pattern))
+			if len(matches) == 0 {
+				log.Printf("WARNING: No files matching %s to package", pattern)
+			}
+			for _, match := range matches {
+				entries = append(entries, PackageFile{Path: match, Name: filepath.Base(match), Doc: true})
+			}
+		}
+		for _, format := range rule.Formats {
+			name, err := b.outputName(files[0], "."+format)
+			if err != nil {
+				return packages, fmt.Errorf("failed to name %s package of %s: %v", format, filepath.Base(stem), err)
+			}
+			packager, ok := lookupPackager(format)
+			if !ok {
+				continue
+			}
+			path := filepath.Join(filepath.Dir(stem), name)
+			err = packager.Package(b.ctx, &Package{Path: path, Target: target, Version: version, Level: rule.Level, ModTime: epochTime(b.cfg.Flags.Epoch), Files: entries})
+			if errors.Is(err, ErrUnsupportedTarget) {
+				log.Printf("WARNING: Skipping %s package of %s: %v", format, target, err)
+				continue
+			}
+			if err != nil {
+				return packages, fmt.Errorf("failed to package %s as %s: %v", filepath.Base(stem), format, err)
+			}
+			log.Printf("INFO: Packaged %s", path)
+			packages = append(packages, Artifact{Path: path, Target: target, Feature: files[0].Feature})
+		}
+	}
+	return packages, nil
+}
+
+// packagedName returns the name an output is packaged under, stripping the
+// target from its name, e.g. geth.exe for geth-windows-amd64.exe.
+func packagedName(artifact Artifact) string {
+	name := filepath.Base(artifact.Path)
+	ext := outputExt(name)
+	goos := strings.SplitN(artifact.Target, "/", 2)[0]
+	if idx := strings.LastIndex(name, "-"+goos+"-"); idx > 0 {
+		return name[:idx] + ext
+	}
+	return name
+}
+
+// writeTarball bundles a set of files into a tarball with the given compression
+// (gz, xz or zst), stamping them with the given modification time unless zero.
+func writeTarball(path string, entries []PackageFile, compression string, level int, modTime time.Time) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	w, err := compress(out, compression, level)
+	if err != nil {
+		return err
+	}
+	if err := writeTar(w, entries, modTime); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// compress wraps a writer with a compressor, gzip being done in process and the
+// other compressions by piping through their external tools.
+func compress(w io.Writer, compression string, level int) (io.WriteCloser, error) {
+	if compression == "gz" {
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		return gzip.NewWriterLevel(w, level)
+	}
+	args := []string{"-c", "-q"}
+	if level != 0 {
+		args = append(args, "-"+strconv.Itoa(level))
+	}
+	cmd := exec.Command(compressors[compression], args...)
+	cmd.Stdout, cmd.Stderr = w, os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &pipeCompressor{stdin: stdin, cmd: cmd}, nil
+}
+
+// pipeCompressor is an io.WriteCloser feeding an external compressor process.
+type pipeCompressor struct {
+	stdin io.WriteCloser
+	cmd   *exec.Cmd
+}
+
+// Write implements io.Writer, forwarding the data to the compressor.
+func (c *pipeCompressor) Write(p []byte) (int, error) {
+	return c.stdin.Write(p)
+}
+
+// Close implements io.Closer, waiting for the compressor to finish.
+func (c *pipeCompressor) Close() error {
+	if err := c.stdin.Close(); err != nil {
+		return err
+	}
+	return c.cmd.Wait()
+}
+
+// writeTar writes a set of files into a tar stream, stamping them with the given
+// modification time unless zero.
+func writeTar(w io.Writer, entries []PackageFile, modTime time.Time) error {
+	tw := tar.NewWriter(w)
+	for _, entry := range entries {
+		info, err := os.Stat(entry.Path)
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = entry.Name
+		header.Uid, header.Gid, header.Uname, header.Gname = 0, 0, "root", "root"
+		if !modTime.IsZero() {
+			header.ModTime = modTime
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if err := copyFile(tw, entry.Path); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// writeZip bundles a set of files into a zip archive, stamping them with the
+// given modification time unless zero.
+func writeZip(path string, entries []PackageFile, level int, modTime time.Time) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	zw := zip.NewWriter(out)
+	if level != 0 {
+		zw.RegisterCompressor(zip.Deflate, func(w io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(w, level)
+		})
+	}
+	for _, entry := range entries {
+		info, err := os.Stat(entry.Path)
+		if err != nil {
+			return err
+		}
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name, header.Method = entry.Name, zip.Deflate
+		if !modTime.IsZero() {
+			header.Modified = modTime
+		}
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if err := copyFile(w, entry.Path); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// writeDeb bundles a set of Linux outputs into a Debian package, installing the
+// binaries into /usr/bin, libraries into /usr/lib, headers into /usr/include and
+// the extra files into /usr/share/doc. The files and archive members are stamped
+// with the given modification time, the current time if zero.
+func writeDeb(path string, target string, entries []PackageFile, version string, level int, modTime time.Time) error {
+	base, _ := splitLibc(target)
+	_, goarch, variant := targetPlatform(base)
+	if goarch == "arm" {
+		goarch += "-" + variant
+	}
+	arch := debArches[goarch] // Micro-architecture levels and C libraries share the base architecture
+	if arch == "" {
+		return fmt.Errorf("no Debian architecture known for %s", target)
+	}
+	name := strings.TrimSuffix(entries[0].Name, outputExt(entries[0].Name))
+
+	// Assemble the installed file tree and the package metadata
+	installed := make([]PackageFile, len(entries))
+	for i, entry := range entries {
+		installed[i] = entry
+		switch {
+		case entry.Doc:
+			installed[i].Name = "./usr/share/doc/" + name + "/" + entry.Name
+		case filepath.Ext(entry.Name) == ".a", filepath.Ext(entry.Name) == ".so":
+			installed[i].Name = "./usr/lib/" + entry.Name
+		case filepath.Ext(entry.Name) == ".h":
+			installed[i].Name = "./usr/include/" + entry.Name
+		default:
+			installed[i].Name = "./usr/bin/" + entry.Name
+		}
+	}
+	var data bytes.Buffer
+	gz, err := compress(&data, "gz", level)
+	if err != nil {
+		return err
+	}
+	if err := writeTar(gz, installed, modTime); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	if modTime.IsZero() {
+		modTime = time.Now()
+	}
+	control := fmt.Sprintf("Package: %s\nVersion: %s\nArchitecture: %s\nMaintainer: unknown\nDescription: %s\n", name, version, arch, name)
+
+	var meta bytes.Buffer
+	gz = gzip.NewWriter(&meta)
+	tw := tar.NewWriter(gz)
+	if err := tw.WriteHeader(&tar.Header{Name: "./control", Mode: 0644, Size: int64(len(control)), ModTime: modTime}); err != nil {
+		return err
+	}
+	if _, err := tw.Write([]byte(control)); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	// Pack everything into the ar archive of the Debian package
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := io.WriteString(out, "!<arch>\n"); err != nil {
+		return err
+	}
+	members := []struct {
+		name string
+		data []byte
+	}{
+		{"debian-binary", []byte("2.0\n")},
+		{"control.tar.gz", meta.Bytes()},
+		{"data.tar.gz", data.Bytes()},
+	}
+	for _, member := range members {
+		header := fmt.Sprintf("%-16s%-12d%-6d%-6d%-8s%-10d`\n", member.name, modTime.Unix(), 0, 0, "100644", len(member.data))
+		if _, err := io.WriteString(out, header); err != nil {
+			return err
+		}
+		if _, err := out.Write(member.data); err != nil {
+			return err
+		}
+		if len(member.data)%2 == 1 {
+			if _, err := io.WriteString(out, "\n"); err != nil {
+				return err
+			}
+		}
+	}
+	return out.Close()
+}
+
+// copyFile streams the content of a file into a writer.
+func copyFile(w io.Writer, path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	_, err = io.Copy(w, in)
+	return err
+}
+
+// projectVersion returns the version of the project from its latest git tag,
+// falling back to 0.0.0 if it's not tagged.
+func projectVersion(project string) string {
+	version := strings.TrimPrefix(gitOutput(project, "describe", "--tags", "--abbrev=0"), "v")
+	if version == "" || version[0] < '0' || version[0] > '9' {
+		return "0.0.0"
+	}
+	return version
+}
@@ -0,0 +1,101 @@
+package xgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Package is a package to bundle the outputs of a target into.
+type Package struct {
+	Path    string        // Package file to write
+	Target  string        // Target the outputs were built for
+	Version string        // Version of the project from its latest git tag, 0.0.0 if untagged
+	Level   int           // Compression level, the default of the format if zero
+	ModTime time.Time     // Modification time of the packaged files (SOURCE_DATE_EPOCH), their own ones if zero
+	Files   []PackageFile // Files to bundle, the outputs first and the extra files last
+}
+
+// Packager produces the packages of a format, e.g. tar.gz or deb.
+type Packager interface {
+	Package(ctx context.Context, pkg *Package) error
+}
+
+// PackagerFunc adapts a function into a Packager.
+type PackagerFunc func(ctx context.Context, pkg *Package) error
+
+// Package implements Packager, calling the function.
+func (f PackagerFunc) Package(ctx context.Context, pkg *Package) error {
+	return f(ctx, pkg)
+}
+
+// ErrUnsupportedTarget is returned (possibly wrapped) by the packagers not
+// supporting the target of a package, which is skipped with a warning.
+var ErrUnsupportedTarget = errors.New("unsupported target")
+
+var (
+	packagers = map[string]Packager{
+		"tar.gz":  tarPackager("gz"),
+		"tar.xz":  tarPackager("xz"),
+		"tar.zst": tarPackager("zst"),
+		"zip": PackagerFunc(func(ctx context.Context, pkg *Package) error {
+			return writeZip(pkg.Path, pkg.Files, pkg.Level, pkg.ModTime)
+		}),
+		"deb": PackagerFunc(func(ctx context.Context, pkg *Package) error {
+			if !strings.HasPrefix(pkg.Target, "linux/") {
+				return fmt.Errorf("%w, only linux targets are packaged", ErrUnsupportedTarget)
+			}
+			return writeDeb(pkg.Path, pkg.Target, pkg.Files, pkg.Version, pkg.Level, pkg.ModTime)
+		}),
+	}
+	packagersLock sync.RWMutex // Guards the packagers registered by embedders
+)
+
+// tarPackager returns the packager of the tarballs with the given compression.
+func tarPackager(compression string) Packager {
+	return PackagerFunc(func(ctx context.Context, pkg *Package) error {
+		return writeTarball(pkg.Path, pkg.Files, compression, pkg.Level, pkg.ModTime)
+	})
+}
+
+// RegisterPackager makes a package format available to the package rules, so
+// that tools embedding xgo can add their own formats (e.g. ips or pkgsrc). The
+// format is also the extension of the packages. It panics if the format is taken.
+func RegisterPackager(format string, packager Packager) {
+	packagersLock.Lock()
+	defer packagersLock.Unlock()
+
+	if format == "" || format == "none" || strings.ContainsAny(format, "/\\ ") || packager == nil {
+		panic(fmt.Sprintf("xgo: invalid packager %q", format))
+	}
+	if _, ok := packagers[format]; ok {
+		panic(fmt.Sprintf("xgo: packager %s registered twice", format))
+	}
+	packagers[format] = packager
+}
+
+// lookupPackager returns the packager of a package format.
+func lookupPackager(format string) (Packager, bool) {
+	packagersLock.RLock()
+	defer packagersLock.RUnlock()
+
+	packager, ok := packagers[format]
+	return packager, ok
+}
+
+// packageFormats returns the sorted supported package formats.
+func packageFormats() []string {
+	packagersLock.RLock()
+	defer packagersLock.RUnlock()
+
+	formats := make([]string, 0, len(packagers))
+	for format := range packagers {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
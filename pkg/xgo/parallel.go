@@ -0,0 +1,119 @@
+package xgo
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+)
+
+// compileParallel cross builds a requested package in a dedicated container per
+// target, running at most limit builds concurrently. The output of each build is
+// prefixed with its target, failed builds are retried if requested and all the
+// failures are reported once finished.
+func (b *builder) compileParallel() error {
+	config, limit := &b.cfg.Project, b.cfg.Parallel
+
+	targets := ExpandTargets(config.Targets)
+	if len(targets) <= 1 {
+		return b.compile()
+	}
+	log.Printf("INFO: Cross compiling project %s package %s for %d targets, %d at a time...", config.ProjectPath, config.CmdPath, len(targets), limit)
+
+	// Assemble the container arguments upfront, as it may modify the environment
+	cmds, commits := make([][]string, len(targets)), make([]string, len(targets))
+	for i, target := range targets {
+		conf := *config
+		conf.Targets = []string{target}
+
+		build, image, commit := b.warmStart(&conf)
+		args, err := b.containerArgs(build)
+		if err != nil {
+			return err
+		}
+		cmds[i], commits[i] = append(args, image, build.CmdPath), commit
+	}
+	var (
+		lock   sync.Mutex
+		wg     sync.WaitGroup
+		errs   = make([]error, len(targets))
+		tokens = make(chan struct{}, limit)
+	)
+	for i := range targets {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			tokens <- struct{}{}
+			defer func() { <-tokens }()
+
+			out := &prefixWriter{prefix: "[" + targets[i] + "] ", out: b.stdout, lock: &lock}
+			for attempt := 0; attempt <= b.cfg.Retries; attempt++ {
+				if attempt > 0 {
+					fmt.Fprintf(out, "Retrying in a fresh container (attempt %d of %d)...\n", attempt, b.cfg.Retries)
+				}
+				b.startTarget(targets[i], "")
+				errs[i] = b.runContainer(cmds[i], config, commits[i], out, out)
+				b.finishTargets(targets[i:i+1], errs[i])
+				if errs[i] == nil {
+					break
+				}
+			}
+			out.Flush()
+		}(i)
+	}
+	wg.Wait()
+
+	var failures []string
+	for i, err := range errs {
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", targets[i], err))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%d of %d targets failed (%s)", len(failures), len(targets), strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// prefixWriter is an io.Writer prefixing every line with a fixed string, writing
+// only complete lines to the shared output to avoid interleaving them.
+type prefixWriter struct {
+	prefix string
+	out    io.Writer
+	lock   *sync.Mutex
+	buf    []byte // Trailing incomplete line of the previous write
+}
+
+// Write implements io.Writer, forwarding all the completed lines.
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+
+	var lines bytes.Buffer
+	for {
+		idx := bytes.IndexByte(w.buf, '\n')
+		if idx < 0 {
+			break
+		}
+		lines.WriteString(w.prefix)
+		lines.Write(w.buf[:idx+1])
+		w.buf = w.buf[idx+1:]
+	}
+	if lines.Len() > 0 {
+		w.lock.Lock()
+		defer w.lock.Unlock()
+		if _, err := w.out.Write(lines.Bytes()); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush forwards any trailing incomplete line.
+func (w *prefixWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.Write([]byte{'\n'})
+	}
+}
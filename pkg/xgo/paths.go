@@ -0,0 +1,45 @@
+package xgo
+
+import (
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// isLocalPath checks whether a project is given as a local path as opposed to
+// a canonical import path, including Windows drive, UNC and long paths.
+func isLocalPath(path string) bool {
+	return filepath.IsAbs(path) || strings.HasPrefix(path, string(filepath.Separator)) ||
+		strings.HasPrefix(path, ".") || strings.HasPrefix(path, `\\`)
+}
+
+// mountPath converts a host path into the form docker expects within volume
+// specifications. On Windows, long path (\\?\) prefixes are stripped, UNC shares
+// are converted to //server/share and backslashes to forward slashes.
+func mountPath(path string) string {
+	if runtime.GOOS != "windows" {
+		return path
+	}
+	return windowsMountPath(path)
+}
+
+// windowsMountPath implements mountPath for Windows hosts.
+func windowsMountPath(path string) string {
+	switch {
+	case strings.HasPrefix(path, `\\?\UNC\`):
+		path = `\\` + path[len(`\\?\UNC\`):]
+	case strings.HasPrefix(path, `\\?\`):
+		path = path[len(`\\?\`):]
+	}
+	return strings.Replace(path, `\`, "/", -1)
+}
+
+// volume assembles a docker volume specification mounting a host path into the
+// container, with optional mount options (e.g. ro).
+func volume(host string, container string, options ...string) string {
+	spec := mountPath(host) + ":" + container
+	if len(options) > 0 {
+		spec += ":" + strings.Join(options, ",")
+	}
+	return spec
+}
@@ -0,0 +1,44 @@
+package xgo
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+)
+
+// dockerPlatform converts a Linux target into the platform notation of docker
+// (TARGETPLATFORM), e.g. linux/arm/v7 for linux/arm-7 or linux/amd64/v3 for
+// linux/amd64-v3. Levels unknown to docker are left out (e.g. mips-softfloat).
+func dockerPlatform(target string) (string, bool) {
+	target, _ = splitLibc(target)
+	goos, goarch, variant := targetPlatform(target)
+	if goos != "linux" {
+		return "", false
+	}
+	switch {
+	case goarch == "arm" && variant != "":
+		return "linux/arm/v" + variant, true
+	case goarch == "amd64" && variant != "" && variant != "v1":
+		return "linux/amd64/" + variant, true
+	}
+	return "linux/" + goarch, true
+}
+
+// moveToPlatformDirs moves the Linux outputs into per-platform folders named
+// after their docker platform (e.g. linux/arm64/geth), so a multi-arch image
+// build can copy them from $TARGETPLATFORM without any renaming.
+func moveToPlatformDirs(artifacts []Artifact) error {
+	for i, artifact := range artifacts {
+		platform, ok := dockerPlatform(artifact.Target)
+		if !ok {
+			continue
+		}
+		path := filepath.Join(filepath.Dir(artifact.Path), filepath.FromSlash(platform), packagedName(artifact))
+		log.Printf("INFO: Moving %s to %s", artifact.Path, path)
+		if err := moveFile(artifact.Path, path); err != nil {
+			return fmt.Errorf("failed to move %s: %v", artifact.Path, err)
+		}
+		artifacts[i].Path = path
+	}
+	return nil
+}
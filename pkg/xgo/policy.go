@@ -0,0 +1,104 @@
+package xgo
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+)
+
+// ImagePolicy is an organization allowlist of the images to build in, enforcing
+// approved toolchains.
+type ImagePolicy struct {
+	Images []string `json:"images" yaml:"images" toml:"images"` // Allowed image references: repository globs (e.g. registry.example.com/xgo/*), optionally with a tag glob or a content digest
+}
+
+// validate checks the allowlist entries of the policy.
+func (p *ImagePolicy) validate() error {
+	if len(p.Images) == 0 {
+		return errors.New("image policy allows no image")
+	}
+	for _, entry := range p.Images {
+		repo, tag, digest := splitImage(entry)
+		if repo == "" || strings.ContainsAny(entry, " \t\r\n") {
+			return fmt.Errorf("invalid image policy entry %q", entry)
+		}
+		if _, err := path.Match(repo, ""); err != nil {
+			return fmt.Errorf("invalid image policy entry %q: %v", entry, err)
+		}
+		if _, err := path.Match(tag, ""); err != nil {
+			return fmt.Errorf("invalid image policy entry %q: %v", entry, err)
+		}
+		if digest != "" && !strings.HasPrefix(digest, "sha256:") {
+			return fmt.Errorf("invalid image policy entry %q, digests must be sha256:<hex>", entry)
+		}
+	}
+	return nil
+}
+
+// allows reports whether the policy allows an image with the given content
+// digest. If the digest isn't resolved yet (the image not being pulled), the
+// entries pinning digests are deferred to the check of the resolved digest,
+// only the repository and tag of the image being checked against them.
+func (p *ImagePolicy) allows(image string, digest string, resolved bool) bool {
+	repo, tag, pinned := splitImage(image)
+	repo = canonicalRepo(repo)
+	if digest == "" {
+		digest = pinned
+	}
+	for _, entry := range p.Images {
+		allowedRepo, allowedTag, allowedDigest := splitImage(entry)
+		if ok, _ := path.Match(canonicalRepo(allowedRepo), repo); !ok {
+			continue
+		}
+		if allowedTag != "" {
+			if ok, _ := path.Match(allowedTag, tag); !ok {
+				continue
+			}
+		}
+		if allowedDigest != "" && (resolved || digest != "") && allowedDigest != digest {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// canonicalRepo expands the short forms of the Docker Hub repositories, e.g.
+// golang into docker.io/library/golang, for them to match the policy entries
+// either way.
+func canonicalRepo(repo string) string {
+	if imageRegistry(repo) != "docker.io" || strings.HasPrefix(repo, "docker.io/") {
+		return repo
+	}
+	if !strings.Contains(repo, "/") {
+		repo = "library/" + repo
+	}
+	return "docker.io/" + repo
+}
+
+// checkImagePolicy refuses building in an image outside of the image policy,
+// unless the policy is overridden in which case a warning is logged instead.
+// The image reference is checked before pulling, its resolved digest after.
+func (b *builder) checkImagePolicy(digest string, resolved bool) error {
+	policy := b.cfg.ImagePolicy
+	if policy == nil || b.cfg.Image == "" || policy.allows(b.cfg.Image, digest, resolved) {
+		return nil
+	}
+	if resolved && b.cfg.PolicyOverride && !policy.allows(b.cfg.Image, "", false) {
+		return nil // Already warned about before pulling
+	}
+	image := b.cfg.Image
+	switch {
+	case resolved && digest == "":
+		image += " (digest unresolved)"
+	case resolved:
+		image = fmt.Sprintf("%s (digest %s)", image, digest)
+	}
+	if b.cfg.PolicyOverride {
+		log.Printf("WARNING: Image %s is not allowed by the image policy, overridden", image)
+		return nil
+	}
+	return fmt.Errorf("image %s is not allowed by the image policy, use an approved image or override the policy", image)
+}
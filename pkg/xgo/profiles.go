@@ -0,0 +1,93 @@
+package xgo
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// TargetProfile is a custom toolchain to cross compile a single target with,
+// superseding the builtin toolchains of the builder image.
+type TargetProfile struct {
+	GOOS      string   `json:"goos" yaml:"goos" toml:"goos"`                                  // Go operating system, derived from the target if empty
+	GOARCH    string   `json:"goarch" yaml:"goarch" toml:"goarch"`                            // Go architecture, derived from the target if empty
+	GOARM     string   `json:"goarm" yaml:"goarm" toml:"goarm"`                               // Go ARM version, derived from the target variant if empty
+	CC        string   `json:"cc" yaml:"cc" toml:"cc"`                                        // C cross compiler to use
+	CXX       string   `json:"cxx" yaml:"cxx" toml:"cxx"`                                     // C++ cross compiler to use
+	Host      string   `json:"host" yaml:"host" toml:"host"`                                  // Host triple to configure CGO dependencies with
+	Sysroot   string   `json:"sysroot" yaml:"sysroot" toml:"sysroot"`                         // Target system root within the container
+	PkgConfig string   `json:"pkg_config_path" yaml:"pkg_config_path" toml:"pkg_config_path"` // Search path of the target pkg-config files
+	CFlags    string   `json:"cflags" yaml:"cflags" toml:"cflags"`                            // Extra flags to pass to the C compiler
+	LdFlags   string   `json:"ldflags" yaml:"ldflags" toml:"ldflags"`                         // Extra flags to pass to the C linker
+	Volumes   []string `json:"volumes" yaml:"volumes" toml:"volumes"`                         // Host folders to mount, in host:container form
+}
+
+// LoadProfiles reads a set of custom target profiles from a JSON file, keyed by
+// the os/arch(-variant) target they build.
+func LoadProfiles(path string) (map[string]*TargetProfile, error) {
+	blob, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	profiles := make(map[string]*TargetProfile)
+	if err := json.Unmarshal(blob, &profiles); err != nil {
+		return nil, err
+	}
+	for target, profile := range profiles {
+		if err := profile.Resolve(target); err != nil {
+			return nil, err
+		}
+	}
+	return profiles, nil
+}
+
+// Resolve validates the profile and fills in any Go platform settings that can
+// be derived from the target it builds, e.g. linux/arm-7.
+func (p *TargetProfile) Resolve(target string) error {
+	parts := strings.Split(target, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" || strings.Contains(target, "*") {
+		return fmt.Errorf("invalid profile target %q, must be os/arch(-variant)", target)
+	}
+	if p.CC == "" {
+		return fmt.Errorf("profile %s has no C compiler set", target)
+	}
+	arch, variant := parts[1], ""
+	if idx := strings.Index(arch, "-"); idx >= 0 {
+		arch, variant = arch[:idx], arch[idx+1:]
+	}
+	if p.GOOS == "" {
+		p.GOOS = parts[0]
+	}
+	if p.GOARCH == "" {
+		p.GOARCH = arch
+	}
+	if p.GOARM == "" && p.GOARCH == "arm" {
+		p.GOARM = variant
+	}
+	return nil
+}
+
+// profileEnv converts the profiles into environment variables for the build
+// script, each field being stored in PROFILE_<OS>_<ARCH>_<FIELD>.
+func profileEnv(profiles map[string]*TargetProfile) []string {
+	var env []string
+	for target, p := range profiles {
+		prefix := "PROFILE_" + envSuffix(target) + "_"
+		env = append(env,
+			prefix+"GOOS="+p.GOOS,
+			prefix+"GOARCH="+p.GOARCH,
+			prefix+"GOARM="+p.GOARM,
+			prefix+"CC="+p.CC,
+			prefix+"CXX="+p.CXX,
+			prefix+"HOST="+p.Host,
+			prefix+"SYSROOT="+p.Sysroot,
+			prefix+"PKG_CONFIG_PATH="+p.PkgConfig,
+			prefix+"CFLAGS="+p.CFlags,
+			prefix+"LDFLAGS="+p.LdFlags,
+		)
+	}
+	sort.Strings(env)
+	return env
+}
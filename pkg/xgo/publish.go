@@ -0,0 +1,262 @@
+package xgo
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Publisher distributes the artifacts of a finished build, e.g. as the assets of
+// a release. The artifact paths of the manifest are relative to its Dir.
+type Publisher interface {
+	Publish(ctx context.Context, manifest *Manifest) error
+}
+
+// PublisherFactory creates a publisher distributing to the given destination,
+// the part of a publish spec following the publisher name (e.g. owner/repo).
+type PublisherFactory func(dest string) (Publisher, error)
+
+var (
+	publishers = map[string]PublisherFactory{
+		"github":          newGitHubPublisher,
+		"gitlab":          newGitLabPublisher,
+		"gitlab-packages": newGitLabPackagesPublisher,
+		"gitea":           newGiteaPublisher,
+		"s3":              newS3Publisher,
+		"registry":        newRegistryPublisher,
+		"rekor":           newRekorPublisher,
+	}
+	publishersLock sync.RWMutex // Guards the publishers registered by embedders
+)
+
+// RegisterPublisher makes a publisher available under the given name, so that
+// tools embedding xgo can hook their own distribution systems into the publish
+// specs of a build (<name>:<destination>). It panics if the name is taken.
+func RegisterPublisher(name string, factory PublisherFactory) {
+	publishersLock.Lock()
+	defer publishersLock.Unlock()
+
+	if name == "" || strings.Contains(name, ":") || factory == nil {
+		panic(fmt.Sprintf("xgo: invalid publisher %q", name))
+	}
+	if _, ok := publishers[name]; ok {
+		panic(fmt.Sprintf("xgo: publisher %s registered twice", name))
+	}
+	publishers[name] = factory
+}
+
+// NewPublisher creates the publisher of a publish spec in the form of
+// <name>:<destination> (e.g. github:owner/repo or s3://bucket/prefix).
+func NewPublisher(spec string) (Publisher, error) {
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, fmt.Errorf("invalid publish spec %q, must be <name>:<destination>", spec)
+	}
+	publishersLock.RLock()
+	factory, ok := publishers[parts[0]]
+	publishersLock.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown publisher %s in %q", parts[0], spec)
+	}
+	publisher, err := factory(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid publish spec %q: %v", spec, err)
+	}
+	return publisher, nil
+}
+
+// publishArtifacts hands the manifest of the artifacts to every publisher of the
+// build, in order.
+func (b *builder) publishArtifacts(dir string, artifacts []Artifact) error {
+	manifest, err := b.newManifest(dir, artifacts)
+	if err != nil {
+		return err
+	}
+	for i, publisher := range b.publish {
+		log.Printf("INFO: Publishing %d artifacts with %s...", len(manifest.Artifacts), b.cfg.Publish[i])
+		if err := publisher.Publish(b.ctx, manifest); err != nil {
+			return fmt.Errorf("%s: %v", b.cfg.Publish[i], err)
+		}
+	}
+	return nil
+}
+
+// runPublishTool runs the CLI tool of a built-in publisher from the folder of the
+// artifacts, surfacing its output on failure.
+func runPublishTool(ctx context.Context, dir string, name string, args ...string) error {
+	if _, err := exec.LookPath(name); err != nil {
+		return fmt.Errorf("%s not found, required to publish", name)
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s %s failed: %v\n%s", name, args[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// artifactPaths lists the paths of the manifest artifacts, relative to its Dir.
+func artifactPaths(manifest *Manifest) []string {
+	paths := make([]string, len(manifest.Artifacts))
+	for i, artifact := range manifest.Artifacts {
+		paths[i] = filepath.FromSlash(artifact.Path)
+	}
+	return paths
+}
+
+// gitHubPublisher uploads the artifacts as the assets of the GitHub release of
+// the project tag, creating the release if missing and setting its notes if any
+// (gh CLI, GH_TOKEN).
+type gitHubPublisher struct {
+	repo string // Repository to publish the release in (owner/repo)
+}
+
+func newGitHubPublisher(dest string) (Publisher, error) {
+	if strings.Count(dest, "/") != 1 || strings.HasPrefix(dest, "/") || strings.HasSuffix(dest, "/") {
+		return nil, errors.New("destination must be a GitHub repository (owner/repo)")
+	}
+	return &gitHubPublisher{repo: dest}, nil
+}
+
+func (p *gitHubPublisher) Publish(ctx context.Context, manifest *Manifest) error {
+	if manifest.Tag == "" {
+		return errors.New("no git tag to publish a release for")
+	}
+	if exec.CommandContext(ctx, "gh", "release", "view", manifest.Tag, "--repo", p.repo).Run() != nil {
+		if err := runPublishTool(ctx, manifest.Dir, "gh", "release", "create", manifest.Tag, "--repo", p.repo, "--verify-tag", "--title", manifest.Tag, "--notes", manifest.Notes); err != nil {
+			return err
+		}
+	} else if manifest.Notes != "" {
+		if err := runPublishTool(ctx, manifest.Dir, "gh", "release", "edit", manifest.Tag, "--repo", p.repo, "--notes", manifest.Notes); err != nil {
+			return err
+		}
+	}
+	args := append([]string{"release", "upload", manifest.Tag, "--repo", p.repo, "--clobber"}, artifactPaths(manifest)...)
+	return runPublishTool(ctx, manifest.Dir, "gh", args...)
+}
+
+// gitLabPublisher uploads the artifacts as the assets of the GitLab release of
+// the project tag, creating the release with its notes if missing (glab CLI,
+// GITLAB_TOKEN and GITLAB_HOST).
+type gitLabPublisher struct {
+	repo string // Project to publish the release in (group/project, subgroups allowed)
+}
+
+func newGitLabPublisher(dest string) (Publisher, error) {
+	if !strings.Contains(dest, "/") || strings.HasPrefix(dest, "/") || strings.HasSuffix(dest, "/") {
+		return nil, errors.New("destination must be a GitLab project (group/project)")
+	}
+	return &gitLabPublisher{repo: dest}, nil
+}
+
+func (p *gitLabPublisher) Publish(ctx context.Context, manifest *Manifest) error {
+	if manifest.Tag == "" {
+		return errors.New("no git tag to publish a release for")
+	}
+	if exec.CommandContext(ctx, "glab", "release", "view", manifest.Tag, "--repo", p.repo).Run() != nil {
+		if err := runPublishTool(ctx, manifest.Dir, "glab", "release", "create", manifest.Tag, "--repo", p.repo, "--name", manifest.Tag, "--notes", manifest.Notes); err != nil {
+			return err
+		}
+	}
+	args := append([]string{"release", "upload", manifest.Tag, "--repo", p.repo}, artifactPaths(manifest)...)
+	return runPublishTool(ctx, manifest.Dir, "glab", args...)
+}
+
+// s3Publisher copies the artifacts into an S3 bucket, keeping their paths below
+// the prefix of the destination (aws CLI and its credentials).
+type s3Publisher struct {
+	url string // Bucket and prefix to copy into (s3://bucket/prefix)
+}
+
+func newS3Publisher(dest string) (Publisher, error) {
+	dest = strings.Trim(strings.TrimPrefix(dest, "//"), "/")
+	if dest == "" {
+		return nil, errors.New("destination must be an S3 bucket (s3://bucket/prefix)")
+	}
+	return &s3Publisher{url: "s3://" + dest}, nil
+}
+
+func (p *s3Publisher) Publish(ctx context.Context, manifest *Manifest) error {
+	for _, artifact := range manifest.Artifacts {
+		if err := runPublishTool(ctx, manifest.Dir, "aws", "s3", "cp", "--only-show-errors", filepath.FromSlash(artifact.Path), p.url+"/"+artifact.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// registryPublisher pushes the artifacts as an OCI artifact into a container
+// registry, tagged with the project version unless tagged explicitly (oras CLI,
+// logged in via docker login).
+type registryPublisher struct {
+	ref string // Repository to push into, optionally tagged (e.g. ghcr.io/owner/app)
+}
+
+func newRegistryPublisher(dest string) (Publisher, error) {
+	if repo, _, digest := splitImage(dest); repo == "" || digest != "" {
+		return nil, errors.New("destination must be a registry repository (e.g. ghcr.io/owner/app)")
+	}
+	return &registryPublisher{ref: dest}, nil
+}
+
+func (p *registryPublisher) Publish(ctx context.Context, manifest *Manifest) error {
+	ref := p.ref
+	if _, tag, _ := splitImage(ref); tag == "" {
+		ref += ":" + manifest.Version
+	}
+	args := append([]string{"push", ref, "--artifact-type", "application/vnd.xgo.artifacts"}, artifactPaths(manifest)...)
+	return runPublishTool(ctx, manifest.Dir, "oras", args...)
+}
+
+// rekorPublisher signs the artifacts with cosign, recording the signatures in
+// the Rekor transparency log, and adds the resulting Sigstore bundles to the
+// manifest for the following publishers to distribute (cosign CLI).
+type rekorPublisher struct {
+	key string // Cosign key reference to sign with, empty for keyless signing
+}
+
+func newRekorPublisher(dest string) (Publisher, error) {
+	if dest == "keyless" {
+		return &rekorPublisher{}, nil
+	}
+	return &rekorPublisher{key: dest}, nil
+}
+
+func (p *rekorPublisher) Publish(ctx context.Context, manifest *Manifest) error {
+	var bundles []ManifestArtifact
+	for _, artifact := range manifest.Artifacts {
+		bundle := artifact.Path + ".sigstore.json"
+
+		args := []string{"sign-blob", "--yes", "--bundle", filepath.FromSlash(bundle)}
+		if p.key != "" {
+			args = append(args, "--key", p.key)
+		}
+		if err := runPublishTool(ctx, manifest.Dir, "cosign", append(args, filepath.FromSlash(artifact.Path))...); err != nil {
+			return err
+		}
+		path := filepath.Join(manifest.Dir, filepath.FromSlash(bundle))
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		sum, err := fileChecksum(path, sha256.New)
+		if err != nil {
+			return err
+		}
+		bundles = append(bundles, ManifestArtifact{Name: filepath.Base(path), Path: bundle, Size: info.Size(), SHA256: sum})
+	}
+	manifest.Artifacts = append(manifest.Artifacts, bundles...)
+	sort.Slice(manifest.Artifacts, func(i, j int) bool {
+		return manifest.Artifacts[i].Path < manifest.Artifacts[j].Path
+	})
+	return nil
+}
@@ -0,0 +1,37 @@
+package xgo
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// imageRegistry returns the registry hosting an image, docker.io if the image
+// reference doesn't name one.
+func imageRegistry(image string) string {
+	repo, _, _ := splitImage(image)
+	if idx := strings.Index(repo, "/"); idx > 0 {
+		if host := repo[:idx]; strings.ContainsAny(host, ".:") || host == "localhost" {
+			return host
+		}
+	}
+	return "docker.io"
+}
+
+// login authenticates the container engine against the registry of an image with
+// the configured credentials, if any. Without them the engine falls back to the
+// credentials of a previous docker login or its credential helpers.
+func (b *builder) login(image string) error {
+	if b.cfg.RegistryUser == "" {
+		return nil
+	}
+	registry := imageRegistry(image)
+	log.Printf("INFO: Logging in to %s as %s...", registry, b.cfg.RegistryUser)
+
+	cmd := b.command("login", "--username", b.cfg.RegistryUser, "--password-stdin", registry)
+	cmd.Stdin = strings.NewReader(b.cfg.RegistryPassword)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to log in to %s: %v: %s", registry, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package xgo
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// ReleaseNotesData is what the release notes templates are executed with.
+type ReleaseNotesData struct {
+	Tag         string          // Tag being released, empty if the built commit is untagged
+	PreviousTag string          // Tag of the previous release, empty if none
+	Version     string          // Version of the project from its latest git tag, 0.0.0 if untagged
+	Commits     []ReleaseCommit // Commits since the previous release, newest first
+}
+
+// ReleaseCommit is a commit going into the release notes, split into the parts
+// of a conventional commit message (<type>(<scope>)!: <description>).
+type ReleaseCommit struct {
+	Hash     string // Full hash of the commit
+	Short    string // Abbreviated hash of the commit
+	Author   string // Name of the commit author
+	Type     string // Conventional commit type (feat, fix...), empty if not a conventional commit
+	Scope    string // Scope of the commit, empty if none
+	Breaking bool   // Whether the commit is a breaking change (! or a BREAKING CHANGE footer)
+	Subject  string // Description of the commit, without its type and scope
+	Body     string // Body of the commit message
+}
+
+// ReleaseNotesConventional is the release notes setting grouping the conventional
+// commits since the previous release by type instead of executing a template.
+const ReleaseNotesConventional = "conventional"
+
+// conventionalSections are the sections of the conventional release notes, in
+// order, keyed by commit type. Other types (docs, chore, ci...) are left out
+// unless breaking.
+var conventionalSections = []struct {
+	kind  string
+	title string
+}{
+	{"feat", "Features"},
+	{"fix", "Bug Fixes"},
+	{"perf", "Performance Improvements"},
+	{"revert", "Reverts"},
+}
+
+var conventionalCommit = regexp.MustCompile(`^([a-zA-Z]+)(?:\(([^)]*)\))?(!)?: *(.+)$`)
+
+// parseReleaseNotes loads the release notes template of the build, nil for the
+// conventional release notes.
+func parseReleaseNotes(cfg *Config) (*template.Template, error) {
+	if cfg.ReleaseNotes == ReleaseNotesConventional {
+		return nil, nil
+	}
+	src := cfg.ReleaseNotes
+	if !filepath.IsAbs(src) {
+		src = filepath.Join(cfg.Project.ProjectPath, src)
+	}
+	if _, err := os.Stat(src); err != nil {
+		return nil, fmt.Errorf("invalid release notes %q, must be %s or a template file: %v", cfg.ReleaseNotes, ReleaseNotesConventional, err)
+	}
+	tmpl, err := template.New(filepath.Base(src)).Option("missingkey=error").ParseFiles(src)
+	if err != nil {
+		return nil, fmt.Errorf("invalid release notes template: %v", err)
+	}
+	return tmpl, nil
+}
+
+// releaseNotes assembles the release notes of the built commit from the commits
+// since the previous tag: the tag before the built one if it is tagged, else the
+// latest one.
+func (b *builder) releaseNotes() (string, error) {
+	project := b.cfg.Project.ProjectPath
+	data := &ReleaseNotesData{
+		Tag:         gitOutput(project, "describe", "--tags", "--exact-match", "HEAD"),
+		PreviousTag: gitOutput(project, "describe", "--tags", "--abbrev=0", "HEAD"),
+		Version:     projectVersion(project),
+	}
+	if data.Tag != "" {
+		data.PreviousTag = gitOutput(project, "describe", "--tags", "--abbrev=0", data.Tag+"^")
+	}
+	args := []string{"log", "--no-merges", "--format=%H%x1f%h%x1f%an%x1f%s%x1f%b%x1e"}
+	if data.PreviousTag != "" {
+		args = append(args, data.PreviousTag+"..HEAD")
+	}
+	for _, entry := range strings.Split(gitOutput(project, args...), "\x1e") {
+		fields := strings.SplitN(strings.TrimSpace(entry), "\x1f", 5)
+		if len(fields) != 5 {
+			continue
+		}
+		data.Commits = append(data.Commits, parseReleaseCommit(fields[0], fields[1], fields[2], fields[3], strings.TrimSpace(fields[4])))
+	}
+	if b.notes == nil {
+		return conventionalNotes(data), nil
+	}
+	var out bytes.Buffer
+	if err := b.notes.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("failed to render the release notes: %v", err)
+	}
+	return out.String(), nil
+}
+
+// parseReleaseCommit splits the message of a commit into its conventional parts,
+// leaving the type empty if it does not follow the convention.
+func parseReleaseCommit(hash, short, author, subject, body string) ReleaseCommit {
+	commit := ReleaseCommit{Hash: hash, Short: short, Author: author, Subject: subject, Body: body}
+	if match := conventionalCommit.FindStringSubmatch(subject); match != nil {
+		commit.Type = strings.ToLower(match[1])
+		commit.Scope = match[2]
+		commit.Breaking = match[3] == "!"
+		commit.Subject = match[4]
+	}
+	if commit.Type != "" && (strings.Contains(body, "BREAKING CHANGE:") || strings.Contains(body, "BREAKING-CHANGE:")) {
+		commit.Breaking = true
+	}
+	return commit
+}
+
+// conventionalNotes renders the commits as markdown sections grouped by type,
+// the breaking changes first and the unconventional commits last.
+func conventionalNotes(data *ReleaseNotesData) string {
+	var out strings.Builder
+	section := func(title string, keep func(commit ReleaseCommit) bool) {
+		var lines []string
+		for _, commit := range data.Commits {
+			if !keep(commit) {
+				continue
+			}
+			line := "- "
+			if commit.Scope != "" {
+				line += "**" + commit.Scope + ":** "
+			}
+			lines = append(lines, line+commit.Subject+" ("+commit.Short+")")
+		}
+		if len(lines) == 0 {
+			return
+		}
+		if out.Len() > 0 {
+			out.WriteString("\n")
+		}
+		fmt.Fprintf(&out, "## %s\n\n%s\n", title, strings.Join(lines, "\n"))
+	}
+	section("Breaking Changes", func(commit ReleaseCommit) bool {
+		return commit.Breaking
+	})
+	for _, s := range conventionalSections {
+		kind := s.kind
+		section(s.title, func(commit ReleaseCommit) bool {
+			return commit.Type == kind && !commit.Breaking
+		})
+	}
+	section("Other Changes", func(commit ReleaseCommit) bool {
+		return commit.Type == ""
+	})
+	return out.String()
+}
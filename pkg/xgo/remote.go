@@ -0,0 +1,200 @@
+package xgo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// isRemoteEngine reports whether the container engine runs on another machine
+// (e.g. an ssh:// or tcp:// docker context), in which case no host folders can
+// be bind mounted into the build containers. Unless forced via the config, it's
+// detected from the engine host environment variables and docker context.
+func (b *builder) isRemoteEngine() bool {
+	switch b.cfg.RemoteEngine {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	for _, env := range []string{"DOCKER_HOST", "CONTAINER_HOST"} {
+		if host := os.Getenv(env); host != "" {
+			return !localEndpoint(host)
+		}
+	}
+	if b.runtime == "docker" {
+		if out, err := b.command("context", "inspect", "--format", "{{.Endpoints.docker.Host}}").Output(); err == nil {
+			return !localEndpoint(strings.TrimSpace(string(out)))
+		}
+	}
+	return false
+}
+
+// localEndpoint checks whether a container engine endpoint is a local socket.
+func localEndpoint(host string) bool {
+	return host == "" || strings.HasPrefix(host, "unix://") || strings.HasPrefix(host, "npipe://")
+}
+
+// runContainer runs a build container with the given run arguments (including the
+// image and its arguments). On remote engines the container's inputs and outputs
+// are transferred by copying them instead of bind mounting, as are the sources of
+// projects ignoring some of their files. The container is kept until it exits, so
+// that failures caused by the OOM killer can be detected, and committed into the
+// given warm start image if it succeeded, none if empty.
+func (b *builder) runContainer(args []string, config *ConfigFlags, commit string, stdout, stderr io.Writer) error {
+	watcher := &killWatcher{out: stdout}
+	if stdout != stderr {
+		stderr = &killWatcher{out: stderr}
+	} else {
+		stderr = watcher
+	}
+	if b.remote {
+		return b.runRemoteBuild(args, config, watcher, stderr)
+	}
+	name := containerName()
+	cmd := b.command(append([]string{"run", "--name", name}, args[2:]...)...) // Replace "run --rm"
+	if source := sourceDir(args); b.ignore != nil && source != "" {
+		// Create the container first to copy the filtered sources in
+		create := b.command(append([]string{"create", "--name", name}, args[2:]...)...)
+		create.Stderr = b.stderr
+		if err := create.Run(); err != nil {
+			return fmt.Errorf("failed to create build container: %v", err)
+		}
+		project, err := filepath.Abs(config.ProjectPath)
+		if err == nil {
+			err = b.copySource(name, project, source)
+		}
+		if err != nil {
+			exec.Command(b.runtime, "rm", "-f", name).Run()
+			return fmt.Errorf("failed to copy sources into build container: %v", err)
+		}
+		cmd = b.command("start", "-a", name)
+		commit = "" // The copied sources would end up in the warm start image
+	}
+	cmd.Stdout, cmd.Stderr = watcher, stderr
+	if err := cmd.Run(); err != nil {
+		err = b.oomError(name, killed(watcher, stderr), err)
+		b.debugFailure(name, args)
+		if !b.cfg.KeepOnFailure {
+			exec.Command(b.runtime, "rm", "-f", name).Run()
+		}
+		return err
+	}
+	if commit != "" {
+		b.commitWarmStart(name, commit, args)
+	}
+	exec.Command(b.runtime, "rm", "-f", name).Run()
+	return nil
+}
+
+// killed checks whether any of the watched outputs reported a killed compiler.
+func killed(writers ...io.Writer) bool {
+	for _, w := range writers {
+		if watcher, ok := w.(*killWatcher); ok && watcher.killed {
+			return true
+		}
+	}
+	return false
+}
+
+// runRemoteBuild runs a build container on a remote engine: the container is
+// created without any bind mounts, the project sources and dependency cache are
+// copied in, and the build outputs copied out into the bin path once done.
+func (b *builder) runRemoteBuild(args []string, config *ConfigFlags, stdout, stderr io.Writer) (buildErr error) {
+	create := []string{"create"}
+	for i := 2; i < len(args); i++ { // Skip "run --rm"
+		switch {
+		case args[i] == "-v":
+			i++
+			continue
+		case strings.HasPrefix(args[i], "EXT_GOPATH=") && args[i] != "EXT_GOPATH=":
+			return errors.New("local GOPATH projects are not supported on remote container engines")
+		}
+		create = append(create, args[i])
+	}
+	source := sourceDir(args) // Folder to copy the project sources into, none if empty
+
+	out, err := b.command(create...).Output()
+	if err != nil {
+		return fmt.Errorf("failed to create build container: %v", err)
+	}
+	id := strings.TrimSpace(string(out))
+	defer func() {
+		if !b.cfg.KeepOnFailure || buildErr == nil {
+			exec.Command(b.runtime, "rm", "-f", id).Run()
+		}
+	}()
+
+	// Copy the build inputs into the container, creating the output folder too
+	empty, err := os.MkdirTemp(b.work, "empty-")
+	if err != nil {
+		return err
+	}
+
+	copies := [][2]string{{empty, "/build"}, {empty, "/deps-cache"}}
+	if fileExists(b.cfg.DepsCache) {
+		copies[1][0] = b.cfg.DepsCache
+	}
+	if b.cfg.ProjectCache != "" && fileExists(b.cfg.ProjectCache) {
+		copies = append(copies, [2]string{b.cfg.ProjectCache, "/deps-cache-project"})
+	}
+	if b.secrets != "" {
+		copies = append(copies, [2]string{b.secrets, "/run/secrets"})
+	}
+	if b.winres != "" {
+		copies = append(copies, [2]string{b.winres, "/xgo-winres"})
+	}
+	var project string
+	if source != "" {
+		if project, err = filepath.Abs(config.ProjectPath); err != nil {
+			return err
+		}
+		if b.ignore == nil {
+			copies = append(copies, [2]string{project, source})
+		}
+	}
+	for _, entry := range copies {
+		log.Printf("INFO: Copying %s into build container %.12s:%s", entry[0], id, entry[1])
+		if err := b.run(b.command("cp", entry[0]+string(filepath.Separator)+".", id+":"+entry[1])); err != nil {
+			return fmt.Errorf("failed to copy %s into build container: %v", entry[0], err)
+		}
+	}
+	if source != "" && b.ignore != nil {
+		if err := b.copySource(id, project, source); err != nil {
+			return fmt.Errorf("failed to copy %s into build container: %v", project, err)
+		}
+	}
+	cmd := b.command("start", "-a", id)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	buildErr = cmd.Run()
+	if buildErr != nil {
+		buildErr = b.oomError(id, killed(stdout, stderr), buildErr)
+		b.debugFailure(id, args)
+	}
+
+	// Retrieve whatever was built, even if some targets failed
+	if err := os.MkdirAll(config.BinPath, 0755); err != nil {
+		return err
+	}
+	log.Printf("INFO: Copying build outputs from container %.12s into %s", id, config.BinPath)
+	if err := b.run(b.command("cp", id+":/build/.", config.BinPath)); err != nil && buildErr == nil {
+		return fmt.Errorf("failed to copy build outputs: %v", err)
+	}
+	return buildErr
+}
+
+// sourceDir returns the folder the project sources are expected at within a build
+// container (/source or /source-ro), empty if the container builds no sources.
+func sourceDir(args []string) string {
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == "-w" && (args[i+1] == "/source" || args[i+1] == "/source-ro") {
+			return args[i+1]
+		}
+	}
+	return ""
+}
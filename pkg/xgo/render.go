@@ -0,0 +1,149 @@
+package xgo
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// RenderFile is a template rendered from the build manifest into the outputs,
+// e.g. an install script embedding the download URLs and checksums.
+type RenderFile struct {
+	Template string `yaml:"template" toml:"template"` // Template file, relative to the project path
+	Output   string `yaml:"output" toml:"output"`     // File to render into, relative to the bin path
+}
+
+// Manifest is the description of a finished build the rendered files are
+// executed with.
+type Manifest struct {
+	Version   string             // Version of the project from its latest git tag, 0.0.0 if untagged
+	Tag       string             // Latest git tag of the project, empty if untagged
+	Commit    string             // Short git commit of the project, empty if not a repository
+	Artifacts []ManifestArtifact // Artifacts produced by the build, sorted by path
+	Dir       string             // Folder the artifact paths are relative to (the bin path)
+	Cache     CacheStats         // Cache hits and misses of the build
+	Notes     string             // Release notes of the build in markdown, empty unless requested
+}
+
+// ManifestArtifact is an artifact produced by a build.
+type ManifestArtifact struct {
+	Name    string // File name of the artifact
+	Path    string // Location of the artifact relative to the bin path
+	Target  string // Target the artifact was built for, empty if none (e.g. checksum files)
+	OS      string // Go operating system of the target
+	Arch    string // Go architecture of the target
+	Variant string // Architecture variant of the target if any
+	Feature string // Feature variant the artifact was built in if any
+	Size    int64  // Size of the artifact in bytes
+	SHA256  string // Hex encoded SHA256 digest of the artifact
+}
+
+// newManifest assembles the manifest of a set of artifacts.
+func (b *builder) newManifest(dir string, artifacts []Artifact) (*Manifest, error) {
+	project := b.cfg.Project.ProjectPath
+	manifest := &Manifest{
+		Version: projectVersion(project),
+		Tag:     gitOutput(project, "describe", "--tags", "--abbrev=0"),
+		Commit:  gitOutput(project, "rev-parse", "--short", "HEAD"),
+		Cache:   b.stats,
+		Dir:     dir,
+	}
+	if b.cfg.ReleaseNotes != "" {
+		notes, err := b.releaseNotes()
+		if err != nil {
+			return nil, err
+		}
+		manifest.Notes = notes
+	}
+	for _, artifact := range artifacts {
+		info, err := os.Stat(artifact.Path)
+		if err != nil {
+			return nil, err
+		}
+		sum, err := fileChecksum(artifact.Path, sha256.New)
+		if err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(dir, artifact.Path)
+		if err != nil {
+			rel = filepath.Base(artifact.Path)
+		}
+		entry := ManifestArtifact{
+			Name:    filepath.Base(artifact.Path),
+			Path:    filepath.ToSlash(rel),
+			Target:  artifact.Target,
+			Feature: artifact.Feature,
+			Size:    info.Size(),
+			SHA256:  sum,
+		}
+		entry.OS, entry.Arch, entry.Variant = targetPlatform(artifact.Target)
+		manifest.Artifacts = append(manifest.Artifacts, entry)
+	}
+	sort.Slice(manifest.Artifacts, func(i, j int) bool {
+		return manifest.Artifacts[i].Path < manifest.Artifacts[j].Path
+	})
+	return manifest, nil
+}
+
+// targetPlatform splits a target into its Go operating system, architecture and
+// architecture variant, e.g. linux/arm-7 into linux, arm and 7.
+func targetPlatform(target string) (goos string, goarch string, variant string) {
+	parts := strings.SplitN(target, "/", 2)
+	if len(parts) != 2 {
+		return "", "", ""
+	}
+	goos, goarch = strings.SplitN(parts[0], "-", 2)[0], parts[1]
+	if idx := strings.Index(goarch, "-"); idx >= 0 {
+		goarch, variant = goarch[:idx], goarch[idx+1:]
+	}
+	return goos, goarch, variant
+}
+
+// renderFiles renders the configured templates from the manifest of the given
+// artifacts into the bin path, keeping the file modes of the templates.
+func (b *builder) renderFiles(dir string, artifacts []Artifact) ([]Artifact, error) {
+	manifest, err := b.newManifest(dir, artifacts)
+	if err != nil {
+		return nil, err
+	}
+	var rendered []Artifact
+	for _, file := range b.cfg.Render {
+		src := filepath.Join(b.cfg.Project.ProjectPath, file.Template)
+		info, err := os.Stat(src)
+		if err != nil {
+			return rendered, err
+		}
+		tmpl, err := template.New(filepath.Base(src)).Option("missingkey=error").ParseFiles(src)
+		if err != nil {
+			return rendered, err
+		}
+		var out bytes.Buffer
+		if err := tmpl.Execute(&out, manifest); err != nil {
+			return rendered, err
+		}
+		dst := filepath.Join(dir, filepath.FromSlash(file.Output))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return rendered, err
+		}
+		if err := os.WriteFile(dst, out.Bytes(), info.Mode().Perm()); err != nil {
+			return rendered, err
+		}
+		log.Printf("INFO: Rendered %s into %s", file.Template, dst)
+		rendered = append(rendered, Artifact{Path: dst})
+	}
+	return rendered, nil
+}
+
+// validate checks that the rendered file has both a template and an output.
+func (f *RenderFile) validate() error {
+	if f.Template == "" || f.Output == "" {
+		return fmt.Errorf("rendered file %s needs both a template and an output", f.Template+f.Output)
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+package xgo
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"debug/buildinfo"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Report is the machine readable summary of a build, written as JSON.
+type Report struct {
+	Started  time.Time         `json:"started"`
+	Duration float64           `json:"duration"` // Seconds the whole build took
+	Success  bool              `json:"success"`
+	Error    string            `json:"error,omitempty"`
+	Image    string            `json:"image,omitempty"`        // Docker image the containerized targets were built in
+	Digest   string            `json:"image_digest,omitempty"` // Resolved content digest of the docker image
+	Cache    *CacheStats       `json:"cache"`                  // Cache hits and misses of the build
+	Flags    map[string]string `json:"flags,omitempty"`        // Build settings shaping the outputs, keyed by flag name
+	Issues   []CompatIssue     `json:"issues,omitempty"`       // Known-bad combinations of the targets with the build settings
+	Targets  []TargetReport    `json:"targets"`
+	Files    []OutputReport    `json:"files,omitempty"` // Artifacts not built for a specific target, e.g. checksum files
+}
+
+// TargetReport is the outcome of the build of a single target.
+type TargetReport struct {
+	Target   string         `json:"target"`
+	Feature  string         `json:"feature,omitempty"` // Feature variant the target was built in, empty if none
+	Success  bool           `json:"success"`
+	Error    string         `json:"error,omitempty"`
+	Duration float64        `json:"duration"` // Seconds the target took to compile, 0 if not built
+	Outputs  []OutputReport `json:"outputs"`
+}
+
+// OutputReport describes a single artifact of a build.
+type OutputReport struct {
+	Path      string            `json:"path"`
+	Size      int64             `json:"size"`
+	SHA256    string            `json:"sha256"`
+	GoVersion string            `json:"go_version,omitempty"` // Go version the binary was built with, empty if not a Go binary
+	Modules   map[string]string `json:"modules,omitempty"`    // Versions of the modules embedded into the binary, keyed by path
+}
+
+// targetRun tracks the compilation of a single target.
+type targetRun struct {
+	start time.Time
+	end   time.Time
+	err   error
+}
+
+// startTarget records the start of the compilation of a target, finishing any
+// target previously compiled in the same container.
+func (b *builder) startTarget(target string, previous string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := time.Now()
+	if run := b.runs[b.runKey(previous)]; previous != "" && run != nil && run.end.IsZero() {
+		run.end = now
+	}
+	b.runs[b.runKey(target)] = &targetRun{start: now}
+}
+
+// finishTargets records the end of the compilations still running, attributing
+// the error of the build (if any) to them.
+func (b *builder) finishTargets(targets []string, err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := time.Now()
+	for _, target := range targets {
+		if run := b.runs[b.runKey(target)]; run != nil && run.end.IsZero() {
+			run.end, run.err = now, err
+		}
+	}
+}
+
+// runKey returns the key of the compilation of a target in the feature variant
+// being built.
+func (b *builder) runKey(target string) string {
+	if b.feature == "" {
+		return target
+	}
+	return b.feature + ":" + target
+}
+
+// progressWriter is an io.Writer forwarding the output of the build script while
+// tracking the targets it compiles from its "Compiling for <target>..." lines.
+type progressWriter struct {
+	b       *builder
+	out     io.Writer
+	buf     []byte   // Trailing incomplete line of the previous write
+	current string   // Target being compiled
+	started []string // Targets compiled so far
+}
+
+// Write implements io.Writer, forwarding everything to the wrapped writer.
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		idx := bytes.IndexByte(w.buf, '\n')
+		if idx < 0 {
+			break
+		}
+		line := strings.TrimSpace(string(w.buf[:idx]))
+		w.buf = w.buf[idx+1:]
+
+		if strings.HasPrefix(line, "Compiling for ") {
+			target := strings.TrimSuffix(strings.Fields(strings.TrimPrefix(line, "Compiling for "))[0], "...")
+			w.b.startTarget(target, w.current)
+			w.current, w.started = target, append(w.started, target)
+		}
+	}
+	return w.out.Write(p)
+}
+
+// writeReport writes the JSON report of a build, listing every requested target
+// with its outputs and the time it took to compile.
+func (b *builder) writeReport(path string, targets []string, start time.Time, artifacts []Artifact, err error) error {
+	report := &Report{
+		Started:  start,
+		Duration: time.Since(start).Seconds(),
+		Success:  err == nil,
+		Targets:  []TargetReport{},
+		Cache:    &b.stats,
+		Flags:    reportFlags(&b.cfg.Flags),
+		Issues:   b.issues,
+	}
+	if err != nil {
+		report.Error = err.Error()
+	}
+	if b.digest != "" {
+		report.Image, report.Digest = b.cfg.Image, b.digest
+	}
+	outputs := make(map[string][]OutputReport)
+	for _, artifact := range artifacts {
+		output := OutputReport{Path: artifact.Path}
+		if info, err := os.Stat(artifact.Path); err == nil {
+			output.Size = info.Size()
+		}
+		output.SHA256, _ = fileChecksum(artifact.Path, sha256.New)
+		output.GoVersion, output.Modules = binaryModules(artifact.Path)
+
+		if artifact.Target == "" {
+			report.Files = append(report.Files, output)
+		} else {
+			key := artifact.Target
+			if artifact.Feature != "" {
+				key = artifact.Feature + ":" + key
+			}
+			outputs[key] = append(outputs[key], output)
+		}
+	}
+	features := []string{""}
+	if len(b.cfg.Variants) > 0 {
+		features = features[:0]
+		for _, variant := range b.cfg.Variants {
+			features = append(features, variant.Name)
+		}
+	}
+	for _, feature := range features {
+		for _, target := range targets {
+			key := target
+			if feature != "" {
+				key = feature + ":" + target
+			}
+			entry := TargetReport{Target: target, Feature: feature, Outputs: outputs[key]}
+			if entry.Outputs == nil {
+				entry.Outputs = []OutputReport{}
+			}
+			run := b.runs[key]
+			switch {
+			case run == nil:
+				entry.Error = "not built"
+			case run.err != nil:
+				entry.Error = run.err.Error()
+			case len(entry.Outputs) == 0:
+				entry.Error = "no outputs produced"
+			default:
+				entry.Success = true
+			}
+			if run != nil && !run.end.IsZero() {
+				entry.Duration = run.end.Sub(run.start).Seconds()
+			}
+			report.Targets = append(report.Targets, entry)
+		}
+	}
+	blob, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(blob, '\n'), 0644)
+}
+
+// reportFlags lists the build settings shaping the outputs by flag name, the
+// per-target ones suffixed with their target pattern (e.g. cgo-cflags[linux/arm64]).
+// Unset settings are left out.
+func reportFlags(flags *BuildFlags) map[string]string {
+	values := map[string]string{
+		"tags":              flags.Tags,
+		"ldflags":           flags.LdFlags,
+		"build-mode":        flags.Mode,
+		"build-vcs":         flags.VCS,
+		"arm-float-abi":     flags.ArmABI,
+		"libc":              flags.Libc,
+		"windows-subsystem": flags.Subsystem,
+	}
+	if flags.Race {
+		values["race"] = "true"
+	}
+	if flags.TrimPath {
+		values["trimpath"] = "true"
+	}
+	for name, targets := range map[string]TargetValues{"cgo-cflags": flags.CgoCFlags, "cgo-ldflags": flags.CgoLdFlags} {
+		for target, value := range targets {
+			key := name
+			if target != "" {
+				key += "[" + target + "]"
+			}
+			values[key] = value
+		}
+	}
+	for pattern, override := range flags.Overrides {
+		blob, _ := json.Marshal(override)
+		values["override["+pattern+"]"] = string(blob)
+	}
+	for name, value := range values {
+		if value == "" || (name == "build-mode" && value == "default") {
+			delete(values, name)
+		}
+	}
+	return values
+}
+
+// binaryModules reads the Go version and the module versions embedded into a Go
+// binary, the main module included, empty if not a Go binary. Replaced modules
+// are versioned as <version> => <replacement>.
+func binaryModules(path string) (string, map[string]string) {
+	info, err := buildinfo.ReadFile(path)
+	if err != nil {
+		return "", nil
+	}
+	modules := make(map[string]string)
+	for _, module := range append([]*debug.Module{&info.Main}, info.Deps...) {
+		if module.Path == "" {
+			continue
+		}
+		version := module.Version
+		if module.Replace != nil {
+			version += " => " + strings.TrimSpace(module.Replace.Path+" "+module.Replace.Version)
+		}
+		modules[module.Path] = version
+	}
+	return info.GoVersion, modules
+}
@@ -0,0 +1,176 @@
+package xgo
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reproducibleFlags returns the build flags producing deterministic outputs: no
+// file system paths nor VCS information embedded and empty build IDs, overridden
+// linker flags included. The fixed SOURCE_DATE_EPOCH is set by sourceDateEpoch.
+func reproducibleFlags(flags BuildFlags) BuildFlags {
+	flags.TrimPath, flags.VCS = true, "false"
+	flags.LdFlags = withEmptyBuildID(flags.LdFlags)
+	if len(flags.Overrides) > 0 {
+		overrides := make(map[string]*TargetOverride, len(flags.Overrides))
+		for pattern, o := range flags.Overrides {
+			if o.LdFlags != "" {
+				copied := *o
+				copied.LdFlags = withEmptyBuildID(o.LdFlags)
+				o = &copied
+			}
+			overrides[pattern] = o
+		}
+		flags.Overrides = overrides
+	}
+	return flags
+}
+
+// sourceDateEpoch resolves the SOURCE_DATE_EPOCH of a build: a number of seconds
+// since the Unix epoch, or git for the commit time of the last commit of the
+// project. Reproducible builds not given one default to the last commit time,
+// or the Unix epoch outside of git repositories.
+func sourceDateEpoch(project string, epoch string, reproducible bool) (string, error) {
+	switch epoch {
+	case "":
+		if !reproducible {
+			return "", nil
+		}
+		if commit := gitOutput(project, "log", "-1", "--format=%ct"); commit != "" {
+			return commit, nil
+		}
+		return "0", nil
+	case "git":
+		commit := gitOutput(project, "log", "-1", "--format=%ct")
+		if commit == "" {
+			return "", fmt.Errorf("no git commit to derive SOURCE_DATE_EPOCH from in %s", project)
+		}
+		return commit, nil
+	default:
+		if seconds, err := strconv.ParseInt(epoch, 10, 64); err != nil || seconds < 0 {
+			return "", fmt.Errorf("invalid SOURCE_DATE_EPOCH %q, must be a number of seconds since the Unix epoch or git", epoch)
+		}
+		return epoch, nil
+	}
+}
+
+// epochTime returns the time of a resolved SOURCE_DATE_EPOCH, zero if unset.
+func epochTime(epoch string) time.Time {
+	seconds, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0).UTC()
+}
+
+// withEmptyBuildID appends an empty build ID to linker flags not setting one.
+func withEmptyBuildID(ldflags string) string {
+	if strings.Contains(ldflags, "-buildid=") {
+		return ldflags
+	}
+	return strings.TrimSpace(ldflags + " -buildid=")
+}
+
+// verifyReproducible builds the targets twice reproducibly, each time with a
+// fresh Go build cache, and compares the checksums of the outputs of both
+// builds, reporting the ones differing. The outputs of the first build are kept
+// in the bin path, the second build going to a temporary folder. Packaging,
+// signing, publishing and caching are skipped, as they don't make binaries.
+func verifyReproducible(ctx context.Context, cfg Config) ([]Artifact, error) {
+	cfg.VerifyRepro, cfg.Reproducible = false, true
+	cfg.Packages, cfg.Generate, cfg.Render, cfg.Checksums, cfg.Publish = nil, nil, nil, nil, nil
+	cfg.ReleaseNotes, cfg.ReportJSON, cfg.ArtifactCache, cfg.TargetBinPaths, cfg.Hooks = "", "", "", nil, nil
+	cfg.CodeSignKey, cfg.WindowsSignPFX, cfg.MacSignIdentity, cfg.MacSignP12, cfg.MacNotarize = "", "", "", "", false
+
+	tmp, err := os.MkdirTemp(cfg.WorkDir, "xgo-reproducible-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	first := cfg
+	first.GoCache = filepath.Join(tmp, "gocache-1")
+	log.Printf("INFO: Building the targets a first time into %s", cfg.Project.BinPath)
+	artifacts, err := Build(ctx, first)
+	if err != nil {
+		return artifacts, err
+	}
+	second := cfg
+	second.GoCache = filepath.Join(tmp, "gocache-2")
+	second.Project.BinPath = filepath.Join(tmp, "bin")
+	if err := os.MkdirAll(second.Project.BinPath, 0755); err != nil {
+		return artifacts, err
+	}
+	log.Printf("INFO: Building the targets a second time to compare")
+	rebuilt, err := Build(ctx, second)
+	if err != nil {
+		return artifacts, fmt.Errorf("failed to rebuild: %v", err)
+	}
+	others := make(map[string]string)
+	for _, artifact := range rebuilt {
+		if rel, err := filepath.Rel(second.Project.BinPath, artifact.Path); err == nil {
+			others[rel] = artifact.Path
+		}
+	}
+	differing := 0
+	for _, artifact := range artifacts {
+		rel, err := filepath.Rel(cfg.Project.BinPath, artifact.Path)
+		if err != nil {
+			return artifacts, err
+		}
+		other, ok := others[rel]
+		if !ok {
+			log.Printf("WARNING: %s: missing from the second build", rel)
+			differing++
+			continue
+		}
+		sum, err := fileChecksum(artifact.Path, sha256.New)
+		if err != nil {
+			return artifacts, err
+		}
+		otherSum, err := fileChecksum(other, sha256.New)
+		if err != nil {
+			return artifacts, err
+		}
+		if sum != otherSum {
+			offset, _ := firstDifference(artifact.Path, other)
+			log.Printf("WARNING: %s: not reproducible, sha256 %s then %s, differing from byte %d", rel, sum, otherSum, offset)
+			differing++
+		}
+	}
+	if differing > 0 {
+		return artifacts, fmt.Errorf("%d of %d outputs are not reproducible", differing, len(artifacts))
+	}
+	log.Printf("INFO: All %d outputs are reproducible", len(artifacts))
+	return artifacts, nil
+}
+
+// firstDifference returns the offset of the first byte differing between two
+// files, the length of the shorter one if it is a prefix of the other.
+func firstDifference(a string, b string) (int, error) {
+	blobA, err := os.ReadFile(a)
+	if err != nil {
+		return 0, err
+	}
+	blobB, err := os.ReadFile(b)
+	if err != nil {
+		return 0, err
+	}
+	n := len(blobA)
+	if len(blobB) < n {
+		n = len(blobB)
+	}
+	for i := 0; i < n; i++ {
+		if blobA[i] != blobB[i] {
+			return i, nil
+		}
+	}
+	return n, nil
+}
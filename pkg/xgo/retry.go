@@ -0,0 +1,65 @@
+package xgo
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// retryTargets rebuilds the targets left without outputs by a failed shared
+// container build, each in a fresh container of its own, up to the configured
+// number of retries. Flaky CGO configure steps and downloads thus don't require
+// rerunning the whole target matrix. Only the targets the build script started
+// compiling are retried, the ones it skipped (e.g. for lack of a toolchain) not
+// producing any outputs in a fresh container either.
+func (b *builder) retryTargets(config *ConfigFlags, since time.Time, buildErr error) error {
+	artifacts := collectArtifacts(config.BinPath, since)
+
+	var failed []string
+	for _, target := range ExpandTargets(config.Targets) {
+		if !b.startedSince(target, since) {
+			continue
+		}
+		built := false
+		for _, artifact := range artifacts {
+			built = built || builtFor(artifact.Target, target)
+		}
+		if !built {
+			failed = append(failed, target)
+		}
+	}
+	if len(failed) == 0 {
+		return buildErr
+	}
+	var failures []string
+	for _, target := range failed {
+		var err error
+		for attempt := 1; attempt <= b.cfg.Retries; attempt++ {
+			log.Printf("WARNING: Retrying %s in a fresh container (attempt %d of %d)", target, attempt, b.cfg.Retries)
+
+			conf := *config
+			conf.Targets = []string{target}
+			if err = b.compileIn(&conf); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", target, err))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%d targets failed after %d retries (%s)", len(failures), b.cfg.Retries, strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// startedSince reports whether the build script started compiling a target since
+// the given time, according to its "Compiling for <target>..." markers.
+func (b *builder) startedSince(target string, since time.Time) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	run := b.runs[b.runKey(target)]
+	return run != nil && !run.start.Before(since)
+}
@@ -0,0 +1,74 @@
+package xgo
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	goruntime "runtime"
+	"strings"
+)
+
+// containerRuntimes are the supported container engines, in order of preference
+// when detecting the one to use.
+var containerRuntimes = []string{"docker", "podman"}
+
+// Runtime resolves the container engine to run the builds with. Unless explicitly
+// selected, docker is preferred if installed, falling back to podman.
+func Runtime(name string) (string, error) {
+	if name == "" {
+		for _, runtime := range containerRuntimes {
+			if _, err := exec.LookPath(runtime); err == nil {
+				return runtime, nil
+			}
+		}
+		return containerRuntimes[0], nil
+	}
+	for _, runtime := range containerRuntimes {
+		if name == runtime {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported container runtime %q, must be one of %s", name, strings.Join(containerRuntimes, ", "))
+}
+
+// command creates a command invoking the container engine CLI.
+func (b *builder) command(args ...string) *exec.Cmd {
+	return exec.CommandContext(b.ctx, b.runtime, args...)
+}
+
+// runtimeArgs returns the engine specific arguments of running a build container.
+// Rootless podman maps the invoking user to root within the container, so the
+// build outputs end up owned by the user instead of a subordinate id.
+func (b *builder) runtimeArgs() []string {
+	if b.runtime == "podman" && os.Geteuid() != 0 {
+		return []string{"--userns=keep-id:uid=0,gid=0"}
+	}
+	return nil
+}
+
+// ownerEnv returns the environment telling the build script which host user to
+// hand the files it creates in the mounted folders (module cache, outputs) back
+// to. Rootful docker builds run as root, leaving root owned module cache entries
+// in the host GOPATH that the user can't delete (e.g. with go clean -modcache).
+// Rootless engines already map root within the container to the invoking user.
+func (b *builder) ownerEnv() []string {
+	if b.owner != nil {
+		return b.owner
+	}
+	b.owner = []string{}
+	if goruntime.GOOS != "linux" || b.runtime != "docker" || b.remote || os.Geteuid() <= 0 {
+		return b.owner
+	}
+	out, err := b.command("info", "--format", "{{.SecurityOptions}}").Output()
+	if err != nil || strings.Contains(string(out), "rootless") {
+		return b.owner
+	}
+	b.owner = []string{fmt.Sprintf("HOST_UID=%d", os.Geteuid()), fmt.Sprintf("HOST_GID=%d", os.Getegid())}
+	return b.owner
+}
+
+// logCommand logs a container engine invocation about to be executed.
+func (b *builder) logCommand(args []string) {
+	log.Printf("INFO: %s %s", strings.Title(b.runtime), strings.Join(redact(args), " "))
+}
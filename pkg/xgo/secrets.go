@@ -0,0 +1,125 @@
+package xgo
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// secretName matches the secret names, exported as environment variables.
+var secretName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// validateSecrets checks that the secrets can be exported under their names.
+func validateSecrets(secrets map[string]string) error {
+	for name := range secrets {
+		if !secretName.MatchString(name) {
+			return fmt.Errorf("invalid secret name %q, must be a valid environment variable name", name)
+		}
+	}
+	return nil
+}
+
+// writeSecrets writes the secrets into a private folder mounted into the build
+// containers (at /run/secrets), keeping them out of the container engine command
+// lines and inspectable container configs. The returned function removes them.
+func (b *builder) writeSecrets() (func(), error) {
+	dir, err := os.MkdirTemp(b.work, "secrets-")
+	if err != nil {
+		return nil, err
+	}
+	cleanup := func() {
+		os.RemoveAll(dir)
+		b.secrets = ""
+	}
+	for name, value := range b.cfg.Secrets {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(value), 0600); err != nil {
+			cleanup()
+			return nil, fmt.Errorf("failed to write secret %s: %v", name, err)
+		}
+	}
+	b.secrets = dir
+	return cleanup, nil
+}
+
+// secretVars returns the secrets as environment variables, for the builds run
+// with the local Go toolchain.
+func (b *builder) secretVars() []string {
+	var env []string
+	for name, value := range b.cfg.Secrets {
+		env = append(env, name+"="+value)
+	}
+	sort.Strings(env)
+	return env
+}
+
+// secretNames returns the sorted names of the secrets.
+func (b *builder) secretNames() []string {
+	var names []string
+	for name := range b.cfg.Secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// redactWriter is an io.Writer masking the secret values in the output of the
+// builds. Only complete lines are forwarded, so that values split across writes
+// are masked too.
+type redactWriter struct {
+	out    io.Writer
+	values [][]byte
+	lock   sync.Mutex
+	buf    []byte // Trailing incomplete line of the previous write
+}
+
+// newRedactWriter wraps an output to mask the values of the given secrets.
+func newRedactWriter(out io.Writer, secrets map[string]string) *redactWriter {
+	w := &redactWriter{out: out}
+	for _, value := range secrets {
+		if value != "" {
+			w.values = append(w.values, []byte(value))
+		}
+	}
+	// Mask the longest values first, in case they contain shorter ones
+	sort.Slice(w.values, func(i, j int) bool { return len(w.values[i]) > len(w.values[j]) })
+	return w
+}
+
+// Write implements io.Writer, forwarding all the completed lines masked.
+func (w *redactWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.buf = append(w.buf, p...)
+	idx := bytes.LastIndexByte(w.buf, '\n')
+	if idx < 0 {
+		return len(p), nil
+	}
+	lines := w.mask(w.buf[:idx+1])
+	w.buf = append(w.buf[:0], w.buf[idx+1:]...)
+	if _, err := w.out.Write(lines); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush forwards any trailing incomplete line.
+func (w *redactWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.Write([]byte{'\n'})
+	}
+}
+
+// mask replaces the secret values within a chunk of output.
+func (w *redactWriter) mask(p []byte) []byte {
+	masked := append([]byte{}, p...)
+	for _, value := range w.values {
+		masked = bytes.ReplaceAll(masked, value, []byte("***"))
+	}
+	return masked
+}
@@ -0,0 +1,38 @@
+package xgo
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	goruntime "runtime"
+	"strings"
+)
+
+// sshAgentArgs assembles the container arguments forwarding the SSH agent of the
+// host into a build container, along with its known hosts, so that modules can
+// be fetched over SSH from private repositories. The build script rewrites the
+// HTTPS URLs of the private module hosts (GOPRIVATE) to SSH ones.
+func (b *builder) sshAgentArgs() ([]string, error) {
+	if b.remote {
+		return nil, errors.New("SSH agent forwarding is not supported on remote container engines")
+	}
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if goruntime.GOOS == "darwin" && b.runtime == "docker" {
+		// Docker Desktop proxies the agent of the host through a magic socket
+		socket = "/run/host-services/ssh-auth.sock"
+	}
+	if socket == "" {
+		return nil, errors.New("no SSH agent to forward, SSH_AUTH_SOCK is not set")
+	}
+	args := []string{"-v", volume(socket, "/ssh-agent.sock"), "-e", "SSH_AUTH_SOCK=/ssh-agent.sock"}
+
+	// Verify the hosts against the known ones of the user, trusting new ones otherwise
+	ssh := "ssh -o StrictHostKeyChecking=accept-new"
+	if home, err := os.UserHomeDir(); err == nil && fileExists(filepath.Join(home, ".ssh", "known_hosts")) {
+		args = append(args, "-v", volume(filepath.Join(home, ".ssh", "known_hosts"), "/ssh-known-hosts", "ro"))
+		ssh = "ssh -o UserKnownHostsFile=/ssh-known-hosts -o StrictHostKeyChecking=yes"
+	}
+	args = append(args, "-e", "GIT_SSH_COMMAND="+ssh)
+
+	return append(args, "-e", "SSH_GIT_HOSTS="+strings.Join(privateHosts(b.cfg.GoPrivate), " ")), nil
+}
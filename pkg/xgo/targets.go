@@ -0,0 +1,274 @@
+package xgo
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Targets are the concrete targets the build script can cross compile to, used
+// to expand wildcard target patterns into individual builds.
+var Targets = []string{
+	"linux/amd64", "linux/386", "linux/arm-5", "linux/arm-6", "linux/arm-7", "linux/arm64",
+	"linux/mips64", "linux/mips64le", "linux/mips", "linux/mipsle",
+	"linux/ppc64le", "linux/riscv64", "linux/s390x",
+	"windows/amd64", "windows/386",
+	"darwin/amd64", "darwin/arm64",
+}
+
+// MuslTargets are the Linux targets the build script can also build against musl
+// instead of glibc, requested with a -musl suffix and linked fully statically.
+var MuslTargets = []string{
+	"linux/amd64-musl", "linux/386-musl", "linux/arm-5-musl", "linux/arm-6-musl", "linux/arm-7-musl",
+	"linux/arm64-musl", "linux/ppc64le-musl", "linux/riscv64-musl", "linux/s390x-musl",
+}
+
+// splitLibc splits the C library suffix off a target (e.g. musl of
+// linux/amd64-v3-musl), returning the target built against the default one.
+func splitLibc(target string) (string, string) {
+	if strings.Contains(target, "/") && strings.HasSuffix(target, "-musl") {
+		return strings.TrimSuffix(target, "-musl"), "musl"
+	}
+	return target, ""
+}
+
+// muslTarget returns the musl flavor of a Linux target (e.g. linux/amd64-v3-musl
+// of linux/amd64-v3), empty if the build script has no musl toolchain for it.
+func muslTarget(target string) string {
+	goos, goarch, variant := targetPlatform(target)
+	if goarch == "arm" {
+		if variant == "" {
+			variant = "5"
+		}
+		goarch += "-" + variant
+	}
+	for _, known := range MuslTargets {
+		if known == goos+"/"+goarch+"-musl" {
+			return target + "-musl"
+		}
+	}
+	return ""
+}
+
+// withLibc switches the Linux targets to the given C library wherever the build
+// script has a toolchain of it, glibc keeping them as they are.
+func withLibc(targets []string, libc string) []string {
+	if libc != "musl" {
+		return targets
+	}
+	switched := make([]string, len(targets))
+	for i, target := range targets {
+		if _, current := splitLibc(target); current == "" {
+			if musl := muslTarget(target); musl != "" {
+				target = musl
+			}
+		}
+		switched[i] = target
+	}
+	return switched
+}
+
+// archLevel is the environment variable selecting the micro-architecture level
+// of an architecture, requested as the variant of its targets (e.g. amd64-v3).
+type archLevel struct {
+	env    string         // Go environment variable of the level
+	levels *regexp.Regexp // Levels the variable accepts
+	since  string         // Go release introducing the variable
+}
+
+// archLevels are the micro-architecture levels of the architectures taking one,
+// the arm versions being handled as the builtin arm-5/arm-6/arm-7 targets.
+var archLevels = map[string]archLevel{
+	"amd64":    {"GOAMD64", regexp.MustCompile(`^v[1-4]$`), "1.18"},
+	"arm64":    {"GOARM64", regexp.MustCompile(`^v(8\.[0-9]|9\.[0-5])$`), "1.23"},
+	"386":      {"GO386", regexp.MustCompile(`^(sse2|softfloat)$`), "1.16"},
+	"mips":     {"GOMIPS", regexp.MustCompile(`^(hardfloat|softfloat)$`), "1.10"},
+	"mipsle":   {"GOMIPS", regexp.MustCompile(`^(hardfloat|softfloat)$`), "1.10"},
+	"mips64":   {"GOMIPS64", regexp.MustCompile(`^(hardfloat|softfloat)$`), "1.11"},
+	"mips64le": {"GOMIPS64", regexp.MustCompile(`^(hardfloat|softfloat)$`), "1.11"},
+}
+
+// levelEnv returns the environment variable selecting the micro-architecture
+// level of a target if it requests one (e.g. GOAMD64=v3 for linux/amd64-v3).
+func levelEnv(target string) (string, bool) {
+	target, _ = splitLibc(target)
+	_, goarch, variant := targetPlatform(target)
+	level, ok := archLevels[goarch]
+	if !ok || variant == "" {
+		return "", false
+	}
+	return level.env + "=" + variant, true
+}
+
+// checkLevel validates the variant of a target against the levels of its
+// architecture and the Go release of the build (0 if unknown).
+func checkLevel(target string, minor int) error {
+	target, _ = splitLibc(target)
+	_, goarch, variant := targetPlatform(target)
+	if variant == "" || goarch == "arm" {
+		return nil
+	}
+	level, ok := archLevels[goarch]
+	if !ok {
+		return fmt.Errorf("unknown variant %s, %s has no micro-architecture levels", variant, goarch)
+	}
+	if !level.levels.MatchString(variant) {
+		return fmt.Errorf("unknown %s level %s", level.env, variant)
+	}
+	if since, _ := goMinor(level.since); minor > 0 && minor < since {
+		return fmt.Errorf("%s requires Go %s or later", level.env, level.since)
+	}
+	return nil
+}
+
+// ExpandTargets converts a list of target patterns (e.g. */*, linux/*) into the
+// individual targets they cover. Platform versions (e.g. windows-10.0/*) are kept
+// and targets unknown to the build script (e.g. custom profiles) passed through.
+// Patterns prefixed with ! exclude the targets they match (e.g. */*,!*/386), all
+// targets being excluded from if no other pattern is given.
+func ExpandTargets(patterns []string) []string {
+	return expandTargets(patterns, Targets)
+}
+
+// expandTargets converts a list of target patterns into the individual targets
+// they cover out of the given concrete targets.
+func expandTargets(patterns []string, platforms []string) []string {
+	var (
+		targets []string
+		seen    = make(map[string]bool)
+	)
+	add := func(target string) {
+		if !seen[target] {
+			seen[target] = true
+			targets = append(targets, target)
+		}
+	}
+	var included, excluded []string
+	for _, pattern := range patterns {
+		if pattern = strings.TrimSpace(pattern); strings.HasPrefix(pattern, "!") {
+			excluded = append(excluded, strings.TrimPrefix(pattern, "!"))
+		} else if pattern != "" {
+			included = append(included, pattern)
+		}
+	}
+	if len(included) == 0 && len(excluded) > 0 {
+		included = []string{"*/*"}
+	}
+	for _, pattern := range included {
+		parts := strings.SplitN(pattern, "/", 2)
+		if len(parts) != 2 {
+			add(pattern)
+			continue
+		}
+		goos, goarch := parts[0], parts[1]
+
+		matched := false
+		for _, target := range platforms {
+			known := strings.SplitN(target, "/", 2)
+			if goos != "*" && goos != "." && strings.SplitN(goos, "-", 2)[0] != known[0] {
+				continue
+			}
+			// The mobile targets are only built when their platform is named
+			if (goos == "*" || goos == ".") && sdkPlatforms[known[0]] {
+				continue
+			}
+			if goarch != "*" && goarch != "." && goarch != known[1] && !(goarch == "arm" && known[1] == "arm-5") {
+				continue
+			}
+			if goos == "*" || goos == "." {
+				add(target)
+			} else {
+				add(goos + "/" + known[1])
+			}
+			matched = true
+		}
+		if !matched {
+			add(pattern)
+		}
+	}
+	if len(excluded) == 0 {
+		return targets
+	}
+	kept := targets[:0]
+	for _, target := range targets {
+		if !matchesAny(excluded, target) {
+			kept = append(kept, target)
+		}
+	}
+	return kept
+}
+
+// expandable reports whether any of the target patterns needs expanding, as it
+// covers several targets or excludes some.
+func expandable(patterns []string) bool {
+	for _, pattern := range patterns {
+		parts := strings.SplitN(strings.TrimSpace(pattern), "/", 2)
+		if strings.HasPrefix(parts[0], "!") || len(parts) == 2 && (parts[0] == "*" || parts[0] == "." || parts[1] == "*" || parts[1] == ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// TargetEnv returns the Go platform environment variables of the requested
+// targets if exactly one concrete os/arch(-variant) target is given.
+func TargetEnv(targets []string) []string {
+	if len(targets) != 1 || strings.Contains(targets[0], "*") {
+		return nil
+	}
+	target, _ := splitLibc(targets[0])
+	parts := strings.Split(target, "/")
+	if len(parts) != 2 {
+		return nil
+	}
+	goos, goarch, variant := parts[0], parts[1], ""
+	if idx := strings.Index(goos, "-"); idx >= 0 {
+		goos = goos[:idx] // Strip platform versions, e.g. windows-10.0
+	}
+	if idx := strings.Index(goarch, "-"); idx >= 0 {
+		goarch, variant = goarch[:idx], goarch[idx+1:]
+	}
+	env := []string{"GOOS=" + goos, "GOARCH=" + goarch}
+	if goarch == "arm" && variant != "" {
+		env = append(env, "GOARM="+variant)
+	}
+	if level, ok := levelEnv(targets[0]); ok {
+		env = append(env, level)
+	}
+	return env
+}
+
+// TargetValues holds a global value, keyed by the empty string, and any number
+// of per-target overrides keyed by os/arch.
+type TargetValues map[string]string
+
+// env converts the values into environment variables for the build script, the
+// global value being stored in name and the overrides in name_<OS>_<ARCH>.
+func (v TargetValues) env(name string) []string {
+	var env []string
+	for target, value := range v {
+		if target == "" {
+			env = append(env, name+"="+value)
+		} else {
+			env = append(env, name+"_"+envSuffix(target)+"="+value)
+		}
+	}
+	sort.Strings(env)
+	return env
+}
+
+// envSuffix converts a target into a form usable within environment variable
+// names, e.g. linux/arm-7 into LINUX_ARM_7.
+func envSuffix(target string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, target)
+}
@@ -0,0 +1,101 @@
+package xgo
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FeatureVariant is a named set of build tags and linker flags to build every
+// target with, e.g. an oss and an enterprise edition of the same project.
+type FeatureVariant struct {
+	Name    string `yaml:"name" toml:"name"`       // Name of the variant, inserted into the output names
+	Tags    string `yaml:"tags" toml:"tags"`       // Build tags, added to the global ones
+	LdFlags string `yaml:"ldflags" toml:"ldflags"` // Linker flags, appended to the global ones
+}
+
+// validateVariants checks that the feature variants are uniquely named with
+// names usable within file names.
+func validateVariants(variants []FeatureVariant) error {
+	seen := make(map[string]bool)
+	for _, variant := range variants {
+		if variant.Name == "" || strings.ContainsAny(variant.Name, "/\\ \t\n") {
+			return fmt.Errorf("invalid feature variant name %q", variant.Name)
+		}
+		if seen[variant.Name] {
+			return fmt.Errorf("duplicate feature variant %s", variant.Name)
+		}
+		seen[variant.Name] = true
+	}
+	return nil
+}
+
+// flags returns the build flags of the variant, its tags and linker flags added
+// to the global ones.
+func (v *FeatureVariant) flags(flags BuildFlags) BuildFlags {
+	if v.Tags != "" {
+		tags := strings.FieldsFunc(flags.Tags+","+v.Tags, func(r rune) bool { return r == ',' || r == ' ' })
+		flags.Tags = strings.Join(tags, ",")
+	}
+	if v.LdFlags != "" {
+		flags.LdFlags = strings.TrimSpace(flags.LdFlags + " " + v.LdFlags)
+	}
+	return flags
+}
+
+// compileVariants cross compiles every target once per feature variant, naming
+// the outputs of each variant after it (e.g. geth-enterprise-linux-amd64) before
+// the next one overwrites them.
+func (b *builder) compileVariants(natives []string, contained bool) (string, []Artifact, error) {
+	flags := b.cfg.Flags
+	defer func() { b.cfg.Flags, b.feature = flags, "" }()
+
+	var (
+		outDir    = b.cfg.Project.BinPath
+		artifacts []Artifact
+	)
+	for _, variant := range b.cfg.Variants {
+		log.Printf("INFO: Building feature variant %s...", variant.Name)
+		b.cfg.Flags, b.feature = variant.flags(flags), variant.Name
+
+		start := time.Now()
+		dir, err := b.compileAll(natives, contained)
+		outDir = dir
+
+		built := collectArtifacts(dir, start)
+		for i := range built {
+			built[i].Feature = variant.Name
+			if rerr := renameFeature(&built[i]); rerr != nil && err == nil {
+				err = rerr
+			}
+		}
+		artifacts = append(artifacts, built...)
+		if err != nil {
+			return outDir, artifacts, fmt.Errorf("feature variant %s: %v", variant.Name, err)
+		}
+	}
+	return outDir, artifacts, nil
+}
+
+// renameFeature inserts the feature variant of an output into its name, right
+// before its target (e.g. geth-linux-amd64 into geth-enterprise-linux-amd64).
+func renameFeature(artifact *Artifact) error {
+	if artifact.Target == "" {
+		return nil
+	}
+	name := filepath.Base(artifact.Path)
+	goos := strings.SplitN(artifact.Target, "/", 2)[0]
+	idx := strings.LastIndex(name, "-"+goos+"-")
+	if idx < 0 {
+		return nil
+	}
+	path := filepath.Join(filepath.Dir(artifact.Path), name[:idx]+"-"+artifact.Feature+name[idx:])
+	if err := os.Rename(artifact.Path, path); err != nil {
+		return fmt.Errorf("failed to rename %s: %v", artifact.Path, err)
+	}
+	artifact.Path = path
+	return nil
+}
@@ -0,0 +1,172 @@
+package xgo
+
+import (
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Operating systems the build script produces binaries for
+var targetOSes = []string{
+	"linux", "windows", "darwin",
+	"android", "freebsd", "netbsd", "openbsd", "dragonfly", "illumos", "solaris", "aix", "plan9", "js", "wasip1", "ios",
+}
+
+// binaryExts are the output file extensions of the various build modes.
+var binaryExts = []string{".exe", ".dll", ".so", ".dylib"}
+
+// elfMachines maps the Go architectures to their ELF machine and byte order.
+var elfMachines = map[string]struct {
+	machine elf.Machine
+	class   elf.Class
+	order   binary.ByteOrder
+}{
+	"386":      {elf.EM_386, elf.ELFCLASS32, binary.LittleEndian},
+	"amd64":    {elf.EM_X86_64, elf.ELFCLASS64, binary.LittleEndian},
+	"arm":      {elf.EM_ARM, elf.ELFCLASS32, binary.LittleEndian},
+	"arm64":    {elf.EM_AARCH64, elf.ELFCLASS64, binary.LittleEndian},
+	"mips":     {elf.EM_MIPS, elf.ELFCLASS32, binary.BigEndian},
+	"mipsle":   {elf.EM_MIPS, elf.ELFCLASS32, binary.LittleEndian},
+	"mips64":   {elf.EM_MIPS, elf.ELFCLASS64, binary.BigEndian},
+	"mips64le": {elf.EM_MIPS, elf.ELFCLASS64, binary.LittleEndian},
+	"ppc64le":  {elf.EM_PPC64, elf.ELFCLASS64, binary.LittleEndian},
+	"riscv64":  {elf.EM_RISCV, elf.ELFCLASS64, binary.LittleEndian},
+	"s390x":    {elf.EM_S390, elf.ELFCLASS64, binary.BigEndian},
+}
+
+// machoCpus maps the Go architectures to their Mach-O CPU type.
+var machoCpus = map[string]macho.Cpu{
+	"386":   macho.Cpu386,
+	"amd64": macho.CpuAmd64,
+	"arm64": macho.CpuArm64,
+}
+
+// peMachines maps the Go architectures to their PE machine type.
+var peMachines = map[string]uint16{
+	"386":   pe.IMAGE_FILE_MACHINE_I386,
+	"amd64": pe.IMAGE_FILE_MACHINE_AMD64,
+	"arm":   pe.IMAGE_FILE_MACHINE_ARMNT,
+	"arm64": pe.IMAGE_FILE_MACHINE_ARM64,
+}
+
+// verifyOutputs checks that every binary produced since the given time in the
+// output folder matches the os/arch declared by its name, and optionally the
+// expected linkage (static or dynamic) of the ELF binaries.
+func verifyOutputs(dir string, since time.Time, linkage string) error {
+	var failures []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || info.ModTime().Before(since) {
+			return err
+		}
+		goos, goarch, ok := parseOutputName(info.Name())
+		if !ok {
+			return nil
+		}
+		if err := verifyBinary(path, goos, goarch, linkage); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", path, err))
+		} else {
+			log.Printf("INFO: Verified %s as %s/%s", path, goos, goarch)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%d binaries mismatch their target:\n  %s", len(failures), strings.Join(failures, "\n  "))
+	}
+	return nil
+}
+
+// parseOutputName extracts the Go platform from the name of an output binary,
+// e.g. geth-linux-arm-7, geth-linux-amd64-race or geth-windows-386.exe. The C
+// headers and static libraries of the C build modes are no binaries.
+func parseOutputName(name string) (goos string, goarch string, ok bool) {
+	ext := filepath.Ext(name)
+	if ext == ".h" || ext == ".a" || ext == ".lib" {
+		return "", "", false
+	}
+	for _, known := range binaryExts {
+		if ext == known {
+			name = strings.TrimSuffix(name, ext)
+		}
+	}
+	name = strings.TrimSuffix(name, "-race")
+
+	for _, target := range targetOSes {
+		idx := strings.LastIndex(name, "-"+target+"-")
+		if idx < 0 {
+			continue
+		}
+		arch := name[idx+len(target)+2:]
+		if i := strings.Index(arch, "-"); i >= 0 {
+			arch = arch[:i]
+		}
+		if _, ok := elfMachines[arch]; ok {
+			return target, arch, true
+		}
+	}
+	return "", "", false
+}
+
+// verifyBinary checks the executable format and machine type of a single binary
+// against the expected Go platform.
+func verifyBinary(path string, goos string, goarch string, linkage string) error {
+	switch goos {
+	case "aix", "plan9", "js", "wasip1":
+		return nil // Neither ELF, PE nor Mach-O binaries, left unchecked
+	case "darwin", "ios":
+		f, err := macho.Open(path)
+		if err != nil {
+			if ff, ferr := macho.OpenFat(path); ferr == nil {
+				ff.Close()
+				return nil // Universal binaries contain multiple architectures
+			}
+			return fmt.Errorf("not a Mach-O binary: %v", err)
+		}
+		defer f.Close()
+		if cpu, ok := machoCpus[goarch]; !ok || f.Cpu != cpu {
+			return fmt.Errorf("mach-o cpu %v does not match %s", f.Cpu, goarch)
+		}
+	case "windows":
+		f, err := pe.Open(path)
+		if err != nil {
+			return fmt.Errorf("not a PE binary: %v", err)
+		}
+		defer f.Close()
+		if machine, ok := peMachines[goarch]; !ok || f.Machine != machine {
+			return fmt.Errorf("pe machine %#x does not match %s", f.Machine, goarch)
+		}
+	default:
+		f, err := elf.Open(path)
+		if err != nil {
+			return fmt.Errorf("not an ELF binary: %v", err)
+		}
+		defer f.Close()
+		want := elfMachines[goarch]
+		if f.Machine != want.machine || f.Class != want.class || f.ByteOrder != want.order {
+			return fmt.Errorf("elf %v %v %v does not match %s", f.Machine, f.Class, f.ByteOrder, goarch)
+		}
+		dynamic := false
+		for _, prog := range f.Progs {
+			if prog.Type == elf.PT_INTERP {
+				dynamic = true
+			}
+		}
+		switch {
+		case goos != "linux": // Linkage expectations only apply to the Linux binaries
+		case linkage == "static" && dynamic:
+			return fmt.Errorf("dynamically linked, expected static linkage")
+		case linkage == "dynamic" && !dynamic && f.Type == elf.ET_EXEC:
+			return fmt.Errorf("statically linked, expected dynamic linkage")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package xgo
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// signatureExts are the extensions of the detached signatures of the artifacts,
+// verified with gpg.
+var signatureExts = []string{".asc", ".sig"}
+
+// sbomExts are the extensions of the SBOMs of the binaries (e.g. geth-linux-amd64.spdx.json).
+var sbomExts = []string{".sbom.json", ".spdx.json", ".cdx.json", ".spdx", ".sbom"}
+
+// VerifyOptions are the expectations on a verified artifact set.
+type VerifyOptions struct {
+	Linkage    string // Expected linkage of the Linux binaries (static, dynamic), unchecked if empty
+	SBOM       bool   // Require an SBOM next to every binary
+	Signatures bool   // Require a detached signature of every artifact
+}
+
+// VerifyArtifacts re-checks a previously produced artifact set, given as the bin
+// path or the JSON build report of the build: the recorded sizes and digests of
+// the report, the checksum files, the detached signatures (with gpg), the SBOMs
+// of the binaries and the target headers of the binaries.
+func VerifyArtifacts(path string, opts VerifyOptions) error {
+	if opts.Linkage != "" && opts.Linkage != "static" && opts.Linkage != "dynamic" {
+		return fmt.Errorf("invalid expected linkage %q, must be static or dynamic", opts.Linkage)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	var (
+		artifacts []string
+		failures  []string
+	)
+	fail := func(path string, format string, args ...interface{}) {
+		failures = append(failures, path+": "+fmt.Sprintf(format, args...))
+	}
+	if info.IsDir() {
+		err = filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				artifacts = append(artifacts, path)
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	} else {
+		// Check the artifacts against the sizes and digests recorded in the report
+		outputs, err := reportOutputs(path)
+		if err != nil {
+			return fmt.Errorf("failed to load build report %s: %v", path, err)
+		}
+		for _, output := range outputs {
+			info, err := os.Stat(output.Path)
+			if err != nil {
+				fail(output.Path, "%v", err)
+				continue
+			}
+			artifacts = append(artifacts, output.Path)
+			if sum, err := fileChecksum(output.Path, sha256.New); err != nil || info.Size() != output.Size || sum != output.SHA256 {
+				fail(output.Path, "does not match the size and digest recorded in the build report")
+			} else {
+				log.Printf("INFO: Verified %s against the build report", output.Path)
+			}
+		}
+	}
+	sort.Strings(artifacts)
+
+	// Check the checksum files, the signatures, the SBOMs and the binaries
+	for _, artifact := range artifacts {
+		name := filepath.Base(artifact)
+		for algo, newHash := range checksumHashes {
+			if name == checksumFile(algo) {
+				verified, errs := verifyChecksumFile(artifact, newHash)
+				for _, err := range errs {
+					fail(artifact, "%v", err)
+				}
+				log.Printf("INFO: Verified %d %s checksums of %s", verified, algo, artifact)
+			}
+		}
+		if hasExt(name, signatureExts) {
+			continue
+		}
+		if sig := siblingWithExt(artifact, signatureExts); sig != "" {
+			if err := verifySignature(artifact, sig); err != nil {
+				fail(artifact, "%v", err)
+			} else {
+				log.Printf("INFO: Verified signature %s", sig)
+			}
+		} else if opts.Signatures {
+			fail(artifact, "no detached signature (%s)", strings.Join(signatureExts, ", "))
+		}
+		goos, goarch, ok := parseOutputName(name)
+		if !ok {
+			continue
+		}
+		if err := verifyBinary(artifact, goos, goarch, opts.Linkage); err != nil {
+			fail(artifact, "%v", err)
+		} else {
+			log.Printf("INFO: Verified %s as %s/%s", artifact, goos, goarch)
+		}
+		if sbom := siblingWithExt(artifact, sbomExts); sbom != "" {
+			log.Printf("INFO: Found SBOM %s", sbom)
+		} else if opts.SBOM {
+			fail(artifact, "no SBOM (%s)", strings.Join(sbomExts, ", "))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%d verification failures across %d artifacts:\n  %s", len(failures), len(artifacts), strings.Join(failures, "\n  "))
+	}
+	return nil
+}
+
+// reportOutputs lists the artifacts recorded in a JSON build report.
+func reportOutputs(path string) ([]OutputReport, error) {
+	blob, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var report Report
+	if err := json.Unmarshal(blob, &report); err != nil {
+		return nil, err
+	}
+	outputs := append([]OutputReport{}, report.Files...)
+	for _, target := range report.Targets {
+		outputs = append(outputs, target.Outputs...)
+	}
+	return outputs, nil
+}
+
+// verifyChecksumFile checks the files listed in a checksum file (in the format
+// of the sha*sum tools) against their digests, returning the number verified.
+func verifyChecksumFile(path string, newHash func() hash.Hash) (int, []error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, []error{err}
+	}
+	defer f.Close()
+
+	var (
+		verified int
+		errs     []error
+	)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), "  ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		file := filepath.Join(filepath.Dir(path), filepath.FromSlash(fields[1]))
+		if sum, err := fileChecksum(file, newHash); err != nil {
+			errs = append(errs, err)
+		} else if sum != fields[0] {
+			errs = append(errs, fmt.Errorf("checksum mismatch of %s", fields[1]))
+		} else {
+			verified++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return verified, errs
+}
+
+// verifySignature checks a detached signature of an artifact with gpg, against
+// the keys of the user's keyring.
+func verifySignature(path string, sig string) error {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		return fmt.Errorf("gpg not found, required to verify %s", sig)
+	}
+	if out, err := exec.Command("gpg", "--batch", "--verify", sig, path).CombinedOutput(); err != nil {
+		return fmt.Errorf("invalid signature %s: %v\n%s", sig, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// siblingWithExt returns the first existing file named after a path with one of
+// the extensions appended, empty if none exists.
+func siblingWithExt(path string, exts []string) string {
+	for _, ext := range exts {
+		if fileExists(path + ext) {
+			return path + ext
+		}
+	}
+	return ""
+}
+
+// hasExt checks whether a file name ends with any of the extensions.
+func hasExt(name string, exts []string) bool {
+	for _, ext := range exts {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package xgo
+
+import (
+	"log"
+	"path/filepath"
+)
+
+// warm downloads all the modules required by the project in a networked build
+// container, verifying them against the checksum database. The module cache,
+// including the verified checksum database tiles, is shared with the builds via
+// the GOPATH mount, so they can run without network access (--network=none).
+func (b *builder) warm() error {
+	config := b.cfg.Project
+	if !fileExists(filepath.Join(config.ProjectPath, "go.mod")) {
+		log.Println("INFO: Not a Go module, skipping module cache warm up")
+		return nil
+	}
+	log.Printf("INFO: Warming up module caches of %s...", config.ProjectPath)
+	args, err := b.warmArgs(&config)
+	if err != nil {
+		return err
+	}
+	b.logCommand(args)
+	return b.runContainer(args, &config, "", b.stdout, b.stderr)
+}
+
+// warmArgs assembles the container engine run arguments of the module download
+// container, which needs network access even if the builds don't have any.
+func (b *builder) warmArgs(config *ConfigFlags) ([]string, error) {
+	network := b.cfg.Network
+	if network == "none" {
+		b.cfg.Network = ""
+	}
+	defer func() { b.cfg.Network = network }()
+
+	args, err := b.containerArgs(config)
+	if err != nil {
+		return nil, err
+	}
+	download := "go mod download -x"
+	if injectsNetrc(args) {
+		// Write out the injected credentials, as the build script does
+		download = `printf '%s\n' "$NETRC_DATA" > ~/.netrc && chmod 600 ~/.netrc && unset NETRC_DATA && ` + download
+	}
+	if forwardsGitConfig(args) {
+		// Set up the forwarded git configuration, as the build script does
+		download = gitConfigScript + "\n" + download
+	}
+	if len(b.ownerEnv()) > 0 {
+		// Hand the downloaded modules back to the host user, as the build script does
+		download += `; status=$?; find /go/pkg ! -user "$HOST_UID" -exec chown -h "$HOST_UID:$HOST_GID" {} + 2>/dev/null; exit $status`
+	}
+	if download != "go mod download -x" {
+		return append(args, "--entrypoint", "sh", b.cfg.Image, "-c", download), nil
+	}
+	return append(args, "--entrypoint", "go", b.cfg.Image, "mod", "download", "-x"), nil
+}
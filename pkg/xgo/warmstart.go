@@ -0,0 +1,115 @@
+package xgo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// warmStartRepo is the local repository of the warm start images, tagged with the
+// key of the dependency settings they were built with.
+const warmStartRepo = "xgo-warm"
+
+// warmStartKey hashes the settings the CGO dependencies of a build container are
+// built with: the build image, the dependencies and their configure arguments,
+// the targets and their toolchain settings.
+func (b *builder) warmStartKey(config *ConfigFlags) string {
+	image := b.cfg.Image
+	if b.digest != "" {
+		image = b.digest
+	}
+	targets := ExpandTargets(config.Targets)
+	sort.Strings(targets)
+
+	blob, _ := json.Marshal(struct {
+		Image        string
+		Dependencies string
+		Arguments    string
+		Targets      []string
+		Libc         string
+		ArmABI       string
+		CgoCFlags    TargetValues
+		CgoLdFlags   TargetValues
+		Overrides    map[string]*TargetOverride
+		Profiles     map[string]*TargetProfile
+	}{image, config.Dependencies, config.Arguments, targets, b.cfg.Flags.Libc, b.cfg.Flags.ArmABI,
+		b.cfg.Flags.CgoCFlags, b.cfg.Flags.CgoLdFlags, b.cfg.Flags.Overrides, config.Profiles})
+	sum := sha256.Sum256(blob)
+	return hex.EncodeToString(sum[:8])
+}
+
+// warmStart resolves how to run a build container with warm start images: in
+// the image committed by a previous build with the same dependency settings if
+// any, its build specs then skipping the dependencies already built into it, or
+// in the build image, the container being committed into the returned warm start
+// image once built. The build specs and image are returned as is, with nothing
+// to commit, if warm starts are disabled or there are no dependencies to build.
+func (b *builder) warmStart(config *ConfigFlags) (build *ConfigFlags, image string, commit string) {
+	if !b.cfg.WarmStart || config.Dependencies == "" {
+		return config, b.cfg.Image, ""
+	}
+	for _, spec := range strings.Fields(config.Dependencies) {
+		if dep, err := parseDependency(spec); err != nil || dep.kind == depLocal {
+			return config, b.cfg.Image, "" // Local folders may have changed since
+		}
+	}
+	tag := warmStartRepo + ":" + b.warmStartKey(config)
+	if b.command("image", "inspect", tag).Run() != nil {
+		log.Printf("INFO: No warm start image %s yet, building the dependencies", tag)
+		b.stats.WarmMisses++
+		return config, b.cfg.Image, tag
+	}
+	log.Printf("INFO: Using warm start image %s, dependencies already built", tag)
+	b.stats.WarmHits++
+
+	prebuilt := *config
+	prebuilt.Dependencies, prebuilt.Arguments = "", ""
+	return &prebuilt, tag, ""
+}
+
+// commitWarmStart commits a successful build container into a warm start image.
+// The environment and working folder of the build image are restored, for the
+// settings of this build not to leak into the later ones. Failures only warn, as
+// the next build simply rebuilds the dependencies.
+func (b *builder) commitWarmStart(container string, image string, args []string) {
+	out, err := b.command("image", "inspect", "--format", "{{json .Config}}", b.cfg.Image).Output()
+	var base struct {
+		Env        []string
+		WorkingDir string
+	}
+	if err == nil {
+		err = json.Unmarshal(out, &base)
+	}
+	if err != nil {
+		log.Printf("WARNING: Failed to inspect %s, not committing warm start image: %v", b.cfg.Image, err)
+		return
+	}
+	env := make(map[string]string)
+	for _, entry := range base.Env {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) == 2 {
+			env[parts[0]] = parts[1]
+		}
+	}
+	commit := []string{"commit"}
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == "-e" {
+			name := strings.SplitN(args[i+1], "=", 2)[0]
+			commit = append(commit, "--change", fmt.Sprintf("ENV %s=%s", name, strconv.Quote(env[name])))
+		}
+	}
+	if base.WorkingDir == "" {
+		base.WorkingDir = "/"
+	}
+	commit = append(commit, "--change", "WORKDIR "+base.WorkingDir, "--change", "LABEL xgo.warm-start.image="+strconv.Quote(b.cfg.Image), container, image)
+	if out, err := b.command(commit...).CombinedOutput(); err != nil {
+		log.Printf("WARNING: Failed to commit warm start image %s: %v: %s", image, err, strings.TrimSpace(string(out)))
+		return
+	}
+	log.Printf("INFO: Committed warm start image %s", image)
+}
@@ -0,0 +1,410 @@
+package xgo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// WindowsResources is the version information, icon and manifest embedded into
+// the Windows binaries, compiled by xgo into a .syso object per architecture that
+// the Go tool links into the main packages it's placed next to.
+type WindowsResources struct {
+	Icon           string `yaml:"icon" toml:"icon"`                           // Icon file (.ico), relative to the project path
+	Manifest       string `yaml:"manifest" toml:"manifest"`                   // Application manifest file, relative to the project path
+	ProductName    string `yaml:"product-name" toml:"product-name"`           // Name of the product, the project folder name if empty
+	ProductVersion string `yaml:"product-version" toml:"product-version"`     // Version of the product, the project version if empty
+	FileVersion    string `yaml:"file-version" toml:"file-version"`           // Version of the binaries, the product version if empty
+	Description    string `yaml:"description" toml:"description"`             // Description of the binaries, the product name if empty
+	Company        string `yaml:"company" toml:"company"`                     // Company producing the binaries
+	Copyright      string `yaml:"copyright" toml:"copyright"`                 // Copyright notice of the binaries
+	Trademarks     string `yaml:"trademarks" toml:"trademarks"`               // Trademarks notice of the binaries
+	Comments       string `yaml:"comments" toml:"comments"`                   // Extra information to display
+	InternalName   string `yaml:"internal-name" toml:"internal-name"`         // Internal name of the binaries, none if empty
+	OriginalName   string `yaml:"original-filename" toml:"original-filename"` // Original file name of the binaries, none if empty
+}
+
+// Resource types, language and relocations of the compiled resource objects.
+const (
+	rtIcon      = 3
+	rtGroupIcon = 14
+	rtVersion   = 16
+	rtManifest  = 24
+
+	resourceLang    = 0x0409 // English (United States)
+	resourceCharset = 0x04b0 // Unicode
+)
+
+// resourceMachines are the COFF machine types and image relative relocation
+// types (ADDR32NB) of the Windows architectures.
+var resourceMachines = map[string][2]uint16{
+	"386":   {0x14c, 0x07},
+	"amd64": {0x8664, 0x03},
+	"arm":   {0x1c4, 0x02},
+	"arm64": {0xaa64, 0x02},
+}
+
+// windowsResourceName is the name of the .syso objects placed next to the main
+// packages, the Go tool linking the one of the target architecture.
+const windowsResourceName = "xgo_winres_windows_%s.syso"
+
+// resource is a single entry of a resource section.
+type resource struct {
+	typ  uint32
+	id   uint32
+	data []byte
+}
+
+// writeWindowsResources compiles the Windows resources of the build into a .syso
+// object per architecture within a folder of the work folder, mounted into the
+// build containers (at /xgo-winres).
+func (b *builder) writeWindowsResources() error {
+	resources, err := b.windowsResources()
+	if err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp(b.work, "winres-")
+	if err != nil {
+		return err
+	}
+	for arch, machine := range resourceMachines {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf(windowsResourceName, arch)), resourceObject(machine, resources), 0644); err != nil {
+			return err
+		}
+	}
+	b.winres = dir
+	return nil
+}
+
+// windowsResources assembles the resource entries of the configured icon,
+// manifest and version information.
+func (b *builder) windowsResources() ([]resource, error) {
+	res, project := b.cfg.WindowsResources, b.cfg.Project.ProjectPath
+
+	var resources []resource
+	if res.Icon != "" {
+		blob, err := os.ReadFile(filepath.Join(project, res.Icon))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read icon: %v", err)
+		}
+		icons, err := iconResources(blob)
+		if err != nil {
+			return nil, fmt.Errorf("invalid icon %s: %v", res.Icon, err)
+		}
+		resources = append(resources, icons...)
+	}
+	if res.Manifest != "" {
+		blob, err := os.ReadFile(filepath.Join(project, res.Manifest))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read manifest: %v", err)
+		}
+		resources = append(resources, resource{typ: rtManifest, id: 1, data: blob})
+	}
+	info := *res
+	if info.ProductName == "" {
+		if abs, err := filepath.Abs(project); err == nil {
+			info.ProductName = filepath.Base(abs)
+		}
+	}
+	if info.ProductVersion == "" {
+		info.ProductVersion = projectVersion(project)
+	}
+	if info.FileVersion == "" {
+		info.FileVersion = info.ProductVersion
+	}
+	if info.Description == "" {
+		info.Description = info.ProductName
+	}
+	resources = append(resources, resource{typ: rtVersion, id: 1, data: versionInfo(&info)})
+	return resources, nil
+}
+
+// iconResources splits an .ico file into its images and the icon group
+// referencing them.
+func iconResources(blob []byte) ([]resource, error) {
+	if len(blob) < 6 || binary.LittleEndian.Uint16(blob[0:]) != 0 || binary.LittleEndian.Uint16(blob[2:]) != 1 {
+		return nil, fmt.Errorf("not an .ico file")
+	}
+	count := int(binary.LittleEndian.Uint16(blob[4:]))
+	if count == 0 || len(blob) < 6+16*count {
+		return nil, fmt.Errorf("no images")
+	}
+	group := new(bytes.Buffer)
+	binary.Write(group, binary.LittleEndian, []uint16{0, 1, uint16(count)})
+
+	var resources []resource
+	for i := 0; i < count; i++ {
+		entry := blob[6+16*i : 6+16*(i+1)]
+		size, offset := binary.LittleEndian.Uint32(entry[8:]), binary.LittleEndian.Uint32(entry[12:])
+		if uint64(offset)+uint64(size) > uint64(len(blob)) {
+			return nil, fmt.Errorf("image %d out of bounds", i+1)
+		}
+		resources = append(resources, resource{typ: rtIcon, id: uint32(i + 1), data: blob[offset : offset+size]})
+
+		// Group entries are the directory entries with the image ID as the offset
+		group.Write(entry[:12])
+		binary.Write(group, binary.LittleEndian, uint16(i+1))
+	}
+	return append(resources, resource{typ: rtGroupIcon, id: 1, data: group.Bytes()}), nil
+}
+
+// versionInfo encodes the VS_VERSIONINFO resource of the version information.
+func versionInfo(res *WindowsResources) []byte {
+	fileMS, fileLS := fixedVersion(res.FileVersion)
+	productMS, productLS := fixedVersion(res.ProductVersion)
+
+	fixed := new(bytes.Buffer)
+	binary.Write(fixed, binary.LittleEndian, []uint32{
+		0xfeef04bd, 0x00010000, // Signature and structure version
+		fileMS, fileLS, productMS, productLS,
+		0x3f, 0, // File flags mask and flags
+		0x40004, 1, 0, // Windows NT, application, no subtype
+		0, 0, // File date
+	})
+	var values [][]byte
+	for _, field := range [][2]string{
+		{"Comments", res.Comments},
+		{"CompanyName", res.Company},
+		{"FileDescription", res.Description},
+		{"FileVersion", res.FileVersion},
+		{"InternalName", res.InternalName},
+		{"LegalCopyright", res.Copyright},
+		{"LegalTrademarks", res.Trademarks},
+		{"OriginalFilename", res.OriginalName},
+		{"ProductName", res.ProductName},
+		{"ProductVersion", res.ProductVersion},
+	} {
+		if field[1] != "" {
+			value := utf16String(field[1])
+			values = append(values, versionBlock(field[0], 1, value, len(value)/2))
+		}
+	}
+	table := versionBlock(fmt.Sprintf("%04X%04X", resourceLang, resourceCharset), 1, nil, 0, values...)
+	translation := make([]byte, 4)
+	binary.LittleEndian.PutUint16(translation, resourceLang)
+	binary.LittleEndian.PutUint16(translation[2:], resourceCharset)
+
+	return versionBlock("VS_VERSION_INFO", 0, fixed.Bytes(), fixed.Len(),
+		versionBlock("StringFileInfo", 1, nil, 0, table),
+		versionBlock("VarFileInfo", 1, nil, 0, versionBlock("Translation", 0, translation, len(translation))),
+	)
+}
+
+// versionBlock encodes a block of a version resource: its length, value length
+// (in words for text values), type and key, followed by its value and children,
+// each aligned on 32 bits.
+func versionBlock(key string, typ uint16, value []byte, valueLen int, children ...[]byte) []byte {
+	block := new(bytes.Buffer)
+	binary.Write(block, binary.LittleEndian, []uint16{0, uint16(valueLen), typ})
+	block.Write(utf16String(key))
+	if len(value) > 0 {
+		pad(block, 4)
+		block.Write(value)
+	}
+	for _, child := range children {
+		pad(block, 4)
+		block.Write(child)
+	}
+	blob := block.Bytes()
+	binary.LittleEndian.PutUint16(blob, uint16(len(blob)))
+	return blob
+}
+
+// fixedVersion packs the leading numbers of a version (e.g. 1.2.3-rc.1) into the
+// most and least significant halves of a fixed file version.
+func fixedVersion(version string) (uint32, uint32) {
+	var parts [4]uint32
+	for i, field := range strings.SplitN(strings.TrimPrefix(version, "v"), ".", 4) {
+		end := strings.IndexFunc(field, func(r rune) bool { return r < '0' || r > '9' })
+		if end < 0 {
+			end = len(field)
+		}
+		n, _ := strconv.ParseUint(field[:end], 10, 16)
+		parts[i] = uint32(n)
+		if end < len(field) {
+			break
+		}
+	}
+	return parts[0]<<16 | parts[1], parts[2]<<16 | parts[3]
+}
+
+// utf16String encodes a string as zero terminated little endian UTF-16.
+func utf16String(s string) []byte {
+	words := append(utf16.Encode([]rune(s)), 0)
+	blob := make([]byte, 2*len(words))
+	for i, word := range words {
+		binary.LittleEndian.PutUint16(blob[2*i:], word)
+	}
+	return blob
+}
+
+// pad zero pads a buffer to a multiple of the given alignment.
+func pad(buf *bytes.Buffer, align int) {
+	for buf.Len()%align != 0 {
+		buf.WriteByte(0)
+	}
+}
+
+// resourceObject assembles a COFF object of the given machine holding a single
+// .rsrc section of the resources: a three level (type, ID, language) resource
+// directory, the data entries and the data itself, the data entries addressing
+// it via image relative relocations against the section symbol.
+func resourceObject(machine [2]uint16, resources []resource) []byte {
+	sort.Slice(resources, func(i, j int) bool {
+		if resources[i].typ != resources[j].typ {
+			return resources[i].typ < resources[j].typ
+		}
+		return resources[i].id < resources[j].id
+	})
+	var types []uint32
+	ids := make(map[uint32][]resource)
+	for _, res := range resources {
+		if len(ids[res.typ]) == 0 {
+			types = append(types, res.typ)
+		}
+		ids[res.typ] = append(ids[res.typ], res)
+	}
+	// Lay out the directories, then the data entries and the data
+	dirSize := func(entries int) uint32 { return uint32(16 + 8*entries) }
+
+	size := dirSize(len(types))
+	idDirs := make(map[uint32]uint32)
+	for _, typ := range types {
+		idDirs[typ] = size
+		size += dirSize(len(ids[typ]))
+	}
+	langDirs := make([]uint32, len(resources))
+	for i := range resources {
+		langDirs[i] = size
+		size += dirSize(1)
+	}
+	entries := size
+	size += uint32(16 * len(resources))
+
+	dataOffsets := make([]uint32, len(resources))
+	for i, res := range resources {
+		size = (size + 7) &^ 7
+		dataOffsets[i] = size
+		size += uint32(len(res.data))
+	}
+	section := make([]byte, (size+3)&^3)
+
+	dir := func(offset uint32, children [][2]uint32) {
+		binary.LittleEndian.PutUint16(section[offset+14:], uint16(len(children)))
+		for i, child := range children {
+			binary.LittleEndian.PutUint32(section[offset+16+8*uint32(i):], child[0])
+			binary.LittleEndian.PutUint32(section[offset+20+8*uint32(i):], child[1])
+		}
+	}
+	var root [][2]uint32
+	index := 0
+	for _, typ := range types {
+		root = append(root, [2]uint32{typ, 0x80000000 | idDirs[typ]})
+
+		var named [][2]uint32
+		for _, res := range ids[typ] {
+			named = append(named, [2]uint32{res.id, 0x80000000 | langDirs[index]})
+			dir(langDirs[index], [][2]uint32{{resourceLang, entries + uint32(16*index)}})
+			index++
+		}
+		dir(idDirs[typ], named)
+	}
+	dir(0, root)
+
+	relocs := new(bytes.Buffer)
+	for i, res := range resources {
+		entry := entries + uint32(16*i)
+		binary.LittleEndian.PutUint32(section[entry:], dataOffsets[i])
+		binary.LittleEndian.PutUint32(section[entry+4:], uint32(len(res.data)))
+		copy(section[dataOffsets[i]:], res.data)
+
+		binary.Write(relocs, binary.LittleEndian, entry)
+		binary.Write(relocs, binary.LittleEndian, uint32(0)) // Section symbol
+		binary.Write(relocs, binary.LittleEndian, machine[1])
+	}
+	// Assemble the object: file header, section header, section data, relocations,
+	// symbol table and an empty string table
+	const headers = 20 + 40
+	symbols := headers + uint32(len(section)) + uint32(relocs.Len())
+
+	obj := new(bytes.Buffer)
+	binary.Write(obj, binary.LittleEndian, machine[0])
+	binary.Write(obj, binary.LittleEndian, []uint16{1, 0, 0}) // Sections, time stamp
+	binary.Write(obj, binary.LittleEndian, []uint32{symbols, 1})
+	binary.Write(obj, binary.LittleEndian, []uint16{0, 0}) // Optional header, characteristics
+
+	obj.WriteString(".rsrc\x00\x00\x00")
+	binary.Write(obj, binary.LittleEndian, []uint32{0, 0, uint32(len(section)), headers, headers + uint32(len(section)), 0})
+	binary.Write(obj, binary.LittleEndian, []uint16{uint16(len(resources)), 0})
+	binary.Write(obj, binary.LittleEndian, uint32(0x40000040)) // Initialized data, readable
+
+	obj.Write(section)
+	obj.Write(relocs.Bytes())
+
+	obj.WriteString(".rsrc\x00\x00\x00")
+	binary.Write(obj, binary.LittleEndian, uint32(0))
+	binary.Write(obj, binary.LittleEndian, []uint16{1, 0})
+	obj.Write([]byte{3, 0}) // Static, no auxiliary symbols
+	binary.Write(obj, binary.LittleEndian, uint32(4))
+
+	return obj.Bytes()
+}
+
+// placeWindowsResources copies the compiled Windows resources next to the main
+// packages built with the local Go toolchain, skipping the packages having their
+// own .syso objects. The returned function removes them.
+func (b *builder) placeWindowsResources(packages []string) (func(), error) {
+	cmd := exec.CommandContext(b.ctx, "go", append([]string{"list", "-f", "{{if eq .Name \"main\"}}{{.Dir}}{{end}}"}, packages...)...)
+	cmd.Dir = b.cfg.Project.ProjectPath
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list main packages: %v", err)
+	}
+	var placed []string
+	cleanup := func() {
+		for _, path := range placed {
+			os.Remove(path)
+		}
+	}
+	for _, dir := range strings.Fields(string(out)) {
+		if own, _ := filepath.Glob(filepath.Join(dir, "*.syso")); len(own) > 0 {
+			log.Printf("INFO: Keeping the own Windows resources of %s", dir)
+			continue
+		}
+		for arch := range resourceMachines {
+			name := fmt.Sprintf(windowsResourceName, arch)
+			blob, err := os.ReadFile(filepath.Join(b.winres, name))
+			if err == nil {
+				err = os.WriteFile(filepath.Join(dir, name), blob, 0644)
+			}
+			if err != nil {
+				cleanup()
+				return nil, fmt.Errorf("failed to place Windows resources into %s: %v", dir, err)
+			}
+			placed = append(placed, filepath.Join(dir, name))
+		}
+	}
+	return cleanup, nil
+}
+
+// hasWindowsTarget checks whether any of the targets builds for Windows, no
+// targets standing for all of them.
+func hasWindowsTarget(targets []string) bool {
+	if len(targets) == 0 {
+		return true
+	}
+	for _, target := range ExpandTargets(targets) {
+		if goos, _, _ := targetPlatform(target); goos == "windows" {
+			return true
+		}
+	}
+	return false
+}
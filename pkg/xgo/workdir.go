@@ -0,0 +1,31 @@
+package xgo
+
+import (
+	"log"
+	"os"
+)
+
+// makeWorkDir creates the work folder staging the temporary data of the build
+// (generated files, inputs of remote builds, secrets), within the configured
+// work folder location or the system temp folder. The returned function removes
+// it once the build is done, unless it is kept for inspection.
+func (b *builder) makeWorkDir() (func(), error) {
+	if b.cfg.WorkDir != "" {
+		if err := os.MkdirAll(b.cfg.WorkDir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	work, err := os.MkdirTemp(b.cfg.WorkDir, "xgo-work-")
+	if err != nil {
+		return nil, err
+	}
+	b.work = work
+
+	return func() {
+		if b.cfg.KeepWork {
+			log.Printf("INFO: Kept work folder %s", work)
+			return
+		}
+		os.RemoveAll(work)
+	}, nil
+}
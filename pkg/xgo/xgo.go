@@ -0,0 +1,1263 @@
+// Package xgo implements the cross compilation pipeline of xgo, building Go
+// projects with CGO dependencies for many platforms in cross compiler docker
+// containers, so that other tools can embed xgo instead of running its binary.
+package xgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/build"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// DefaultDepsCache is the default folder caching the downloaded CGO dependencies,
+// within the cache folder of the user (e.g. $XDG_CACHE_HOME/xgo/deps) as the
+// temporary folder is wiped on reboot by many systems.
+var DefaultDepsCache = defaultDepsCache()
+
+// defaultDepsCache resolves the default dependency cache folder, falling back to
+// the temporary folder if the user has no cache folder (e.g. no $HOME).
+func defaultDepsCache() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "xgo-cache")
+	}
+	return filepath.Join(dir, "xgo", "deps")
+}
+
+// ConfigFlags is a simple set of flags to define the environment and dependencies.
+type ConfigFlags struct {
+	Package      string   // Sub-package to build if not root import
+	Include      string   // Package patterns to build
+	Exclude      string   // Package patterns to exclude from the build
+	Prefix       string   // Prefix to use for output naming
+	Remote       string   // Version control remote repository to build
+	Branch       string   // Version control branch to build
+	Dependencies string   // CGO dependencies (configure/make based archive URLs, git+<url>@<tag> repositories or local folders)
+	Arguments    string   // CGO dependency configure arguments
+	Targets      []string // 项目命令所在相对目录，为空时默认为项目根目录 例如：cmd/xxx
+	ProjectPath  string   // 项目根目录
+	BinPath      string   // Go构建命令目录
+	CmdPath      string   // 项目命令所在相对目录，为空时默认为项目根目录 例如：cmd/xxx
+
+	Profiles map[string]*TargetProfile // Custom toolchains to build specific targets with
+	Groups   map[string][]string       // User defined target groups, keyed by the name standing for their targets
+}
+
+// BuildFlags is a simple collection of flags to fine tune a build.
+type BuildFlags struct {
+	Verbose  bool   // Print the names of packages as they are compiled
+	Steps    bool   // Print the command as executing the builds
+	Race     bool   // Enable data race detection (supported only on amd64)
+	Tags     string // List of build tags to consider satisfied during the build
+	LdFlags  string // Arguments to pass on each go tool link invocation, executed as a template with LdFlagsData
+	Mode     string // Indicates which kind of object file to build
+	VCS      string // Whether to stamp binaries with version control information
+	TrimPath bool   // Remove all file system paths from the resulting executable
+	ArmABI   string // Float ABI to use for 32 bit ARM targets (soft, hard)
+	Libc     string // C library of the Linux targets (glibc, musl), musl switching the targets having a musl toolchain to it
+	SynthMod bool   // Build GOPATH mode projects as modules with a generated go.mod
+	Epoch    string // SOURCE_DATE_EPOCH of the builds and packages (seconds, or git for the last commit time), unset if empty
+
+	CgoCFlags  TargetValues // Extra CGO_CFLAGS, optionally overridden per target
+	CgoLdFlags TargetValues // Extra CGO_LDFLAGS, optionally overridden per target
+
+	Overrides map[string]*TargetOverride // Per-target tags, ldflags, compilers and env, keyed by os/arch pattern
+	Subsystem string                     // Subsystem of the Windows targets (gui, console), console if empty
+}
+
+// Config is the full specification of a cross compilation: the project to build,
+// the build flags and the environment to build in.
+type Config struct {
+	Project ConfigFlags // Project, packages and targets to build
+	Flags   BuildFlags  // Flags to fine tune the Go builds
+
+	Image        string   // Docker image to build in, empty to build in the current system (within an xgo image)
+	Runtime      string   // Container runtime (docker, podman), detected if empty
+	RemoteEngine string   // Whether the container engine is remote (auto, true, false), auto if empty
+	Pull         string   // When to pull the image (always, missing, never), missing if empty
+	Native       bool     // Build pure Go targets with the local Go toolchain instead of containers
+	FastPath     bool     // Build a single requested pure Go target with the local Go toolchain, skipping the image
+	DryRun       bool     // Print the resolved targets and build commands instead of running them
+	Constraints  bool     // Check the build constraints of the project per target instead of building
+	Reproducible bool     // Build deterministically: trimmed paths, no VCS stamping, empty build IDs and a fixed SOURCE_DATE_EPOCH
+	AutoVersion  bool     // Stamp the conventional version variables of the project (e.g. main.version) with its git metadata
+	VerifyRepro  bool     // Build every target twice reproducibly, comparing the outputs instead of packaging them
+	GoCache      string   // Go build cache of the native builds (GOCACHE), the host one if empty
+	Parallel     int      // Number of targets to build concurrently, each in its own container
+	Retries      int      // Number of times to retry a failed target in a fresh container
+	Network      string   // Network of the build containers
+	DNS          []string // Custom DNS servers of the build containers
+	DNSSearch    []string // Custom DNS search domains of the build containers
+	AddHosts     []string // Custom host-to-IP mappings of the build containers (host:ip)
+	GoProxy      string   // Go module proxy (GOPROXY)
+	GoSumDB      string   // Checksum database to verify modules with (GOSUMDB)
+	GoNoSumDB    string   // Module path patterns not to verify (GONOSUMDB)
+	GoPrivate    string   // Module path patterns of private modules (GOPRIVATE)
+	GoNoProxy    string   // Module path patterns not to download through the proxy (GONOPROXY)
+	GoInsecure   string   // Module path patterns allowed to be fetched insecurely (GOINSECURE)
+	GoFlags      string   // Default flags of the go commands (GOFLAGS)
+	Warm         bool     // Download all modules in a networked container before building
+	WarmStart    bool     // Commit the build containers once their CGO dependencies are built into local images reused by later builds
+	SSHAgent     bool     // Forward the SSH agent of the host to fetch private modules over SSH
+	Netrc        string   // Credentials file (.netrc) to fetch private modules over HTTPS with, auto to detect, none if empty
+	GitConfig    bool     // Forward the git configuration and credentials of the host, detecting the .netrc unless given
+	DepsCache    string   // Folder caching the CGO dependencies, DefaultDepsCache if empty
+	ProjectCache string   // Project specific layer of the dependency cache (relative to the project path), consulted first and downloaded into
+	DepsMirrors  []string // URL rewrite rules of the CGO dependency downloads
+
+	Verify         bool              // Verify that the binaries match their declared targets
+	Linkage        string            // Expected linkage of the Linux binaries (static, dynamic)
+	AllowedLibs    []string          // Library name patterns the binaries may dynamically link
+	TargetBinPaths map[string]string // Output folders of specific targets, keyed by os/arch pattern
+	Packages       []PackageRule     // Package formats to bundle the outputs of the targets into
+	Generate       []Generator       // Commands run with a built binary to generate files to bundle into the packages
+	Render         []RenderFile      // Templates to render from the build manifest into the bin path
+	Variants       []FeatureVariant  // Feature variants to build every target in, e.g. oss and enterprise
+	Filters        []ArtifactFilter  // Post-build transforms of the artifact set (rename, move, exclude, alias), applied in order
+	Checksums      []string          // Algorithms to write checksum files of the artifacts with (sha1, sha256, sha512)
+	Publish        []string          // Publishers to distribute the artifacts with, as <name>:<destination> (e.g. github:owner/repo)
+	ReleaseNotes   string            // Notes of the published releases: conventional to group the conventional commits since the previous tag, or a template file executed with ReleaseNotesData, none if empty
+	ReportJSON     string            // File to write the JSON build report to, none if empty
+	KeepOnFailure  bool              // Keep failed build containers for inspection instead of removing them
+	DebugShell     bool              // Spawn an interactive shell in a snapshot of failed build containers
+	WorkDir        string            // Folder to stage the temporary build data in, the system temp folder if empty
+	KeepWork       bool              // Keep the work folder of the build for inspection instead of removing it
+	ReadOnlySource bool              // Mount the project sources read-only, the build writing into an overlay
+	SourceIgnore   []string          // Patterns of the project files to keep out of the build containers, added to the .xgoignore ones
+	NameTemplate   string            // Template of the output names, executed with NameData (e.g. {{.Name}}-{{.OS}}-{{.Arch}}{{.Ext}})
+	PlatformDirs   bool              // Move the Linux outputs into docker platform folders (e.g. linux/arm/v7/geth)
+	ArtifactCache  string            // Remote cache of the outputs of every target (s3://bucket/prefix or an HTTP(S) URL), none if empty
+	CodeSignKey    string            // Cloud held key to Authenticode sign the Windows binaries with (awskms:, gcpkms: or azurekv:), unsigned if empty
+	WindowsSignPFX string            // PFX certificate to Authenticode sign the Windows binaries with using osslsigncode, unsigned if empty
+
+	MacSignIdentity string // Keychain identity to sign the macOS binaries with using codesign, unsigned if empty
+	MacSignKeychain string // Keychain holding the signing identity, the default search list if empty
+	MacSignP12      string // PKCS#12 certificate to sign the macOS binaries with using rcodesign (e.g. on Linux hosts), unsigned if empty
+	MacNotarize     bool   // Submit the signed macOS binaries to the Apple notary service
+
+	WindowsResources *WindowsResources // Version information, icon and manifest to embed into the Windows binaries, none if nil
+
+	RegistryUser     string // User to log in to the registry of the image as before pulling, none if empty
+	RegistryPassword string // Password or access token of the registry user
+
+	ImagePolicy    *ImagePolicy // Allowlist of the images to build in, any image allowed if nil
+	PolicyOverride bool         // Build in images outside of the image policy, with a warning
+
+	Secrets map[string]string // Secrets exported to the builds, passed as files (/run/secrets/<name>) and masked in their output
+	Hooks   map[string]Hook   // Callbacks run once a build stage is done, keyed by stage (build, package)
+
+	Stdout io.Writer // Output of the builds, os.Stdout if nil
+	Stderr io.Writer // Error output of the builds, os.Stderr if nil
+}
+
+// Artifact is an output produced by a build.
+type Artifact struct {
+	Path    string // Location of the artifact on the host
+	Target  string // Target the artifact was built for, empty if unknown
+	Feature string // Feature variant the artifact was built in, empty if none
+}
+
+// builder is the state of a single cross compilation.
+type builder struct {
+	ctx      context.Context
+	cfg      *Config
+	runtime  string                // Container engine CLI to run the builds with
+	remote   bool                  // Whether the container engine runs on another machine
+	natives  map[string]bool       // Targets built with the local Go toolchain
+	feature  string                // Feature variant being built, empty if none
+	owner    []string              // Environment handing the created files back to the host user, nil until resolved
+	secrets  string                // Folder of the secret files mounted into the build containers, none if empty
+	winres   string                // Folder of the compiled Windows resources mounted into the build containers, none if empty
+	ignore   *sourceFilter         // Project files kept out of the build containers, the sources being copied in, bind mounted if nil
+	work     string                // Work folder staging the temporary data of the build, none until created
+	stats    CacheStats            // Cache hits and misses of the build
+	digest   string                // Resolved content digest of the build image, empty if unused
+	nameTmpl *template.Template    // Template of the output names, nil to keep the defaults
+	publish  []Publisher           // Publishers of the artifacts, in the order of the publish specs
+	notes    *template.Template    // Template of the release notes, nil for the conventional ones
+	store    artifactStore         // Remote cache of the outputs of the targets, nil if unused
+	issues   []CompatIssue         // Known-bad combinations of the targets with the build settings
+	runs     map[string]*targetRun // Compilations of the targets, keyed by target
+	lock     sync.Mutex            // Guards the target runs of parallel builds
+	stdout   io.Writer
+	stderr   io.Writer
+}
+
+// newBuilder validates a build configuration and resolves its environment.
+func newBuilder(ctx context.Context, cfg *Config) (*builder, error) {
+	if cfg.Flags.ArmABI != "" && cfg.Flags.ArmABI != "soft" && cfg.Flags.ArmABI != "hard" {
+		return nil, fmt.Errorf("invalid ARM float ABI %q, must be soft or hard", cfg.Flags.ArmABI)
+	}
+	if cfg.Flags.Libc != "" && cfg.Flags.Libc != "glibc" && cfg.Flags.Libc != "musl" {
+		return nil, fmt.Errorf("invalid C library %q, must be glibc or musl", cfg.Flags.Libc)
+	}
+	if cfg.Flags.Subsystem != "" && cfg.Flags.Subsystem != "gui" && cfg.Flags.Subsystem != "console" {
+		return nil, fmt.Errorf("invalid windows subsystem %q, must be gui or console", cfg.Flags.Subsystem)
+	}
+	if cfg.RegistryUser == "" && cfg.RegistryPassword != "" {
+		return nil, errors.New("registry password given without a registry user")
+	}
+	if cfg.RegistryUser != "" && cfg.RegistryPassword == "" {
+		return nil, fmt.Errorf("no registry password given for user %s", cfg.RegistryUser)
+	}
+	if err := validateVariants(cfg.Variants); err != nil {
+		return nil, err
+	}
+	if err := validateSecrets(cfg.Secrets); err != nil {
+		return nil, err
+	}
+	if cfg.Linkage != "" && cfg.Linkage != "static" && cfg.Linkage != "dynamic" {
+		return nil, fmt.Errorf("invalid expected linkage %q, must be static or dynamic", cfg.Linkage)
+	}
+	if cfg.RemoteEngine != "" && cfg.RemoteEngine != "auto" && cfg.RemoteEngine != "true" && cfg.RemoteEngine != "false" {
+		return nil, fmt.Errorf("invalid remote engine mode %q, must be auto, true or false", cfg.RemoteEngine)
+	}
+	if cfg.Pull != "" && cfg.Pull != "always" && cfg.Pull != "missing" && cfg.Pull != "never" {
+		return nil, fmt.Errorf("invalid pull policy %q, must be always, missing or never", cfg.Pull)
+	}
+	if cfg.ImagePolicy != nil {
+		if err := cfg.ImagePolicy.validate(); err != nil {
+			return nil, err
+		}
+	}
+	for pattern, override := range cfg.Flags.Overrides {
+		if err := override.validate(pattern); err != nil {
+			return nil, err
+		}
+	}
+	for i := range cfg.Packages {
+		if err := cfg.Packages[i].validate(); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.DebugShell && cfg.Parallel > 1 {
+		return nil, errors.New("debug shells require sequential builds, drop the parallel setting")
+	}
+	if len(cfg.Generate) > 0 && len(cfg.Packages) == 0 {
+		return nil, errors.New("generators require package rules to bundle their outputs into")
+	}
+	for i := range cfg.Generate {
+		if err := cfg.Generate[i].validate(); err != nil {
+			return nil, err
+		}
+	}
+	for i := range cfg.Render {
+		if err := cfg.Render[i].validate(); err != nil {
+			return nil, err
+		}
+	}
+	for i := range cfg.Filters {
+		if err := cfg.Filters[i].validate(); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateChecksums(cfg.Checksums); err != nil {
+		return nil, err
+	}
+	if cfg.DepsCache == "" {
+		cfg.DepsCache = DefaultDepsCache
+	}
+	if cfg.GitConfig && cfg.Netrc == "" {
+		cfg.Netrc = "auto"
+	}
+	if cfg.ProjectCache != "" && !filepath.IsAbs(cfg.ProjectCache) {
+		if !isLocalPath(cfg.Project.ProjectPath) {
+			return nil, fmt.Errorf("project dependency cache %s requires a local project path", cfg.ProjectCache)
+		}
+		cache, err := filepath.Abs(filepath.Join(cfg.Project.ProjectPath, cfg.ProjectCache))
+		if err != nil {
+			return nil, err
+		}
+		cfg.ProjectCache = cache
+	}
+	b := &builder{ctx: ctx, cfg: cfg, natives: make(map[string]bool), runs: make(map[string]*targetRun), stdout: cfg.Stdout, stderr: cfg.Stderr}
+	if cfg.NameTemplate != "" {
+		tmpl, err := template.New("name").Option("missingkey=error").Parse(cfg.NameTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid name template: %v", err)
+		}
+		if err := tmpl.Execute(io.Discard, &NameData{}); err != nil {
+			return nil, fmt.Errorf("invalid name template: %v", err)
+		}
+		b.nameTmpl = tmpl
+	}
+	for _, spec := range cfg.Publish {
+		publisher, err := NewPublisher(spec)
+		if err != nil {
+			return nil, err
+		}
+		b.publish = append(b.publish, publisher)
+	}
+	if cfg.ReleaseNotes != "" {
+		tmpl, err := parseReleaseNotes(cfg)
+		if err != nil {
+			return nil, err
+		}
+		b.notes = tmpl
+	}
+	if cfg.ArtifactCache != "" {
+		store, err := newArtifactStore(cfg.ArtifactCache)
+		if err != nil {
+			return nil, err
+		}
+		b.store = store
+	}
+	if cfg.CodeSignKey != "" {
+		if cfg.WindowsSignPFX != "" {
+			return nil, errors.New("both a code signing key and a PFX certificate given, select one to sign the Windows binaries with")
+		}
+		if _, err := parseCodeSignKey(cfg.CodeSignKey); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateMacSign(cfg); err != nil {
+		return nil, err
+	}
+	if b.stdout == nil {
+		b.stdout = os.Stdout
+	}
+	if b.stderr == nil {
+		b.stderr = os.Stderr
+	}
+	if len(cfg.Secrets) > 0 {
+		stdout := newRedactWriter(b.stdout, cfg.Secrets)
+		if b.stderr == b.stdout {
+			b.stdout, b.stderr = stdout, stdout
+		} else {
+			b.stdout, b.stderr = stdout, newRedactWriter(b.stderr, cfg.Secrets)
+		}
+	}
+	if err := b.checkImagePolicy("", false); err != nil {
+		return nil, err
+	}
+	if cfg.Image != "" {
+		runtime, err := Runtime(cfg.Runtime)
+		if err != nil {
+			return nil, err
+		}
+		b.runtime = runtime
+		b.remote = b.isRemoteEngine()
+	}
+	return b, nil
+}
+
+// resolveFlags resolves the build flags derived from the configuration: the
+// reproducible build settings, the SOURCE_DATE_EPOCH, the linker flags templates
+// and the version variables to stamp.
+func resolveFlags(cfg *Config) (err error) {
+	if cfg.Reproducible {
+		cfg.Flags = reproducibleFlags(cfg.Flags)
+	}
+	if cfg.Flags.Epoch, err = sourceDateEpoch(cfg.Project.ProjectPath, cfg.Flags.Epoch, cfg.Reproducible); err != nil {
+		return err
+	}
+	if cfg.Flags, err = templateLdFlags(cfg.Project.ProjectPath, cfg.Flags); err != nil {
+		return err
+	}
+	if cfg.AutoVersion {
+		cfg.Flags, err = autoVersion(cfg.Project.ProjectPath, cfg.Flags)
+	}
+	return err
+}
+
+// Build cross compiles a project according to the given configuration, returning
+// the produced artifacts. If the build fails, the artifacts produced before the
+// failure are returned along with the error.
+func Build(ctx context.Context, cfg Config) (artifacts []Artifact, err error) {
+	if cfg.VerifyRepro {
+		return verifyReproducible(ctx, cfg)
+	}
+	if err := resolveFlags(&cfg); err != nil {
+		return nil, err
+	}
+	b, err := newBuilder(ctx, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer b.flushOutput()
+
+	// Expand the target groups, then the wildcard targets to the platforms of the
+	// selected Go toolchain
+	if cfg.Project.Targets, err = expandGroups(cfg.Project.Targets, cfg.Project.Groups, cfg.Project.Profiles); err != nil {
+		return nil, err
+	}
+	if expandable(cfg.Project.Targets) {
+		cfg.Project.Targets = expandTargets(cfg.Project.Targets, b.platforms())
+		if len(cfg.Project.Targets) == 0 {
+			return nil, fmt.Errorf("no targets left once the excluded ones removed")
+		}
+	}
+	// Switch the Linux targets to musl if requested, all targets being covered if
+	// none are given
+	if cfg.Flags.Libc == "musl" {
+		if len(cfg.Project.Targets) == 0 {
+			cfg.Project.Targets = b.platforms()
+		}
+		cfg.Project.Targets = withLibc(cfg.Project.Targets, cfg.Flags.Libc)
+	}
+	// Lint the build constraints of the project across the targets if requested
+	if cfg.Constraints {
+		targets := ExpandTargets(cfg.Project.Targets)
+		if len(cfg.Project.Targets) == 0 {
+			targets = ExpandTargets([]string{"*/*"})
+		}
+		return nil, b.checkConstraints(targets)
+	}
+	// Write the build report once done, whether the build succeeded or not
+	if cfg.ReportJSON != "" && !cfg.DryRun {
+		start, targets := time.Now(), ExpandTargets(cfg.Project.Targets)
+		if len(cfg.Project.Targets) == 0 {
+			targets = ExpandTargets([]string{"*/*"})
+		}
+		defer func() {
+			if rerr := b.writeReport(cfg.ReportJSON, targets, start, artifacts, err); rerr != nil {
+				if err == nil {
+					err = fmt.Errorf("failed to write build report: %v", rerr)
+				} else {
+					log.Printf("WARNING: Failed to write build report: %v", rerr)
+				}
+			} else {
+				log.Printf("INFO: Wrote build report to %s", cfg.ReportJSON)
+			}
+		}()
+	}
+	// Check the targets against the build settings, failing doomed builds early
+	targets := ExpandTargets(cfg.Project.Targets)
+	if len(cfg.Project.Targets) == 0 {
+		targets = ExpandTargets([]string{"*/*"})
+	}
+	b.issues = b.checkCompat(targets)
+
+	doomed := make(map[string]bool)
+	for _, issue := range b.issues {
+		if issue.Severity == SeverityError {
+			doomed[issue.Target] = true
+		}
+	}
+	if len(doomed) > 0 {
+		return nil, fmt.Errorf("%d targets known not to build with the requested settings, exclude them or change the settings", len(doomed))
+	}
+	// Split off the pure Go targets buildable without containers if requested
+	var natives []string
+	if cfg.Native && cfg.Image != "" {
+		natives, cfg.Project.Targets = b.nativeTargets()
+		for _, target := range natives {
+			b.natives[target] = true
+		}
+		log.Printf("INFO: Building %d targets natively, %d in containers", len(natives), len(cfg.Project.Targets))
+	} else if cfg.FastPath && cfg.Image != "" && len(ExpandTargets(cfg.Project.Targets)) == 1 {
+		if natives, cfg.Project.Targets = b.nativeTargets(); len(natives) == 1 {
+			b.natives[natives[0]] = true
+			log.Printf("INFO: Building pure Go target %s with the local Go toolchain", natives[0])
+		}
+	}
+	if cfg.DryRun {
+		return nil, b.dryRun(natives)
+	}
+	cleanup, err := b.makeWorkDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create work folder: %v", err)
+	}
+	defer cleanup()
+
+	contained := len(natives) == 0 || len(cfg.Project.Targets) > 0
+	if contained && cfg.Image != "" {
+		if err := b.checkRuntime(); err != nil {
+			return nil, fmt.Errorf("failed to check %s installation: %v", b.runtime, err)
+		}
+		if err := b.ensureImage(cfg.Image); err != nil {
+			return nil, err
+		}
+		if b.digest = b.imageDigest(cfg.Image); b.digest != "" {
+			log.Printf("INFO: Using docker image digest %s", b.digest)
+		}
+		if err := b.checkImagePolicy(b.digest, true); err != nil {
+			return nil, err
+		}
+	}
+	if err := b.downloadDeps(); err != nil {
+		return nil, err
+	}
+	// Hand the secrets to the build containers via files if any
+	if len(cfg.Secrets) > 0 && contained && cfg.Image != "" {
+		cleanup, err := b.writeSecrets()
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+	}
+	// Copy the sources into the build containers without the ignored files if any
+	if contained && cfg.Image != "" && isLocalPath(cfg.Project.ProjectPath) {
+		if b.ignore, err = loadSourceFilter(cfg.Project.ProjectPath, cfg.SourceIgnore); err != nil {
+			return nil, fmt.Errorf("failed to load source ignore patterns: %v", err)
+		}
+	}
+	if cfg.WarmStart && (b.remote || b.ignore != nil || cfg.ReadOnlySource) {
+		log.Println("WARNING: Warm start images require bind mounted sources, building the dependencies from scratch")
+		cfg.WarmStart = false
+	}
+	if cfg.WarmStart && (cfg.SSHAgent || cfg.Netrc != "" || cfg.GitConfig || len(cfg.Secrets) > 0) {
+		log.Println("WARNING: Warm start images would keep the forwarded credentials, building the dependencies from scratch")
+		cfg.WarmStart = false
+	}
+	// Compile the Windows resources to embed into the Windows binaries if any
+	if cfg.WindowsResources != nil && isLocalPath(cfg.Project.ProjectPath) && ((len(natives) > 0 && hasWindowsTarget(natives)) || (contained && hasWindowsTarget(cfg.Project.Targets))) {
+		if err := b.writeWindowsResources(); err != nil {
+			return nil, fmt.Errorf("failed to compile Windows resources: %v", err)
+		}
+	}
+	// Populate the module and checksum database caches if requested
+	if cfg.Warm && contained && cfg.Image != "" {
+		if err := b.warm(); err != nil {
+			return nil, fmt.Errorf("failed to warm module caches: %v", err)
+		}
+	}
+	if isLocalPath(cfg.Project.ProjectPath) {
+		b.stats.ModuleHits, b.stats.ModuleMisses = moduleCacheStats(cfg.Project.ProjectPath)
+	}
+	// 在容器或当前系统中执行交叉编译
+	start, outDir := time.Now(), cfg.Project.BinPath
+
+	// Restore the targets built before from the artifact cache if configured
+	var cacheKeys map[string]string
+	if b.store != nil && len(cfg.Variants) == 0 && cfg.Image != "" && isLocalPath(cfg.Project.ProjectPath) {
+		var targets []string
+		if contained {
+			if targets = ExpandTargets(cfg.Project.Targets); len(cfg.Project.Targets) == 0 {
+				targets = ExpandTargets([]string{"*/*"})
+			}
+		}
+		var missing []string
+		cacheKeys, missing = b.restoreArtifacts(b.store, append(append([]string{}, natives...), targets...))
+
+		left := make(map[string]bool)
+		for _, target := range missing {
+			left[target] = true
+		}
+		natives, cfg.Project.Targets = filterTargets(natives, left), filterTargets(targets, left)
+		contained = len(cfg.Project.Targets) > 0
+	}
+	if len(cfg.Variants) > 0 {
+		outDir, artifacts, err = b.compileVariants(natives, contained)
+	} else {
+		outDir, err = b.compileAll(natives, contained)
+		artifacts = collectArtifacts(outDir, start)
+	}
+	b.logCacheStats()
+	if err != nil {
+		return artifacts, fmt.Errorf("failed to cross compile package: %v", err)
+	}
+	// Ensure the produced binaries are really built for their declared targets
+	if cfg.Verify {
+		if err := verifyOutputs(outDir, start, cfg.Linkage); err != nil {
+			return artifacts, fmt.Errorf("failed to verify binaries: %v", err)
+		}
+	}
+	// Audit the dynamic libraries linked by the produced binaries if requested
+	if len(cfg.AllowedLibs) > 0 {
+		if err := auditOutputs(outDir, start, cfg.AllowedLibs); err != nil {
+			return artifacts, fmt.Errorf("failed to audit dynamic linkage: %v", err)
+		}
+	}
+	// Upload the outputs of the targets just built into the artifact cache
+	if cacheKeys != nil {
+		b.storeArtifacts(b.store, cacheKeys, append(append([]string{}, natives...), cfg.Project.Targets...), artifacts)
+	}
+	// Sign the Windows binaries with the cloud held key or certificate before anything bundles them
+	if cfg.CodeSignKey != "" || cfg.WindowsSignPFX != "" {
+		if err := b.signWindows(artifacts); err != nil {
+			return artifacts, fmt.Errorf("failed to sign Windows binaries: %v", err)
+		}
+	}
+	// Sign and notarize the macOS binaries likewise if requested
+	if cfg.MacSignIdentity != "" || cfg.MacSignP12 != "" {
+		if err := b.signMac(artifacts); err != nil {
+			return artifacts, fmt.Errorf("failed to sign macOS binaries: %v", err)
+		}
+	}
+	// Move the outputs of any targets with dedicated output folders
+	if len(cfg.TargetBinPaths) > 0 {
+		moves, err := routeOutputs(outDir, start, cfg.TargetBinPaths)
+		for i, artifact := range artifacts {
+			if dst, ok := moves[artifact.Path]; ok {
+				artifacts[i].Path = dst
+			}
+		}
+		if err != nil {
+			return artifacts, fmt.Errorf("failed to move outputs to their target folders: %v", err)
+		}
+	}
+	if err := b.runHook(StageBuild, artifacts); err != nil {
+		return artifacts, err
+	}
+	// Bundle the mobile libraries into an Android archive or an XCFramework
+	packages, err := b.bundleMobile(artifacts)
+	if err != nil {
+		return append(artifacts, packages...), err
+	}
+	// Bundle the outputs into the packages requested for their targets
+	if len(cfg.Packages) > 0 {
+		bundled, err := b.packageOutputs(artifacts)
+		packages = append(packages, bundled...)
+		if err != nil {
+			return append(artifacts, packages...), err
+		}
+	}
+	// Move the Linux outputs into a docker build context layout if requested
+	if cfg.PlatformDirs {
+		if err := moveToPlatformDirs(artifacts); err != nil {
+			return append(artifacts, packages...), fmt.Errorf("failed to move outputs to their platform folders: %v", err)
+		}
+	}
+	// Rename the outputs after the name template if requested
+	if b.nameTmpl != nil {
+		if err := b.renameOutputs(artifacts); err != nil {
+			return append(artifacts, packages...), fmt.Errorf("failed to rename outputs: %v", err)
+		}
+	}
+	artifacts = append(artifacts, packages...)
+
+	// Run the artifacts through the post-build filters if requested
+	if len(cfg.Filters) > 0 {
+		if artifacts, err = b.filterArtifacts(outDir, artifacts); err != nil {
+			return artifacts, fmt.Errorf("failed to filter artifacts: %v", err)
+		}
+	}
+	// Render the templated files from the build manifest if requested
+	if len(cfg.Render) > 0 {
+		rendered, err := b.renderFiles(outDir, artifacts)
+		artifacts = append(artifacts, rendered...)
+		if err != nil {
+			return artifacts, fmt.Errorf("failed to render files: %v", err)
+		}
+	}
+	// Write the checksum files of all the artifacts if requested
+	if len(cfg.Checksums) > 0 {
+		sums, err := writeChecksums(outDir, artifacts, cfg.Checksums)
+		artifacts = append(artifacts, sums...)
+		if err != nil {
+			return artifacts, fmt.Errorf("failed to write checksums: %v", err)
+		}
+	}
+	if err := b.runHook(StagePackage, artifacts); err != nil {
+		return artifacts, err
+	}
+	// Distribute the artifacts with the publishers if requested
+	if len(b.publish) > 0 {
+		if err := b.publishArtifacts(outDir, artifacts); err != nil {
+			return artifacts, fmt.Errorf("failed to publish artifacts: %v", err)
+		}
+	}
+	return artifacts, nil
+}
+
+// compileAll cross compiles the native targets with the local Go toolchain and
+// the rest in containers (or the current system if within xgo), returning the
+// folder the outputs were written to.
+func (b *builder) compileAll(natives []string, contained bool) (string, error) {
+	var err error
+	if len(natives) > 0 {
+		err = b.compileNative(natives)
+	}
+	switch {
+	case err != nil || !contained:
+	case b.cfg.Image != "":
+		if b.cfg.Parallel > 1 {
+			err = b.compileParallel()
+		} else {
+			err = b.compile()
+		}
+	default:
+		if b.cfg.Parallel > 1 {
+			log.Println("WARNING: Parallel builds are not supported within xgo, building sequentially")
+		}
+		return "/build", b.compileContained()
+	}
+	return b.cfg.Project.BinPath, err
+}
+
+// flushOutput forwards the output of the builds held back for masking secrets.
+func (b *builder) flushOutput() {
+	for _, out := range []io.Writer{b.stdout, b.stderr} {
+		if w, ok := out.(*redactWriter); ok {
+			w.Flush()
+		}
+	}
+}
+
+// filterTargets keeps the targets of a list found in the given set.
+func filterTargets(targets []string, keep map[string]bool) []string {
+	var kept []string
+	for _, target := range targets {
+		if keep[target] {
+			kept = append(kept, target)
+		}
+	}
+	return kept
+}
+
+// collectArtifacts lists the outputs produced since the given time.
+func collectArtifacts(dir string, since time.Time) []Artifact {
+	var artifacts []Artifact
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || info.ModTime().Before(since) {
+			return nil
+		}
+		target, _ := outputTarget(info.Name())
+		artifacts = append(artifacts, Artifact{Path: path, Target: target})
+		return nil
+	})
+	return artifacts
+}
+
+// Pull pulls the docker image of a build configuration from the registry.
+func Pull(ctx context.Context, cfg Config) error {
+	if cfg.Image == "" {
+		return errors.New("no image to pull")
+	}
+	b, err := newBuilder(ctx, &cfg)
+	if err != nil {
+		return err
+	}
+	if err := b.checkRuntime(); err != nil {
+		return fmt.Errorf("failed to check %s installation: %v", b.runtime, err)
+	}
+	if err := b.login(cfg.Image); err != nil {
+		return err
+	}
+	if err := b.pullImage(cfg.Image); err != nil {
+		return fmt.Errorf("failed to pull docker image from the registry: %v", err)
+	}
+	return b.checkImagePolicy(b.imageDigest(cfg.Image), true)
+}
+
+// ContainerArgs assembles the container engine run arguments, up to the image
+// name, needed to set up a build container for the given configuration.
+func ContainerArgs(cfg Config) ([]string, error) {
+	if err := resolveFlags(&cfg); err != nil {
+		return nil, err
+	}
+	b, err := newBuilder(context.Background(), &cfg)
+	if err != nil {
+		return nil, err
+	}
+	return b.containerArgs(&cfg.Project)
+}
+
+// BuildEnv assembles the environment variables required by the build script to
+// cross compile according to the given configuration. Flags failing to resolve
+// (e.g. an invalid SOURCE_DATE_EPOCH) are reported as given, failing the builds
+// only.
+func BuildEnv(cfg Config) []string {
+	if resolved := cfg; resolveFlags(&resolved) == nil {
+		cfg = resolved
+	}
+	return buildEnv(&cfg.Project, &cfg.Flags)
+}
+
+// Checks whether a docker installation can be found and is functional.
+// 检查是否可以找到docker安装并且功能正常。
+func (b *builder) checkRuntime() error {
+	log.Printf("INFO: Checking %s installation...", b.runtime)
+	if err := b.run(b.command("version")); err != nil {
+		return err
+	}
+	fmt.Fprintln(b.stdout)
+	return nil
+}
+
+// Checks whether a required container image is available locally.
+func (b *builder) checkImage(image string) bool {
+	log.Printf("INFO: Checking for required docker image %s... ", image)
+	err := b.command("image", "inspect", image).Run()
+	return err == nil
+}
+
+// ensureImage makes the build image available according to the pull policy:
+// pulled on every build (always), only if not found locally (missing) or never,
+// failing if it was not preloaded.
+func (b *builder) ensureImage(image string) error {
+	// Images pinned by digest never change, so there is no point in pulling them again
+	if _, _, digest := splitImage(image); b.cfg.Pull != "always" || digest != "" {
+		if b.checkImage(image) {
+			log.Println("INFO: Docker image found!")
+			b.stats.Image = "present"
+			return nil
+		}
+		fmt.Fprintln(b.stdout, "not found!")
+		if b.cfg.Pull == "never" {
+			return fmt.Errorf("docker image %s not found locally and the pull policy is never", image)
+		}
+	}
+	if err := b.login(image); err != nil {
+		return err
+	}
+	if err := b.pullImage(image); err != nil {
+		return fmt.Errorf("failed to pull docker image from the registry: %v", err)
+	}
+	b.stats.Image = "pulled"
+	return nil
+}
+
+// Pulls an image from the container registry.
+func (b *builder) pullImage(image string) error {
+	log.Printf("INFO: Pulling %s from the registry...", image)
+	return b.run(b.command("pull", image))
+}
+
+// downloadDeps caches all external dependencies to prevent always hitting the
+// internet.
+func (b *builder) downloadDeps() error {
+	mirrors, err := parseMirrors(b.cfg.DepsMirrors)
+	if err != nil {
+		return fmt.Errorf("failed to parse dependency mirrors: %v", err)
+	}
+	if b.cfg.Project.Dependencies == "" {
+		return nil
+	}
+	// Download into the project layer of the cache if any, keeping the global clean
+	cache := b.cfg.DepsCache
+	if b.cfg.ProjectCache != "" {
+		cache = b.cfg.ProjectCache
+	}
+	if err := os.MkdirAll(cache, 0751); err != nil {
+		return fmt.Errorf("failed to create dependency cache: %v", err)
+	}
+	// Retrieve all missing dependencies, downloading the archives concurrently
+	var downloads [][2]string
+	for _, spec := range strings.Fields(b.cfg.Project.Dependencies) {
+		dep, err := parseDependency(spec)
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(cache, dep.name)
+
+		// Local folders are copied on every build, their sources may have changed
+		if dep.kind == depLocal {
+			src := dep.src
+			if !filepath.IsAbs(src) && isLocalPath(b.cfg.Project.ProjectPath) {
+				src = filepath.Join(b.cfg.Project.ProjectPath, src)
+			}
+			log.Printf("INFO: Copying local dependency: %s...", src)
+			if err := copyDependency(src, path); err != nil {
+				return fmt.Errorf("failed to copy dependency: %v", err)
+			}
+			continue
+		}
+		if path, ok := b.cachedDep(dep.name); ok {
+			log.Printf("INFO: Dependency already cached: %s.", path)
+			b.stats.DepsHits++
+
+			// Mark the dependency as used, for the age based cache cleanups
+			now := time.Now()
+			os.Chtimes(path, now, now)
+			continue
+		}
+		b.stats.DepsMisses++
+
+		url := dep.src
+		log.Printf("INFO: Downloading new dependency: %s...", spec)
+		if mirror := rewriteURL(url, mirrors); mirror != url {
+			log.Printf("INFO: Using mirror %s", mirror)
+			url = mirror
+		}
+		if dep.kind == depGit {
+			if err := b.cloneDependency(dep, url, path); err != nil {
+				return fmt.Errorf("failed to download dependency: %v", err)
+			}
+			log.Printf("INFO: New dependency cached: %s.", path)
+			continue
+		}
+		downloads = append(downloads, [2]string{url, path})
+	}
+	if err := downloadAll(b.ctx, downloads); err != nil {
+		return fmt.Errorf("failed to download dependencies: %v", err)
+	}
+	return nil
+}
+
+// cachedDep looks up a dependency in the layers of the dependency cache,
+// the project one taking precedence over the global one.
+func (b *builder) cachedDep(name string) (string, bool) {
+	for _, cache := range []string{b.cfg.ProjectCache, b.cfg.DepsCache} {
+		if cache == "" {
+			continue
+		}
+		if path := filepath.Join(cache, name); fileExists(path) {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// compile cross builds a requested package according to the given build specs
+// using a specific docker cross compilation image. If the build fails, the failed
+// targets are retried individually if requested.
+func (b *builder) compile() error {
+	config, start := &b.cfg.Project, time.Now()
+	original := *config // Kept for the retries, as the container setup may modify it
+
+	log.Printf("INFO: Cross compiling project %s package %s ...", config.ProjectPath, config.CmdPath)
+	err := b.compileIn(config)
+	if err != nil && b.cfg.Retries > 0 {
+		err = b.retryTargets(&original, start, err)
+	}
+	return err
+}
+
+// compileIn cross builds the targets of the given build specs in a single build
+// container.
+func (b *builder) compileIn(config *ConfigFlags) error {
+	config, image, commit := b.warmStart(config)
+	args, err := b.containerArgs(config)
+	if err != nil {
+		return err
+	}
+	// Assemble and run the cross compilation command
+	args = append(args, []string{image, config.CmdPath}...)
+	b.logCommand(args)
+
+	stdout := &progressWriter{b: b, out: b.stdout}
+	err = b.runContainer(args, config, commit, stdout, b.stderr)
+	b.flushOutput()
+	b.finishTargets(stdout.started, err)
+	return err
+}
+
+// containerArgs assembles the docker run arguments, up to the image name, needed
+// to set up a build container with the project, caches and build specs mounted.
+func (b *builder) containerArgs(config *ConfigFlags) ([]string, error) {
+	// If a local build was requested, find the import path and mount all GOPATH sources
+	locals, mounts, paths := []string{}, []string{}, []string{}
+	var usesModules bool = true
+	if isLocalPath(config.ProjectPath) {
+		if fileExists(filepath.Join(config.ProjectPath, "go.mod")) {
+			usesModules = true
+		}
+		if !usesModules {
+			// Resolve the repository import path from the file path
+			path, err := resolveImportPath(config.ProjectPath)
+			if err != nil {
+				return nil, err
+			}
+			config.ProjectPath = path
+			if fileExists(filepath.Join(config.ProjectPath, "go.mod")) {
+				usesModules = true
+			}
+		}
+		if !usesModules {
+			log.Println("INFO: go.mod not found. Skipping go modules")
+		}
+
+		gopathEnv := os.Getenv("GOPATH")
+		if gopathEnv == "" && !usesModules {
+			log.Printf("INFO: No $GOPATH is set - defaulting to %s", build.Default.GOPATH)
+			gopathEnv = build.Default.GOPATH
+		}
+
+		// Iterate over all the local libs and export the mount points
+		if gopathEnv == "" && !usesModules {
+			return nil, errors.New("no $GOPATH is set or forwarded to xgo")
+		}
+
+		if !usesModules {
+			for _, gopath := range strings.Split(gopathEnv, string(os.PathListSeparator)) {
+				// Since docker sandboxes volumes, resolve any symlinks manually
+				sources := filepath.Join(gopath, "src")
+				filepath.Walk(sources, func(path string, info os.FileInfo, err error) error {
+					// Skip any folders that errored out
+					if err != nil {
+						log.Printf("WARNING: Failed to access GOPATH element %s: %v", path, err)
+						return nil
+					}
+					// Skip anything that's not a symlink
+					if info.Mode()&os.ModeSymlink == 0 {
+						return nil
+					}
+					// Resolve the symlink and skip if it's not a folder
+					target, err := filepath.EvalSymlinks(path)
+					if err != nil {
+						return nil
+					}
+					if info, err = os.Stat(target); err != nil || !info.IsDir() {
+						return nil
+					}
+					// Skip if the symlink points within GOPATH
+					if filepath.HasPrefix(target, sources) {
+						return nil
+					}
+
+					// Folder needs explicit mounting due to docker symlink security
+					locals = append(locals, target)
+					mounts = append(mounts, filepath.Join("/ext-go", strconv.Itoa(len(locals)), "src", strings.TrimPrefix(path, sources)))
+					paths = append(paths, filepath.ToSlash(filepath.Join("/ext-go", strconv.Itoa(len(locals)))))
+					return nil
+				})
+				// Export the main mount point for this GOPATH entry
+				locals = append(locals, sources)
+				mounts = append(mounts, filepath.Join("/ext-go", strconv.Itoa(len(locals)), "src"))
+				paths = append(paths, filepath.ToSlash(filepath.Join("/ext-go", strconv.Itoa(len(locals)))))
+			}
+		}
+	}
+	args := []string{"run", "--rm"}
+	args = append(args, b.runtimeArgs()...)
+	for _, dns := range b.cfg.DNS {
+		args = append(args, "--dns", dns)
+	}
+	for _, search := range b.cfg.DNSSearch {
+		args = append(args, "--dns-search", search)
+	}
+	for _, host := range b.cfg.AddHosts {
+		args = append(args, "--add-host", host)
+	}
+	if b.cfg.Network != "" {
+		args = append(args, "--network", b.cfg.Network)
+	}
+	args = append(args,
+		"-v", volume(config.BinPath, "/build"),
+		"-v", volume(b.cfg.DepsCache, "/deps-cache", "ro"),
+	)
+	if b.cfg.ProjectCache != "" && fileExists(b.cfg.ProjectCache) {
+		args = append(args, "-v", volume(b.cfg.ProjectCache, "/deps-cache-project", "ro"))
+	}
+	for _, env := range buildEnv(config, &b.cfg.Flags) {
+		args = append(args, "-e", env)
+	}
+	for _, env := range b.ownerEnv() {
+		args = append(args, "-e", env)
+	}
+	for _, env := range mobileEnv() {
+		args = append(args, "-e", env)
+	}
+	if b.cfg.SSHAgent {
+		ssh, err := b.sshAgentArgs()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, ssh...)
+	}
+	if b.secrets != "" {
+		args = append(args, "-v", volume(b.secrets, "/run/secrets", "ro"))
+	}
+	if b.winres != "" {
+		args = append(args, "-v", volume(b.winres, "/xgo-winres", "ro"), "-e", "WINDOWS_RESOURCES=/xgo-winres")
+	}
+	if b.cfg.Netrc != "" {
+		netrc, err := b.netrcArgs()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, netrc...)
+	}
+	if b.cfg.GitConfig {
+		git, err := b.gitConfigArgs()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, git...)
+	}
+	for _, profile := range config.Profiles {
+		for _, volume := range profile.Volumes {
+			args = append(args, "-v", volume)
+		}
+	}
+	if usesModules {
+		args = append(args, []string{"-e", "GO111MODULE=on"}...)
+		args = append(args, []string{"-v", volume(build.Default.GOPATH, "/go")}...)
+		if b.cfg.GoProxy != "" {
+			args = append(args, []string{"-e", fmt.Sprintf("GOPROXY=%s", b.cfg.GoProxy)}...)
+		}
+		if b.cfg.GoSumDB != "" {
+			args = append(args, []string{"-e", fmt.Sprintf("GOSUMDB=%s", b.cfg.GoSumDB)}...)
+		}
+		if b.cfg.GoNoSumDB != "" {
+			args = append(args, []string{"-e", fmt.Sprintf("GONOSUMDB=%s", b.cfg.GoNoSumDB)}...)
+		}
+		if b.cfg.GoPrivate != "" {
+			args = append(args, []string{"-e", fmt.Sprintf("GOPRIVATE=%s", b.cfg.GoPrivate)}...)
+		}
+		if b.cfg.GoNoProxy != "" {
+			args = append(args, []string{"-e", fmt.Sprintf("GONOPROXY=%s", b.cfg.GoNoProxy)}...)
+		}
+		if b.cfg.GoInsecure != "" {
+			args = append(args, []string{"-e", fmt.Sprintf("GOINSECURE=%s", b.cfg.GoInsecure)}...)
+		}
+		if b.cfg.GoFlags != "" {
+			args = append(args, []string{"-e", fmt.Sprintf("GOFLAGS=%s", b.cfg.GoFlags)}...)
+		}
+
+		// Map this repository to the /source folder
+		absProjectPath, err := filepath.Abs(config.ProjectPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to locate requested module repository: %v", err)
+		}
+		switch {
+		case b.ignore != nil && b.cfg.ReadOnlySource:
+			// The sources are copied into the container once created
+			args = append(args, []string{"-w", "/source-ro"}...)
+		case b.ignore != nil:
+			args = append(args, []string{"-w", "/source"}...)
+		case b.cfg.ReadOnlySource:
+			// The build script overlays the sources with a writable layer
+			args = append(args, []string{"-v", volume(absProjectPath, "/source-ro", "ro"), "-w", "/source-ro"}...)
+		default:
+			args = append(args, []string{"-v", volume(absProjectPath, "/source"), "-w", "/source"}...)
+		}
+
+		// Check whether it has a vendor folder, and if so, use it
+		vendorPath := filepath.Join(absProjectPath, "vendor")
+		vendorfolder, err := os.Stat(vendorPath)
+		if !os.IsNotExist(err) && vendorfolder.Mode().IsDir() {
+			args = append(args, []string{"-e", "FLAG_MOD=vendor"}...)
+			log.Printf("INFO: Using vendored Go module dependencies")
+		}
+	} else {
+		args = append(args, []string{"-e", "GO111MODULE=off"}...)
+		for i := 0; i < len(locals); i++ {
+			args = append(args, []string{"-v", volume(locals[i], filepath.ToSlash(mounts[i]), "ro")}...)
+		}
+		args = append(args, []string{"-e", "EXT_GOPATH=" + strings.Join(paths, ":")}...)
+	}
+	return args, nil
+}
+
+// compileContained cross builds a requested package according to the given build
+// specs using the current system opposed to running in a container. This is meant
+// to be used for cross compilation already from within an xgo image, allowing the
+// inheritance and bundling of the root xgo images.
+func (b *builder) compileContained() error {
+	config := &b.cfg.Project
+
+	// If a local build was requested, resolve the import path
+	var env []string
+	local := isLocalPath(config.ProjectPath)
+	if local {
+		// Resolve the repository import path from the file path
+		path, err := resolveImportPath(config.ProjectPath)
+		if err != nil {
+			return err
+		}
+		config.ProjectPath = path
+
+		// Determine if this is a module-based repository
+		usesModules := fileExists(filepath.Join(config.ProjectPath, "go.mod"))
+		if !usesModules {
+			env = append(env, "GO111MODULE=off")
+			log.Println("INFO: Don't use go modules (go.mod not found)")
+		}
+	}
+	// Fine tune the original environment variables with those required by the build script
+	env = append(env, buildEnv(config, &b.cfg.Flags)...)
+	if local {
+		env = append(env, "EXT_GOPATH=/non-existent-path-to-signal-local-build")
+	}
+	if b.winres != "" {
+		env = append(env, "WINDOWS_RESOURCES="+b.winres)
+	}
+	// Assemble and run the local cross compilation command
+	log.Printf("INFO: Cross compiling project %s package %s ...", config.ProjectPath, config.CmdPath)
+
+	cmd := exec.CommandContext(b.ctx, "xgo-build", config.CmdPath)
+	cmd.Env = append(os.Environ(), env...)
+
+	stdout := &progressWriter{b: b, out: b.stdout}
+	cmd.Stdout, cmd.Stderr = stdout, b.stderr
+	err := cmd.Run()
+	b.finishTargets(stdout.started, err)
+	return err
+}
+
+// buildEnv assembles the environment variables required by the build script to
+// cross compile according to the given build specs.
+func buildEnv(config *ConfigFlags, flags *BuildFlags) []string {
+	env := []string{
+		"REPO_REMOTE=" + config.Remote,
+		"REPO_BRANCH=" + config.Branch,
+		"PACK=" + config.Package,
+		"PACK_INCLUDE=" + config.Include,
+		"PACK_EXCLUDE=" + config.Exclude,
+		"DEPS=" + dependencyNames(config.Dependencies),
+		"ARGS=" + config.Arguments,
+		"OUT=" + config.Prefix,
+		fmt.Sprintf("FLAG_V=%v", flags.Verbose),
+		fmt.Sprintf("FLAG_X=%v", flags.Steps),
+		fmt.Sprintf("FLAG_RACE=%v", flags.Race),
+		fmt.Sprintf("FLAG_TAGS=%s", flags.Tags),
+		fmt.Sprintf("FLAG_LDFLAGS=%s", flags.LdFlags),
+		fmt.Sprintf("FLAG_BUILDMODE=%s", scriptMode(flags.Mode)),
+		fmt.Sprintf("FLAG_BUILDVCS=%s", flags.VCS),
+		fmt.Sprintf("FLAG_TRIMPATH=%v", flags.TrimPath),
+		fmt.Sprintf("FLAG_ARM_FLOAT_ABI=%s", flags.ArmABI),
+		fmt.Sprintf("FLAG_SYNTH_MODULE=%v", flags.SynthMod),
+		fmt.Sprintf("FLAG_WINDOWS_SUBSYSTEM=%s", flags.Subsystem),
+		"TARGETS=" + strings.Replace(strings.Join(config.Targets, " "), "*", ".", -1),
+	}
+	env = append(env, flags.CgoCFlags.env("FLAG_CGO_CFLAGS")...)
+	env = append(env, flags.CgoLdFlags.env("FLAG_CGO_LDFLAGS")...)
+	env = append(env, profileEnv(config.Profiles)...)
+	env = append(env, matrixEnv(config.Targets, flags))
+	if flags.Epoch != "" {
+		env = append(env, "SOURCE_DATE_EPOCH="+flags.Epoch)
+	}
+	return env
+}
+
+// resolveImportPath converts a package given by a relative path to a Go import
+// path using the local GOPATH environment.
+func resolveImportPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to locate requested package: %v", err)
+	}
+	stat, err := os.Stat(abs)
+	if err != nil || !stat.IsDir() {
+		return "", errors.New("requested path invalid")
+	}
+	pack, err := build.ImportDir(abs, build.FindOnly)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve import path: %v", err)
+	}
+	return pack.ImportPath, nil
+}
+
+// run executes a command synchronously, redirecting its output to the build's.
+func (b *builder) run(cmd *exec.Cmd) error {
+	cmd.Stdout = b.stdout
+	cmd.Stderr = b.stderr
+
+	return cmd.Run()
+}
+
+// fileExists checks if given file exists
+func fileExists(file string) bool {
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return false
+	}
+	return true
+}
+
+// FormatSize converts a byte count into a human readable size.
+func FormatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}